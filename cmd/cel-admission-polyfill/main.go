@@ -4,7 +4,9 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -13,6 +15,7 @@ import (
 	apiextensionsclientsetscheme "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/scheme"
 	apiextensionsinformers "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apiserver/pkg/admission"
 	"k8s.io/client-go/dynamic"
@@ -25,21 +28,64 @@ import (
 	"k8s.io/klog/v2"
 	aggregatorclientsetscheme "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset/scheme"
 
+	"k8s.io/cel-admission-webhook/pkg/authz"
 	"k8s.io/cel-admission-webhook/pkg/controller/admissionregistration.x-k8s.io/v1alpha1"
 	"k8s.io/cel-admission-webhook/pkg/controller/schemaresolver"
 	"k8s.io/cel-admission-webhook/pkg/generated/clientset/versioned"
 	"k8s.io/cel-admission-webhook/pkg/generated/clientset/versioned/scheme"
-	"k8s.io/cel-admission-webhook/pkg/generated/informers/externalversions"
+	"k8s.io/cel-admission-webhook/pkg/native"
+	"k8s.io/cel-admission-webhook/pkg/policysource"
 	"k8s.io/cel-admission-webhook/pkg/validator"
 	"k8s.io/cel-admission-webhook/pkg/webhook"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		subcommands := map[string]func(context.Context, []string) error{
+			"replay":  runReplay,
+			"migrate": runMigrate,
+		}
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(runSubcommand(run, os.Args[2:]))
+		}
+	}
+
 	var certFile, keyFile string
 	var listenAddr string
+	var adminAddr string
+	var policyDir string
+	var stdin bool
+	var recordOptions webhook.RecorderOptions
+	var recordResources string
+	var recordRedact string
+	var nativeMode string
+	var nativeCheckInterval time.Duration
+	var authzOptions authz.Options
+	var aggregation string
+	var webhooksConfig string
+	var enforcement string
+	var enforcementFile string
 	flag.StringVar(&certFile, "cert", "server.pem", "Path to TLS certificate file.")
 	flag.StringVar(&keyFile, "key", "server-key.pem", "Path to TLS key file.")
 	flag.StringVar(&listenAddr, "addr", "0.0.0.0:8443", "Address to listen on.")
+	flag.StringVar(&adminAddr, "admin-addr", "", "Address to serve the unauthenticated debugging endpoints on over plain HTTP, /debug/explain and /debug/policies. Disabled if empty. Should only be reachable by administrators, e.g. 127.0.0.1:8081.")
+	flag.StringVar(&policyDir, "policy-dir", "", "Path to a directory of ValidatingAdmissionPolicy, binding and param manifests. If set, policies are loaded from the directory instead of the cluster, and no cluster connection is required.")
+	flag.BoolVar(&stdin, "stdin", false, "Evaluate AdmissionReview requests read from stdin and write the responses to stdout instead of serving HTTPS. Exits non-zero if any request is denied.")
+	flag.StringVar(&recordOptions.Path, "record", "", "Path of a JSON lines file to record admission requests and responses to, for later replay. Recording is disabled if empty.")
+	flag.Int64Var(&recordOptions.MaxSize, "record-max-size", 100*1024*1024, "Size in bytes the recording may grow to before it is rotated.")
+	flag.IntVar(&recordOptions.MaxBackups, "record-max-backups", 3, "Number of rotated recordings to keep.")
+	flag.Float64Var(&recordOptions.SampleRate, "record-sample-rate", 1, "Fraction of requests to record, between 0 and 1.")
+	flag.StringVar(&recordResources, "record-resources", "", "Comma separated list of resources to record, as resource.group (e.g. deployments.apps, configmaps). All resources are recorded if empty.")
+	flag.StringVar(&recordRedact, "record-redact", "", "Comma separated list of field paths to redact from recorded objects, in addition to Secret data, e.g. metadata.annotations['example.com/token']. Messages, warnings and audit annotations in responses to Secrets, or to any request if paths are set, are redacted too.")
+	flag.StringVar(&nativeMode, "native-policy-mode", string(native.ModeEnforce), "What to do when the cluster serves the native admissionregistration.k8s.io ValidatingAdmissionPolicy API. One of enforce (keep enforcing the polyfill's policies), defer (allow every request and leave enforcement to the native implementation) or shadow (allow every request, and log and audit annotate requests on which the polyfill's and the native v1alpha1 policies disagree; refused if the cluster serves a newer native version).")
+	flag.DurationVar(&nativeCheckInterval, "native-policy-check-interval", time.Minute, "How often to check discovery for the native ValidatingAdmissionPolicy API.")
+	flag.DurationVar(&authzOptions.AllowedTTL, "authorization-allowed-ttl", 5*time.Minute, "How long to cache SubjectAccessReview decisions allowing a request made by CEL authorizer checks.")
+	flag.DurationVar(&authzOptions.DeniedTTL, "authorization-denied-ttl", 30*time.Second, "How long to cache SubjectAccessReview decisions denying a request made by CEL authorizer checks.")
+	flag.IntVar(&authzOptions.CacheSize, "authorization-cache-size", 10000, "Maximum number of SubjectAccessReview decisions to cache.")
+	flag.StringVar(&aggregation, "validator-aggregation", string(validator.AggregationFirstError), "How the decisions of the policy sources are combined. One of first-error (deny with the first error, skipping the remaining sources), collect-all (run every source and deny with all of their errors) or run-all-then-deny (run every source, so all warnings and audit annotations are recorded, and deny with the first error).")
+	flag.StringVar(&webhooksConfig, "webhooks-config", "", "Path to a YAML file listing external validating webhooks to forward every request to after the policies, each with a name, url, caBundle, timeout and failurePolicy. Their denials, warnings and audit annotations are merged into the polyfill's response.")
+	flag.StringVar(&enforcement, "enforcement", string(validator.EnforcementDeny), "What to do with denied requests, regardless of the validationActions of the bindings denying them. One of deny, warn (allow the request, returning the denial as a warning and audit annotation) or audit (allow the request, only recording the denial in an audit annotation).")
+	flag.StringVar(&enforcementFile, "enforcement-file", "", "Path to a file containing the enforcement, which overrides -enforcement and is reloaded whenever it changes.")
 	flag.Parse()
 
 	klog.EnableContextualLogging(true)
@@ -48,82 +94,78 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	restConfig, err := loadClientConfig()
-	if err != nil {
-		fmt.Printf("Failed to load Client Configuration: %v", err)
-		return
-	}
+	addToScheme()
 
-	// Make the kubernetes clientset scheme aware of all kubernetes types
-	// and our custom CRD types
-	scheme.AddToScheme(clientsetscheme.Scheme)
-	apiextensionsclientsetscheme.AddToScheme(clientsetscheme.Scheme)
-	aggregatorclientsetscheme.AddToScheme(clientsetscheme.Scheme)
-
-	customClient, err := versioned.NewForConfig(restConfig)
+	aggregationMode, err := validator.ParseAggregation(aggregation)
 	if err != nil {
-		klog.Errorf("Failed to create crd client: %v", err)
+		klog.Errorf("Invalid -validator-aggregation: %v", err)
 		return
 	}
-
-	unwrappedKubeClient, err := kubernetes.NewForConfig(restConfig)
-	// customClient := versioned.New(kubeClient.Discovery().RESTClient())
+	enforcementMode, err := validator.ParseEnforcement(enforcement)
 	if err != nil {
-		fmt.Printf("Failed to create kubernetes client: %v", err)
+		klog.Errorf("Invalid -enforcement: %v", err)
 		return
 	}
 
-	// Override the typed validating admission policy client in the kubeClient
-	kubeClient := v1alpha1.NewWrappedClient(unwrappedKubeClient, customClient)
-
-	dynamicClient, err := dynamic.NewForConfig(restConfig)
-	if err != nil {
-		klog.Errorf("Failed to create dynamic client: %v", err)
-		return
-	}
+	var recorder *webhook.Recorder
+	if len(recordOptions.Path) > 0 {
+		for _, r := range splitList(recordResources) {
+			recordOptions.Resources = append(recordOptions.Resources, schema.ParseGroupResource(r))
+		}
+		recordOptions.RedactPaths = splitList(recordRedact)
 
-	apiextensionsClient, err := apiextensionsclientset.NewForConfig(restConfig)
-	if err != nil {
-		klog.Errorf("Failed to create apiextensions client: %v", err)
-		return
+		var err error
+		recorder, err = webhook.NewRecorder(recordOptions)
+		if err != nil {
+			klog.Errorf("Failed to set up recorder: %v", err)
+			return
+		}
+		defer recorder.Close()
 	}
 
 	// used to keep process alive until all workers are finished
 	waitGroup := sync.WaitGroup{}
 	serverContext, serverCancel := context.WithCancel(ctx)
 
-	// Start any informers
-	// What is appropriate resync perriod?
-	factory := informers.NewSharedInformerFactory(kubeClient, 30*time.Second)
-	customFactory := externalversions.NewSharedInformerFactory(customClient, 30*time.Second)
-	apiextensionsFactory := apiextensionsinformers.NewSharedInformerFactory(apiextensionsClient, 30*time.Second)
+	var validators []admission.ValidationInterface
+	startInformers := func(stopCh <-chan struct{}) {}
 
-	restmapper := meta.NewLazyRESTMapperLoader(func() (meta.RESTMapper, error) {
-		groupResources, err := restmapper.GetAPIGroupResources(kubeClient.Discovery())
+	if len(policyDir) > 0 {
+		validators = append(validators, policysource.NewFileSource(policyDir, nil))
+	} else {
+		mode, err := native.ParseMode(nativeMode)
 		if err != nil {
-			return nil, err
+			klog.Errorf("Invalid -native-policy-mode: %v", err)
+			return
 		}
-		return restmapper.NewDiscoveryRESTMapper(groupResources), nil
-	}).(meta.ResettableRESTMapper)
 
-	go wait.PollUntilContextCancel(ctx, 1*time.Minute, false, func(ctx context.Context) (done bool, err error) {
-		// Refresh restmapper every minute
-		restmapper.Reset()
-		return false, nil
-	})
+		plugin, start, err := newClusterPlugin(serverContext, mode, nativeCheckInterval, authzOptions)
+		if err != nil {
+			klog.Errorf("Failed to set up cluster policy source: %v", err)
+			return
+		}
+		validators = append(validators, plugin)
+		startInformers = start
+	}
 
-	// structuralschemaController := structuralschema.NewController(
-	// 	apiextensionsFactory.Apiextensions().V1().CustomResourceDefinitions().Informer(),
-	// )
+	if len(webhooksConfig) > 0 {
+		configs, err := validator.LoadWebhooks(webhooksConfig)
+		if err != nil {
+			klog.Errorf("Failed to load webhooks: %v", err)
+			return
+		}
+		webhooks, err := validator.NewWebhooks(configs)
+		if err != nil {
+			klog.Errorf("Invalid -webhooks-config: %v", err)
+			return
+		}
+		validators = append(validators, webhooks)
+	}
 
 	type runnable interface {
 		Run(context.Context) error
 	}
 
-	validators := []admission.ValidationInterface{
-		v1alpha1.NewPlugin(factory, kubeClient, restmapper, schemaresolver.New(apiextensionsFactory.Apiextensions().V1().CustomResourceDefinitions(), kubeClient.Discovery()), dynamicClient, nil),
-	}
-
 	for _, v := range validators {
 		if r, ok := v.(runnable); ok {
 			waitGroup.Add(1)
@@ -138,7 +180,62 @@ func main() {
 		}
 	}
 
-	webhook := webhook.New(listenAddr, certFile, keyFile, clientsetscheme.Scheme, validator.NewMulti(validators...))
+	override := validator.NewOverride(validator.NewMulti(aggregationMode, validators...), enforcementMode, enforcementFile)
+	if len(enforcementFile) > 0 {
+		if err := override.Reload(); err != nil {
+			klog.Errorf("Invalid -enforcement-file: %v", err)
+			serverCancel()
+			waitGroup.Wait()
+			return
+		}
+
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			if err := override.Run(serverContext); err != nil && serverContext.Err() == nil {
+				klog.Errorf("enforcement file watcher stopped due to error: %v", err)
+			}
+		}()
+	}
+
+	reviewer := webhook.NewReviewer(clientsetscheme.Scheme, override)
+	if recorder != nil {
+		reviewer.SetRecorder(recorder)
+	}
+
+	if stdin {
+		// Start after informers have been requested from factory
+		startInformers(serverContext.Done())
+
+		denied, err := reviewStdin(serverContext, reviewer, validators)
+		serverCancel()
+		waitGroup.Wait()
+
+		if err != nil {
+			klog.Errorf("Failed to review stdin: %v", err)
+			os.Exit(1)
+		} else if denied > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(adminAddr) > 0 {
+		admin := webhook.NewAdmin(adminAddr, reviewer)
+
+		waitGroup.Add(1)
+		go func() {
+			defer func() {
+				serverCancel()
+				waitGroup.Done()
+			}()
+
+			cancellationReason := admin.Run(serverContext)
+			klog.Infof("admin server closure reason: %v", cancellationReason)
+		}()
+	}
+
+	webhook := webhook.New(listenAddr, certFile, keyFile, reviewer)
 
 	// Start HTTP REST server for webhook
 	waitGroup.Add(1)
@@ -154,15 +251,165 @@ func main() {
 	}()
 
 	// Start after informers have been requested from factory
-	factory.Start(serverContext.Done())
-	apiextensionsFactory.Start(serverContext.Done())
-	customFactory.Start(serverContext.Done())
+	startInformers(serverContext.Done())
 
 	// Wait for controller and HTTP server to stop. They both signal to the other's
 	// context that it is time to wrap up
 	waitGroup.Wait()
 }
 
+// Make the kubernetes clientset scheme aware of all kubernetes types
+// and our custom CRD types
+func addToScheme() {
+	scheme.AddToScheme(clientsetscheme.Scheme)
+	apiextensionsclientsetscheme.AddToScheme(clientsetscheme.Scheme)
+	aggregatorclientsetscheme.AddToScheme(clientsetscheme.Scheme)
+}
+
+func runSubcommand(run func(context.Context, []string) error, args []string) int {
+	klog.EnableContextualLogging(true)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	addToScheme()
+
+	if err := run(ctx, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// reviewStdin waits for the validators to sync, then evaluates the
+// AdmissionReviews on stdin and writes their responses to stdout. Returns the
+// number of requests which were denied.
+func reviewStdin(ctx context.Context, reviewer *webhook.Reviewer, validators []admission.ValidationInterface) (int, error) {
+	type syncable interface {
+		HasSynced() bool
+	}
+
+	if err := wait.PollUntilContextCancel(ctx, 100*time.Millisecond, true, func(ctx context.Context) (bool, error) {
+		for _, v := range validators {
+			if s, ok := v.(syncable); ok && !s.HasSynced() {
+				return false, nil
+			}
+		}
+		return true, nil
+	}); err != nil {
+		return 0, fmt.Errorf("policies failed to sync: %w", err)
+	}
+
+	return reviewer.ReviewStream(ctx, os.Stdin, os.Stdout)
+}
+
+// newClusterPlugin creates a validator which evaluates the
+// admissionregistration.x-k8s.io policies and bindings stored in the cluster.
+// The returned function starts the informers the validator depends upon, and
+// must be called after the validator has been started.
+//
+// Once the cluster serves the native ValidatingAdmissionPolicy API, the
+// validator behaves according to mode.
+func newClusterPlugin(ctx context.Context, mode native.Mode, nativeCheckInterval time.Duration, authzOptions authz.Options) (admission.ValidationInterface, func(stopCh <-chan struct{}), error) {
+	restConfig, err := loadClientConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load client configuration: %w", err)
+	}
+
+	customClient, err := versioned.NewForConfig(restConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create crd client: %w", err)
+	}
+
+	unwrappedKubeClient, err := kubernetes.NewForConfig(restConfig)
+	// customClient := versioned.New(kubeClient.Discovery().RESTClient())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	// Override the typed validating admission policy client in the kubeClient
+	kubeClient := v1alpha1.NewWrappedClient(unwrappedKubeClient, customClient)
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	apiextensionsClient, err := apiextensionsclientset.NewForConfig(restConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create apiextensions client: %w", err)
+	}
+
+	// Start any informers
+	// What is appropriate resync perriod?
+	factory := informers.NewSharedInformerFactory(kubeClient, 30*time.Second)
+	apiextensionsFactory := apiextensionsinformers.NewSharedInformerFactory(apiextensionsClient, 30*time.Second)
+
+	// Serve the policy informers from the x-k8s CRDs, converting each object
+	// once as it is received
+	if err := v1alpha1.InjectInformers(factory, customClient); err != nil {
+		return nil, nil, err
+	}
+
+	restmapper := meta.NewLazyRESTMapperLoader(func() (meta.RESTMapper, error) {
+		groupResources, err := restmapper.GetAPIGroupResources(kubeClient.Discovery())
+		if err != nil {
+			return nil, err
+		}
+		return restmapper.NewDiscoveryRESTMapper(groupResources), nil
+	}).(meta.ResettableRESTMapper)
+
+	go wait.PollUntilContextCancel(ctx, 1*time.Minute, false, func(ctx context.Context) (done bool, err error) {
+		// Refresh restmapper every minute
+		restmapper.Reset()
+		return false, nil
+	})
+
+	// structuralschemaController := structuralschema.NewController(
+	// 	apiextensionsFactory.Apiextensions().V1().CustomResourceDefinitions().Informer(),
+	// )
+
+	schemaResolver := schemaresolver.New(apiextensionsFactory.Apiextensions().V1().CustomResourceDefinitions(), kubeClient.Discovery())
+	// CEL authorizer checks are answered by the apiserver, for the user
+	// making the request
+	authorizer := authz.New(unwrappedKubeClient.AuthorizationV1().SubjectAccessReviews(), authzOptions)
+
+	plugin := v1alpha1.NewPlugin(factory, kubeClient, restmapper, schemaResolver, dynamicClient, authorizer)
+
+	// Evaluates the native policies in shadow mode, reading them with the
+	// unwrapped client. Refused if the cluster serves a newer version than
+	// the plugin can read.
+	var nativePlugin admission.ValidationInterface
+	nativeFactory := informers.NewSharedInformerFactory(unwrappedKubeClient, 30*time.Second)
+	if mode == native.ModeShadow {
+		served, err := native.Detect(unwrappedKubeClient.Discovery())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to discover native ValidatingAdmissionPolicy API: %w", err)
+		} else if err := native.CheckShadow(served); err != nil {
+			return nil, nil, err
+		}
+		nativePlugin = v1alpha1.NewPlugin(nativeFactory, unwrappedKubeClient, restmapper, schemaResolver, dynamicClient, authorizer)
+	}
+
+	detector := native.NewDetector(unwrappedKubeClient.Discovery(), nativeCheckInterval)
+	return native.NewValidator(mode, detector, plugin, nativePlugin), func(stopCh <-chan struct{}) {
+		factory.Start(stopCh)
+		apiextensionsFactory.Start(stopCh)
+		nativeFactory.Start(stopCh)
+	}, nil
+}
+
+// splitList splits a comma separated flag value, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func loadClientConfig() (*rest.Config, error) {
 	// Connect to k8s
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
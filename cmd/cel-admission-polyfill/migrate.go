@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+
+	"k8s.io/cel-admission-webhook/pkg/migrate"
+	"k8s.io/cel-admission-webhook/pkg/native"
+)
+
+// runMigrate copies the x-k8s policies and bindings in the cluster to the
+// native ValidatingAdmissionPolicy API
+func runMigrate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	var options migrate.Options
+	var version, output string
+	flags.BoolVar(&options.DryRun, "dry-run", false, "Print the migration plan, including any fields the target version does not support, without changing anything.")
+	flags.BoolVar(&options.LabelOriginals, "label-originals", false, fmt.Sprintf("Label migrated x-k8s policies and bindings with %s=true, and annotate them with %s.", migrate.MigratedLabel, migrate.MigratedToAnnotation))
+	flags.BoolVar(&options.Force, "force", false, "Take ownership of fields of existing native policies and bindings set by other field managers.")
+	flags.StringVar(&options.FieldManager, "field-manager", migrate.DefaultFieldManager, "Field manager to apply the native policies and bindings with.")
+	flags.StringVar(&version, "version", "", "Version of admissionregistration.k8s.io to migrate to. Defaults to the newest version the cluster serves ValidatingAdmissionPolicy at.")
+	flags.StringVar(&output, "o", "text", "Output format. One of: text, json.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s migrate [-dry-run] [-label-originals]\n\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Copies every admissionregistration.x-k8s.io ValidatingAdmissionPolicy and binding to the native admissionregistration.k8s.io API with server-side apply.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+
+	config, err := loadClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load client configuration: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	served, err := native.Detect(client.Discovery())
+	if err != nil {
+		return fmt.Errorf("failed to discover the native ValidatingAdmissionPolicy API: %w", err)
+	} else if len(served) == 0 {
+		return fmt.Errorf("the cluster does not serve the native ValidatingAdmissionPolicy API")
+	}
+
+	options.GroupVersion = served[0]
+	if len(version) > 0 {
+		options.GroupVersion = schema.GroupVersion{Group: served[0].Group, Version: version}
+		if !contains(served, options.GroupVersion) {
+			return fmt.Errorf("the cluster does not serve ValidatingAdmissionPolicy at %s, only at %v", options.GroupVersion, served)
+		}
+	}
+
+	migrator, err := migrate.New(config)
+	if err != nil {
+		return err
+	}
+	report, err := migrator.Migrate(ctx, options)
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.Print(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	if failed := report.Failed(); failed > 0 {
+		return fmt.Errorf("failed to migrate %d policies and bindings", failed)
+	}
+	return nil
+}
+
+func contains(list []schema.GroupVersion, gv schema.GroupVersion) bool {
+	for _, item := range list {
+		if item == gv {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"k8s.io/cel-admission-webhook/pkg/policysource"
+	"k8s.io/cel-admission-webhook/pkg/replay"
+	"k8s.io/cel-admission-webhook/pkg/webhook"
+)
+
+// runReplay re-evaluates recorded requests or audit logs against a candidate
+// policy directory and reports how the decisions differ from those recorded
+func runReplay(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	var policyDir, output string
+	var failOnChange bool
+	flags.StringVar(&policyDir, "policy-dir", "", "Path to the directory of candidate ValidatingAdmissionPolicy, binding and param manifests to replay against.")
+	flags.StringVar(&output, "o", "text", "Output format. One of: text, json.")
+	flags.BoolVar(&failOnChange, "fail-on-change", false, "Exit non-zero if any decision differs from the recorded one.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s replay -policy-dir DIR FILE...\n\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Replays requests from recordings made with -record, or kube-apiserver audit logs at the RequestResponse level, against a candidate set of policies.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if len(policyDir) == 0 || flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("-policy-dir and at least one file are required")
+	}
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+
+	var reviews []webhook.RecordedReview
+	for _, path := range flags.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		read, err := replay.Read(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		reviews = append(reviews, read...)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	source := policysource.NewFileSource(policyDir, nil)
+	if err := source.Reload(ctx); err != nil {
+		return fmt.Errorf("failed to load policies: %w", err)
+	}
+
+	report, err := replay.Replay(ctx, webhook.NewReviewer(clientsetscheme.Scheme, source), reviews)
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.Print(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	if failOnChange && report.HasChanges() {
+		return fmt.Errorf("decisions changed for %d policies and bindings", len(report.Groups))
+	}
+	return nil
+}
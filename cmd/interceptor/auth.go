@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/authenticatorfactory"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+	"k8s.io/apiserver/pkg/server/options"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+)
+
+// authMode is whose credentials requests are forwarded with
+type authMode string
+
+const (
+	// Every request uses the interceptor's own kubeconfig credentials
+	authModeKubeconfig authMode = "kubeconfig"
+
+	// Requests are forwarded with the caller's own bearer token. Client
+	// certificates can't be forwarded, so callers which only have one are
+	// refused
+	authModePassthrough authMode = "passthrough"
+
+	// Callers are authenticated by the interceptor, and requests are made
+	// with its own credentials impersonating them
+	authModeImpersonate authMode = "impersonate"
+)
+
+func (m *authMode) String() string {
+	return string(*m)
+}
+
+func (m *authMode) Set(value string) error {
+	switch authMode(value) {
+	case authModeKubeconfig, authModePassthrough, authModeImpersonate:
+		*m = authMode(value)
+		return nil
+	}
+	return fmt.Errorf("unknown auth mode %q, expected one of %s, %s or %s", value, authModeKubeconfig, authModePassthrough, authModeImpersonate)
+}
+
+// newTransport returns the transport requests are forwarded upstream with
+func newTransport(config *rest.Config, mode authMode) (http.RoundTripper, error) {
+	if mode == authModePassthrough {
+		// Trust the apiserver, but leave credentials to the caller
+		config = rest.AnonymousClientConfig(config)
+	}
+	return rest.TransportFor(config)
+}
+
+// newAuthenticator authenticates callers by client certificates signed by
+// the CA in clientCAFile, if set, and by bearer tokens using
+// TokenReviews
+func newAuthenticator(config *rest.Config, clientCAFile string) (authenticator.Request, error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	authenticatorConfig := authenticatorfactory.DelegatingAuthenticatorConfig{
+		TokenAccessReviewClient:  client.AuthenticationV1(),
+		TokenAccessReviewTimeout: 10 * time.Second,
+		WebhookRetryBackoff:      options.DefaultAuthWebhookRetryBackoff(),
+		CacheTTL:                 2 * time.Minute,
+	}
+	if len(clientCAFile) > 0 {
+		authenticatorConfig.ClientCertificateCAContentProvider, err = dynamiccertificates.NewDynamicCAContentFromFile("client-ca", clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	auth, _, err := authenticatorConfig.New()
+	return auth, err
+}
+
+// withCredentials prepares requests to be forwarded with the credentials
+// mode calls for. auth is only used to impersonate callers.
+func withCredentials(handler http.Handler, mode authMode, auth authenticator.Request) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch mode {
+		case authModeKubeconfig:
+			r.Header.Del("Authorization")
+
+		case authModePassthrough:
+			if len(r.Header.Get("Authorization")) == 0 && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+				writeStatus(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "client certificates can't be passed through to the apiserver, use a bearer token or impersonation")
+				return
+			}
+
+		case authModeImpersonate:
+			for header := range r.Header {
+				if strings.HasPrefix(header, "Impersonate-") {
+					writeStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden, "impersonation by callers is not supported when the interceptor impersonates them")
+					return
+				}
+			}
+			response, ok, err := auth.AuthenticateRequest(r)
+			if err != nil || !ok {
+				writeStatus(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "Unauthorized")
+				return
+			}
+			r.Header.Del("Authorization")
+			impersonate(r.Header, response.User)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// impersonate sets the headers which make the apiserver treat a request as
+// made by info
+func impersonate(header http.Header, info user.Info) {
+	header.Set(transport.ImpersonateUserHeader, info.GetName())
+	if uid := info.GetUID(); len(uid) > 0 {
+		header.Set(transport.ImpersonateUIDHeader, uid)
+	}
+	for _, group := range info.GetGroups() {
+		// Added by the apiserver to every impersonated user, without
+		// needing permission to impersonate it
+		if group == user.AllAuthenticated {
+			continue
+		}
+		header.Add(transport.ImpersonateGroupHeader, group)
+	}
+	for key, values := range info.GetExtra() {
+		for _, value := range values {
+			header.Add(transport.ImpersonateUserExtraHeaderPrefix+url.PathEscape(key), value)
+		}
+	}
+}
+
+// writeStatus fails a request the way the apiserver would
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(&metav1.Status{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+		Status:   metav1.StatusFailure,
+		Code:     int32(code),
+		Reason:   reason,
+		Message:  message,
+	})
+}
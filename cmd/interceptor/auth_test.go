@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestWithCredentials(t *testing.T) {
+	// Authenticates the token "alice"
+	auth := authenticator.RequestFunc(func(r *http.Request) (*authenticator.Response, bool, error) {
+		if r.Header.Get("Authorization") != "Bearer alice" {
+			return nil, false, nil
+		}
+		return &authenticator.Response{User: &user.DefaultInfo{
+			Name:   "alice",
+			UID:    "1234",
+			Groups: []string{"developers", user.AllAuthenticated},
+			Extra:  map[string][]string{"example.com/team": {"a", "b"}},
+		}}, true, nil
+	})
+
+	for _, testCase := range []struct {
+		name   string
+		mode   authMode
+		header http.Header
+
+		// Expected response code, and headers the apiserver receives
+		code     int
+		upstream http.Header
+	}{
+		{
+			name:     "kubeconfig",
+			mode:     authModeKubeconfig,
+			header:   http.Header{"Authorization": {"Bearer alice"}},
+			code:     http.StatusOK,
+			upstream: http.Header{},
+		},
+		{
+			name:     "passthrough",
+			mode:     authModePassthrough,
+			header:   http.Header{"Authorization": {"Bearer alice"}, "Impersonate-User": {"bob"}},
+			code:     http.StatusOK,
+			upstream: http.Header{"Authorization": {"Bearer alice"}, "Impersonate-User": {"bob"}},
+		},
+		{
+			name:   "impersonate",
+			mode:   authModeImpersonate,
+			header: http.Header{"Authorization": {"Bearer alice"}},
+			code:   http.StatusOK,
+			upstream: http.Header{
+				"Impersonate-User":  {"alice"},
+				"Impersonate-Uid":   {"1234"},
+				"Impersonate-Group": {"developers"},
+				http.CanonicalHeaderKey("Impersonate-Extra-" + url.PathEscape("example.com/team")): {"a", "b"},
+			},
+		},
+		{
+			name:   "impersonate unauthenticated",
+			mode:   authModeImpersonate,
+			header: http.Header{"Authorization": {"Bearer mallory"}},
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "impersonate caller impersonating",
+			mode:   authModeImpersonate,
+			header: http.Header{"Authorization": {"Bearer alice"}, "Impersonate-User": {"bob"}},
+			code:   http.StatusForbidden,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			upstream := newFakeAPIServer(t)
+			upstream.documents = map[string]string{"/api": `{}`}
+			u, err := url.Parse(upstream.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := newMappings(defaultMappings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proxy := httptest.NewServer(withCredentials(newProxy(u, http.DefaultTransport, m), testCase.mode, auth))
+			t.Cleanup(proxy.Close)
+
+			request, err := http.NewRequest(http.MethodGet, proxy.URL+"/api", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request.Header = testCase.header
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+
+			if response.StatusCode != testCase.code {
+				t.Errorf("expected code %d, got %d", testCase.code, response.StatusCode)
+			}
+			if testCase.upstream == nil {
+				if upstream.header != nil {
+					t.Errorf("expected the request not to be forwarded")
+				}
+				return
+			}
+			credentials := http.Header{}
+			for header, values := range upstream.header {
+				if header == "Authorization" || strings.HasPrefix(header, "Impersonate-") {
+					credentials[header] = values
+				}
+			}
+			if !reflect.DeepEqual(credentials, testCase.upstream) {
+				t.Errorf("expected credentials %v, got %v", testCase.upstream, credentials)
+			}
+		})
+	}
+}
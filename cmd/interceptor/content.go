@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	jsonserializer "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+const protobufContentType = "application/vnd.kubernetes.protobuf"
+
+// The CRDs are only served as JSON, so protobuf is transcoded to and from
+// the native types
+var (
+	transcodingScheme  = runtime.NewScheme()
+	jsonSerializer     = jsonserializer.NewSerializerWithOptions(jsonserializer.DefaultMetaFactory, transcodingScheme, transcodingScheme, jsonserializer.SerializerOptions{})
+	protobufSerializer = protobuf.NewSerializer(transcodingScheme, transcodingScheme)
+	protobufRawEncoder = protobuf.NewRawSerializer(transcodingScheme, transcodingScheme)
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(transcodingScheme))
+	utilruntime.Must(metav1.AddMetaToScheme(transcodingScheme))
+}
+
+// negotiation is what a client accepts in response to a redirected request
+type negotiation struct {
+	// The client only accepts protobuf, so responses are requested as JSON
+	// and transcoded
+	protobuf bool
+
+	// The client asked for a Table
+	table bool
+}
+
+// negotiate returns what the client accepts, and the Accept header to send
+// upstream. The client's header is kept unless it only accepts protobuf,
+// which is transcoded if gv is a group version the interceptor knows the
+// types of.
+func negotiate(accept string, gv schema.GroupVersion) (negotiation, string) {
+	var result negotiation
+	clauses := strings.Split(accept, ",")
+	var acceptsJSON, acceptsProtobuf bool
+	for _, clause := range clauses {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(clause))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			acceptsJSON = true
+		case protobufContentType:
+			acceptsProtobuf = true
+		}
+		if params["as"] == "Table" {
+			result.table = true
+		}
+	}
+	if acceptsJSON || !acceptsProtobuf || !transcodingScheme.IsVersionRegistered(gv) {
+		return result, accept
+	}
+
+	result.protobuf = true
+	for i, clause := range clauses {
+		clauses[i] = strings.Replace(strings.TrimSpace(clause), protobufContentType, "application/json", 1)
+	}
+	return result, strings.Join(clauses, ",")
+}
+
+// protobufToJSON transcodes a protobuf request body to JSON
+func protobufToJSON(body io.ReadCloser) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		if err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+		obj, _, err := protobufSerializer.Decode(data, nil, nil)
+		if err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+		writer.CloseWithError(jsonSerializer.Encode(obj, writer))
+	}()
+	return reader
+}
+
+// encodeProtobuf encodes a decoded JSON object as protobuf
+func encodeProtobuf(value interface{}, out *bytes.Buffer) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	obj, _, err := jsonSerializer.Decode(data, nil, nil)
+	if err != nil {
+		return err
+	}
+	return protobufSerializer.Encode(obj, out)
+}
+
+// encodeProtobufEvent encodes a decoded JSON watch event as a protobuf
+// watch stream frame
+func encodeProtobufEvent(value interface{}, out *bytes.Buffer) error {
+	event, _ := value.(map[string]interface{})
+	eventType, _ := event["type"].(string)
+	object := &bytes.Buffer{}
+	if err := encodeProtobuf(event["object"], object); err != nil {
+		return err
+	}
+	frame := &bytes.Buffer{}
+	if err := protobufRawEncoder.Encode(&metav1.WatchEvent{Type: eventType, Object: runtime.RawExtension{Raw: object.Bytes()}}, frame); err != nil {
+		return err
+	}
+	_, err := protobuf.LengthDelimitedFramer.NewFrameWriter(out).Write(frame.Bytes())
+	return err
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"k8s.io/api/admissionregistration/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+)
+
+func TestProxyTable(t *testing.T) {
+	const tableAccept = "application/json;as=Table;v=v1;g=meta.k8s.io,application/json"
+	crdTable := `{"kind":"Table","apiVersion":"meta.k8s.io/v1","metadata":{"resourceVersion":"1"},` +
+		`"columnDefinitions":[{"name":"Name","type":"string","format":"name","description":"name","priority":0},{"name":"Age","type":"date","format":"","description":"age","priority":0}],` +
+		`"rows":[` +
+		`{"cells":["a","5m"],"object":{"apiVersion":"` + crdGroupVersion + `","kind":"ValidatingAdmissionPolicy","metadata":{"name":"a"},"spec":{"paramKind":{"apiVersion":"v1","kind":"ConfigMap"},"validations":[{"expression":"true"},{"expression":"false"}]}}},` +
+		`{"cells":["b","1h"],"object":{"apiVersion":"` + crdGroupVersion + `","kind":"ValidatingAdmissionPolicy","metadata":{"name":"b"},"spec":{}}}]}`
+	nativeTable := func(objects ...string) string {
+		return `{"kind":"Table","apiVersion":"meta.k8s.io/v1","metadata":{"resourceVersion":"1"},` +
+			`"columnDefinitions":[{"name":"Name","type":"string","format":"name","description":"name","priority":0},` +
+			`{"name":"Validations","type":"integer","format":"","description":"Validations indicates the number of validation rules defined in this configuration","priority":0},` +
+			`{"name":"ParamKind","type":"string","format":"","description":"ParamKind specifies the kind of resources used to parameterize this policy","priority":0},` +
+			`{"name":"Age","type":"date","format":"","description":"age","priority":0}],` +
+			`"rows":[{"cells":["a",2,"v1/ConfigMap","5m"]` + objects[0] + `},{"cells":["b",0,"<unset>","1h"]` + objects[1] + `}]}`
+	}
+
+	for _, testCase := range []struct {
+		name          string
+		includeObject string
+		expected      string
+	}{
+		{
+			name: "metadata",
+			expected: nativeTable(
+				`,"object":{"apiVersion":"meta.k8s.io/v1","kind":"PartialObjectMetadata","metadata":{"name":"a"}}`,
+				`,"object":{"apiVersion":"meta.k8s.io/v1","kind":"PartialObjectMetadata","metadata":{"name":"b"}}`,
+			),
+		},
+		{
+			name:          "none",
+			includeObject: "None",
+			expected:      nativeTable("", ""),
+		},
+		{
+			name:          "object",
+			includeObject: "Object",
+			expected: nativeTable(
+				`,"object":{"apiVersion":"`+nativeGroupVersion+`","kind":"ValidatingAdmissionPolicy","metadata":{"name":"a"},"spec":{"paramKind":{"apiVersion":"v1","kind":"ConfigMap"},"validations":[{"expression":"true"},{"expression":"false"}]}}`,
+				`,"object":{"apiVersion":"`+nativeGroupVersion+`","kind":"ValidatingAdmissionPolicy","metadata":{"name":"b"},"spec":{}}`,
+			),
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			upstream := newFakeAPIServer(t)
+			upstream.documents = map[string]string{policiesPath: crdTable}
+			u := newTestProxy(t, upstream)
+			if len(testCase.includeObject) > 0 {
+				u += "?includeObject=" + testCase.includeObject
+			}
+			request, err := http.NewRequest(http.MethodGet, u, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request.Header.Set("Accept", tableAccept)
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			body, err := io.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if accept := upstream.header.Get("Accept"); accept != tableAccept {
+				t.Errorf("expected Accept %q upstream, got %q", tableAccept, accept)
+			}
+			if !strings.Contains(upstream.uri, "includeObject=Object") {
+				t.Errorf("expected whole objects to be requested, got %s", upstream.uri)
+			}
+			expectJSON(t, testCase.expected, string(body))
+		})
+	}
+}
+
+func TestProxyTableWatch(t *testing.T) {
+	row := func(name, apiVersion string) string {
+		return `{"cells":["` + name + `","5m"],"object":{"apiVersion":"` + apiVersion + `","kind":"ValidatingAdmissionPolicy","metadata":{"name":"` + name + `"},"spec":{"validations":[{"expression":"true"}]}}}`
+	}
+	// Tables after the first have no headers
+	crdEvent := func(eventType, columns, name string) string {
+		return `{"type":"` + eventType + `","object":{"kind":"Table","apiVersion":"meta.k8s.io/v1","metadata":{},"columnDefinitions":` + columns + `,"rows":[` + row(name, crdGroupVersion) + `]}}` + "\n"
+	}
+	const crdColumns = `[{"name":"Name","type":"string","format":"name","description":"name","priority":0},{"name":"Age","type":"date","format":"","description":"age","priority":0}]`
+	upstream := newFakeAPIServer(t,
+		crdEvent("ADDED", crdColumns, "a"),
+		crdEvent("ADDED", "null", "b"),
+	)
+
+	request, err := http.NewRequest(http.MethodGet, newTestProxy(t, upstream)+"?watch=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Accept", "application/json;as=Table;v=v1;g=meta.k8s.io")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	nativeColumns := `[{"name":"Name","type":"string","format":"name","description":"name","priority":0},` +
+		`{"name":"Validations","type":"integer","format":"","description":"Validations indicates the number of validation rules defined in this configuration","priority":0},` +
+		`{"name":"ParamKind","type":"string","format":"","description":"ParamKind specifies the kind of resources used to parameterize this policy","priority":0},` +
+		`{"name":"Age","type":"date","format":"","description":"age","priority":0}]`
+	nativeEvent := func(columns, name string) string {
+		return `{"type":"ADDED","object":{"kind":"Table","apiVersion":"meta.k8s.io/v1","metadata":{},"columnDefinitions":` + columns + `,"rows":[` +
+			`{"cells":["` + name + `",1,"<unset>","5m"],"object":{"apiVersion":"meta.k8s.io/v1","kind":"PartialObjectMetadata","metadata":{"name":"` + name + `"}}}]}}`
+	}
+
+	decoder := json.NewDecoder(response.Body)
+	for _, expected := range []string{nativeEvent(nativeColumns, "a"), nativeEvent("null", "b")} {
+		var event json.RawMessage
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		expectJSON(t, expected, string(event))
+	}
+}
+
+func TestProxyProtobuf(t *testing.T) {
+	decode := func(t *testing.T, data []byte) *v1alpha1.ValidatingAdmissionPolicy {
+		t.Helper()
+		obj, _, err := protobufSerializer.Decode(data, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		policy, ok := obj.(*v1alpha1.ValidatingAdmissionPolicy)
+		if !ok {
+			t.Fatalf("expected a ValidatingAdmissionPolicy, got %T", obj)
+		}
+		return policy
+	}
+	get := func(t *testing.T, u, accept string) *http.Response {
+		t.Helper()
+		request, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Accept", accept)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		return response
+	}
+
+	t.Run("protobuf or JSON", func(t *testing.T) {
+		upstream := newFakeAPIServer(t, policy(crdGroupVersion, "a"))
+		response := get(t, newTestProxy(t, upstream), "application/vnd.kubernetes.protobuf, */*")
+		if accept := upstream.header.Get("Accept"); accept != "application/vnd.kubernetes.protobuf, */*" {
+			t.Errorf("expected the Accept header to be kept, got %q", accept)
+		}
+		if contentType := response.Header.Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("expected JSON, got %q", contentType)
+		}
+	})
+
+	t.Run("protobuf only", func(t *testing.T) {
+		upstream := newFakeAPIServer(t, policy(crdGroupVersion, "a"))
+		response := get(t, newTestProxy(t, upstream), "application/vnd.kubernetes.protobuf")
+		if accept := upstream.header.Get("Accept"); accept != "application/json" {
+			t.Errorf("expected JSON to be requested upstream, got %q", accept)
+		}
+		if contentType := response.Header.Get("Content-Type"); contentType != protobufContentType {
+			t.Errorf("expected protobuf, got %q", contentType)
+		}
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := decode(t, body); p.Name != "a" || p.Spec.Validations[0].Message != crdGroupVersion+" is not "+nativeGroupVersion {
+			t.Errorf("unexpected policy %+v", p)
+		}
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		upstream := newFakeAPIServer(t, `{"type":"ADDED","object":`+policy(crdGroupVersion, "a")+`}`, `{"type":"DELETED","object":`+policy(crdGroupVersion, "b")+`}`)
+		response := get(t, newTestProxy(t, upstream)+"?watch=true", "application/vnd.kubernetes.protobuf;stream=watch")
+		if contentType := response.Header.Get("Content-Type"); contentType != protobufContentType+";stream=watch" {
+			t.Errorf("expected a protobuf watch, got %q", contentType)
+		}
+
+		frames := protobuf.LengthDelimitedFramer.NewFrameReader(response.Body)
+		decoder := protobuf.NewRawSerializer(transcodingScheme, transcodingScheme)
+		for _, expected := range []struct{ eventType, name string }{{"ADDED", "a"}, {"DELETED", "b"}} {
+			frame := make([]byte, 64*1024)
+			n, err := frames.Read(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			event := &metav1.WatchEvent{}
+			if _, _, err := decoder.Decode(frame[:n], nil, event); err != nil {
+				t.Fatal(err)
+			}
+			if p := decode(t, event.Object.Raw); event.Type != expected.eventType || p.Name != expected.name {
+				t.Errorf("expected %s of %s, got %s of %s", expected.eventType, expected.name, event.Type, p.Name)
+			}
+		}
+	})
+
+	t.Run("protobuf request", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		err := protobufSerializer.Encode(&v1alpha1.ValidatingAdmissionPolicy{
+			TypeMeta:   metav1.TypeMeta{APIVersion: nativeGroupVersion, Kind: "ValidatingAdmissionPolicy"},
+			ObjectMeta: metav1.ObjectMeta{Name: "a"},
+			Spec: v1alpha1.ValidatingAdmissionPolicySpec{
+				Validations: []v1alpha1.Validation{{Expression: "true"}},
+			},
+		}, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		upstream := newFakeAPIServer(t)
+		u, err := url.Parse(newTestProxy(t, upstream))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request, err := http.NewRequest(http.MethodPost, u.String(), body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", protobufContentType)
+		request.Header.Set("Accept", protobufContentType)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		data, err := io.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expectJSON(t, `{"apiVersion":"`+crdGroupVersion+`","kind":"ValidatingAdmissionPolicy","metadata":{"name":"a","creationTimestamp":null},"spec":{"validations":[{"expression":"true"}]},"status":{}}`, upstream.received)
+		if p := decode(t, data); p.Name != "a" || p.Spec.Validations[0].Expression != "true" {
+			t.Errorf("unexpected policy %+v", p)
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// discoveryRewrite returns how to merge the native resources into the
+// response to a discovery or OpenAPI request for path, or nil if the
+// response is left alone. The native resources and their schemas are those
+// the apiserver publishes for the CRDs, which requests for the native
+// resources are redirected to.
+func (m *mappings) discoveryRewrite(path string) func(value interface{}) {
+	switch path {
+	case "/apis":
+		return m.mergeGroupList
+	case "/openapi/v3":
+		return m.mergeOpenAPIIndex
+	}
+	if group, ok := strings.CutPrefix(path, "/apis/"); ok && !strings.Contains(group, "/") {
+		for _, gv := range m.nativeGroupVersions() {
+			if gv.Group == group {
+				return m.mergeGroup
+			}
+		}
+	}
+	return nil
+}
+
+// mergeGroupList adds the native group versions to /apis, in either its
+// legacy or aggregated form
+func (m *mappings) mergeGroupList(value interface{}) {
+	list, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	switch list["kind"] {
+	case "APIGroupList":
+		for _, gv := range m.nativeGroupVersions() {
+			group := findByName(list["groups"], gv.Group, func(group map[string]interface{}) interface{} {
+				return group["name"]
+			})
+			if group == nil {
+				version := groupVersionForDiscovery(gv)
+				list["groups"] = append(items(list["groups"]), map[string]interface{}{
+					"name":             gv.Group,
+					"versions":         []interface{}{version},
+					"preferredVersion": version,
+				})
+				continue
+			}
+			addVersion(group, gv)
+		}
+
+	case "APIGroupDiscoveryList":
+		for _, gv := range m.nativeGroupVersions() {
+			m.mergeAggregatedGroupVersion(list, gv)
+		}
+	}
+}
+
+// mergeAggregatedGroupVersion adds a native group version to aggregated
+// discovery, with the resources of the CRD group version it is redirected to
+func (m *mappings) mergeAggregatedGroupVersion(list map[string]interface{}, gv schema.GroupVersion) {
+	crdGV := m.toCRD.groupVersions[gv]
+	crdGroup := findByName(list["items"], crdGV.Group, name)
+	if crdGroup == nil {
+		// The CRDs aren't installed, so there's nothing to serve
+		return
+	}
+	crdVersion := findByName(crdGroup["versions"], crdGV.Version, func(version map[string]interface{}) interface{} {
+		return version["version"]
+	})
+	if crdVersion == nil {
+		return
+	}
+
+	version := shallowCopy(crdVersion)
+	version["version"] = gv.Version
+	var resources []interface{}
+	for _, crdResource := range objects(crdVersion["resources"]) {
+		name, _ := crdResource["resource"].(string)
+		native, ok := m.toNative.resources[crdGV.WithResource(name)]
+		if !ok {
+			continue
+		}
+		resource := shallowCopy(crdResource)
+		resource["resource"] = native.Resource
+		resource["responseKind"] = m.toNative.kind(crdResource["responseKind"])
+		var subresources []interface{}
+		for _, crdSubresource := range objects(crdResource["subresources"]) {
+			subresource := shallowCopy(crdSubresource)
+			subresource["responseKind"] = m.toNative.kind(crdSubresource["responseKind"])
+			subresources = append(subresources, subresource)
+		}
+		if subresources != nil {
+			resource["subresources"] = subresources
+		}
+		resources = append(resources, resource)
+	}
+	version["resources"] = resources
+
+	group := findByName(list["items"], gv.Group, name)
+	if group == nil {
+		list["items"] = append(items(list["items"]), map[string]interface{}{
+			"metadata": map[string]interface{}{"name": gv.Group},
+			"versions": []interface{}{version},
+		})
+		return
+	}
+	versions := items(group["versions"])
+	for i, existing := range objects(versions) {
+		if existing["version"] == gv.Version {
+			versions[i] = version
+			return
+		}
+	}
+	group["versions"] = append(versions, version)
+}
+
+// mergeGroup adds the native versions of a group to /apis/<group>
+func (m *mappings) mergeGroup(value interface{}) {
+	group, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, gv := range m.nativeGroupVersions() {
+		if gv.Group == group["name"] {
+			addVersion(group, gv)
+		}
+	}
+}
+
+// mergeOpenAPIIndex lists the native group versions in /openapi/v3, served
+// by the documents for the CRDs
+func (m *mappings) mergeOpenAPIIndex(value interface{}) {
+	index, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	paths, ok := index["paths"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, gv := range m.nativeGroupVersions() {
+		crdGV := m.toCRD.groupVersions[gv]
+		crdPath, ok := paths["apis/"+crdGV.String()].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		url, _ := crdPath["serverRelativeURL"].(string)
+		paths["apis/"+gv.String()] = map[string]interface{}{
+			"serverRelativeURL": strings.Replace(url, "/apis/"+crdGV.String(), "/apis/"+gv.String(), 1),
+		}
+	}
+}
+
+// openAPI rewrites an OpenAPI v3 document for a group version
+func (r rewriter) openAPI(value interface{}) {
+	document, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if paths, ok := document["paths"].(map[string]interface{}); ok {
+		for path, item := range paths {
+			if rewritten, _, ok := r.path(path); ok {
+				delete(paths, path)
+				paths[rewritten] = item
+			}
+		}
+	}
+	r.groupVersionKinds(document)
+}
+
+// groupVersionKinds rewrites the group version of every
+// x-kubernetes-group-version-kind extension within value
+func (r rewriter) groupVersionKinds(value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			if k != "x-kubernetes-group-version-kind" {
+				r.groupVersionKinds(v)
+				continue
+			}
+			gvks := objects(v)
+			if gvk, ok := v.(map[string]interface{}); ok {
+				gvks = append(gvks, gvk)
+			}
+			for _, gvk := range gvks {
+				group, _ := gvk["group"].(string)
+				version, _ := gvk["version"].(string)
+				if to, ok := r.groupVersions[schema.GroupVersion{Group: group, Version: version}]; ok {
+					gvk["group"], gvk["version"] = to.Group, to.Version
+				}
+			}
+		}
+	case []interface{}:
+		for _, v := range value {
+			r.groupVersionKinds(v)
+		}
+	}
+}
+
+// kind returns a rewritten copy of an aggregated discovery responseKind. An
+// empty group and version refer to those of the resource.
+func (r rewriter) kind(value interface{}) interface{} {
+	kind, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	group, _ := kind["group"].(string)
+	version, _ := kind["version"].(string)
+	to, ok := r.groupVersions[schema.GroupVersion{Group: group, Version: version}]
+	if !ok {
+		return value
+	}
+	kind = shallowCopy(kind)
+	kind["group"], kind["version"] = to.Group, to.Version
+	return kind
+}
+
+func addVersion(group map[string]interface{}, gv schema.GroupVersion) {
+	for _, version := range objects(group["versions"]) {
+		if version["groupVersion"] == gv.String() {
+			return
+		}
+	}
+	group["versions"] = append(items(group["versions"]), groupVersionForDiscovery(gv))
+}
+
+func groupVersionForDiscovery(gv schema.GroupVersion) map[string]interface{} {
+	return map[string]interface{}{
+		"groupVersion": gv.String(),
+		"version":      gv.Version,
+	}
+}
+
+// findByName returns the object in list for which key returns name
+func findByName(list interface{}, name string, key func(map[string]interface{}) interface{}) map[string]interface{} {
+	for _, obj := range objects(list) {
+		if key(obj) == name {
+			return obj
+		}
+	}
+	return nil
+}
+
+func name(obj map[string]interface{}) interface{} {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	return metadata["name"]
+}
+
+func items(value interface{}) []interface{} {
+	values, _ := value.([]interface{})
+	return values
+}
+
+func shallowCopy(obj map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"k8s.io/cel-admission-webhook/pkg/pki"
+)
+
+// runInit serves the proxy on a loopback port, with a new CA and serving
+// certificate, and points a kubeconfig context at it. Only clients with the
+// certificate the CA issues for the context are served, since the proxy may
+// forward requests with the credentials of the source context.
+func runInit(args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	var addr, contextName, fromContext string
+	var options proxyOptions
+	flags.StringVar(&addr, "addr", "127.0.0.1:0", "Loopback address to listen on. A free port is chosen if the port is 0.")
+	flags.StringVar(&contextName, "context-name", "polyfill", "Name of the kubeconfig context, and its cluster and user, to write.")
+	flags.StringVar(&fromContext, "from-context", "", "Kubeconfig context of the cluster to proxy. Defaults to the current context.")
+	options.addFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s init [-context-name NAME] [-from-context NAME]\n\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Serves the interceptor on a loopback port, and writes a kubeconfig context pointing kubectl at it.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	kubeconfig, err := loadingRules.GetStartingConfig()
+	if err != nil {
+		return err
+	}
+	if len(fromContext) == 0 {
+		fromContext = kubeconfig.CurrentContext
+	}
+	if fromContext == contextName {
+		return fmt.Errorf("the %q context would proxy itself, choose the context of a cluster with -from-context", contextName)
+	}
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: fromContext}).ClientConfig()
+	if err != nil {
+		return err
+	}
+	handler, err := newHandler(config, options)
+	if err != nil {
+		return err
+	}
+
+	ca, err := pki.GenerateCA(&pki.CAConfig{CommonName: "cel-admission-polyfill interceptor"})
+	if err != nil {
+		return err
+	}
+	httpServer, err := newInitServer(handler, ca)
+	if err != nil {
+		return err
+	}
+	client, err := ca.CreateCertificate(clientCommonName, pki.DefaultExpiry)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	if ip := listener.Addr().(*net.TCPAddr).IP; !ip.IsLoopback() {
+		return fmt.Errorf("%s is not a loopback address", addr)
+	}
+	server := fmt.Sprintf("https://localhost:%d", listener.Addr().(*net.TCPAddr).Port)
+
+	if err := writeContext(loadingRules, contextName, fromContext, server, ca, client, options.mode); err != nil {
+		return err
+	}
+	fmt.Printf("Serving %s as context %q, e.g. kubectl --context=%s get validatingadmissionpolicies\n", server, contextName, contextName)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+	if err := httpServer.ServeTLS(listener, "", ""); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// newInitServer serves handler with a localhost certificate issued by ca,
+// to clients with certificates issued by ca
+func newInitServer(handler http.Handler, ca *pki.CertificateKeyPair) (*http.Server, error) {
+	serving, err := ca.CreateCertificate("localhost", pki.DefaultExpiry)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := tls.X509KeyPair(serving.CertificatePem, serving.PrivateKeyPem)
+	if err != nil {
+		return nil, err
+	}
+
+	server := newServer(handler)
+	server.TLSConfig.Certificates = []tls.Certificate{certificate}
+	server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	server.TLSConfig.ClientCAs = pki.NewCertPoolFromCA(ca.Certificate)
+	return server, nil
+}
+
+// Common name of the client certificate written to the kubeconfig
+const clientCommonName = "cel-admission-polyfill-client"
+
+// writeContext adds a context, cluster and user named contextName to the
+// kubeconfig, for the server trusted by ca, using the namespace of
+// fromContext. The user authenticates to the server with the client
+// certificate. Unless the server forwards requests with its own kubeconfig
+// credentials, the user also keeps the other credentials of the user of
+// fromContext, for the server to pass through or authenticate. That user must
+// then have a token or exec credentials, since the server can not forward or
+// verify its client certificate.
+func writeContext(configAccess clientcmd.ConfigAccess, contextName, fromContext, server string, ca, client *pki.CertificateKeyPair, mode authMode) error {
+	kubeconfig, err := configAccess.GetStartingConfig()
+	if err != nil {
+		return err
+	}
+	from, ok := kubeconfig.Contexts[fromContext]
+	if !ok {
+		return fmt.Errorf("context %q not found in kubeconfig", fromContext)
+	}
+
+	cluster := clientcmdapi.NewCluster()
+	cluster.Server = server
+	cluster.CertificateAuthorityData = ca.CertificatePem
+	kubeconfig.Clusters[contextName] = cluster
+
+	authInfo := clientcmdapi.NewAuthInfo()
+	if mode != authModeKubeconfig {
+		fromAuthInfo, ok := kubeconfig.AuthInfos[from.AuthInfo]
+		if !ok {
+			return fmt.Errorf("user %q of context %q not found in kubeconfig", from.AuthInfo, fromContext)
+		}
+		// The server only accepts the client certificate it issued, so
+		// the caller's identity must come from other credentials
+		if len(fromAuthInfo.Token) == 0 && len(fromAuthInfo.TokenFile) == 0 && fromAuthInfo.Exec == nil && fromAuthInfo.AuthProvider == nil {
+			return fmt.Errorf("user %q of context %q has no token or exec credentials for -auth-mode=%s to use, since client certificates can't be forwarded. Use -auth-mode=%s to forward requests with the credentials of the context instead", from.AuthInfo, fromContext, mode, authModeKubeconfig)
+		}
+		authInfo = fromAuthInfo.DeepCopy()
+		authInfo.ClientCertificate = ""
+		authInfo.ClientKey = ""
+	}
+	authInfo.ClientCertificateData = client.CertificatePem
+	authInfo.ClientKeyData = client.PrivateKeyPem
+	kubeconfig.AuthInfos[contextName] = authInfo
+
+	kubeContext := clientcmdapi.NewContext()
+	kubeContext.Cluster = contextName
+	kubeContext.AuthInfo = contextName
+	kubeContext.Namespace = from.Namespace
+	kubeconfig.Contexts[contextName] = kubeContext
+
+	return clientcmd.ModifyConfig(configAccess, *kubeconfig, true)
+}
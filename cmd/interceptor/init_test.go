@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+
+	"k8s.io/cel-admission-webhook/pkg/pki"
+)
+
+func TestWriteContext(t *testing.T) {
+	const kubeconfig = `
+apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev-user
+    namespace: team
+- name: kind
+  context:
+    cluster: dev
+    user: kind-user
+users:
+- name: kind-user
+  user:
+    client-certificate-data: Y2VydA==
+    client-key-data: a2V5
+- name: dev-user
+  user:
+    token: secret
+`
+
+	ca := &pki.CertificateKeyPair{CertificatePem: []byte("ca")}
+	client := &pki.CertificateKeyPair{CertificatePem: []byte("cert"), PrivateKeyPem: []byte("key")}
+
+	for _, testCase := range []struct {
+		name        string
+		fromContext string
+		mode        authMode
+		err         string
+
+		expectedToken string
+	}{
+		{
+			name:        "kubeconfig",
+			fromContext: "dev",
+			mode:        authModeKubeconfig,
+		},
+		{
+			name:          "passthrough",
+			fromContext:   "dev",
+			mode:          authModePassthrough,
+			expectedToken: "secret",
+		},
+		{
+			name:        "passthrough without token",
+			fromContext: "kind",
+			mode:        authModePassthrough,
+			err:         `user "kind-user" of context "kind" has no token or exec credentials`,
+		},
+		{
+			name:        "impersonate without token",
+			fromContext: "kind",
+			mode:        authModeImpersonate,
+			err:         `user "kind-user" of context "kind" has no token or exec credentials`,
+		},
+		{
+			name:        "missing context",
+			fromContext: "prod",
+			mode:        authModeKubeconfig,
+			err:         `context "prod" not found`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config")
+			if err := os.WriteFile(path, []byte(kubeconfig), 0600); err != nil {
+				t.Fatal(err)
+			}
+			configAccess := &clientcmd.ClientConfigLoadingRules{ExplicitPath: path}
+
+			err := writeContext(configAccess, "polyfill", testCase.fromContext, "https://localhost:1234", ca, client, testCase.mode)
+			if len(testCase.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), testCase.err) {
+					t.Fatalf("expected error containing %q, got %v", testCase.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			written, err := clientcmd.LoadFromFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written.CurrentContext != "dev" {
+				t.Errorf("expected the current context to be unchanged, got %q", written.CurrentContext)
+			}
+			context := written.Contexts["polyfill"]
+			if context == nil || context.Cluster != "polyfill" || context.AuthInfo != "polyfill" || context.Namespace != "team" {
+				t.Errorf("unexpected context %+v", context)
+			}
+			cluster := written.Clusters["polyfill"]
+			if cluster == nil || cluster.Server != "https://localhost:1234" || string(cluster.CertificateAuthorityData) != "ca" {
+				t.Errorf("unexpected cluster %+v", cluster)
+			}
+			authInfo := written.AuthInfos["polyfill"]
+			if authInfo == nil || string(authInfo.ClientCertificateData) != "cert" || string(authInfo.ClientKeyData) != "key" || authInfo.Token != testCase.expectedToken {
+				t.Errorf("unexpected user %+v", authInfo)
+			}
+			if written.Clusters["dev"].Server != "https://dev.example.com" {
+				t.Errorf("expected the dev cluster to be unchanged, got %+v", written.Clusters["dev"])
+			}
+			if written.AuthInfos["dev-user"].Token != "secret" {
+				t.Errorf("expected the dev user to be unchanged, got %+v", written.AuthInfos["dev-user"])
+			}
+		})
+	}
+}
+
+func TestInitServerClientCertificate(t *testing.T) {
+	ca, err := pki.GenerateCA(&pki.CAConfig{CommonName: "ca"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := pki.GenerateCA(&pki.CAConfig{CommonName: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := newInitServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+	url := fmt.Sprintf("https://localhost:%d/", listener.Addr().(*net.TCPAddr).Port)
+
+	for _, testCase := range []struct {
+		name     string
+		issuer   *pki.CertificateKeyPair
+		expectOK bool
+	}{
+		{
+			name: "no certificate",
+		},
+		{
+			name:   "certificate of another CA",
+			issuer: other,
+		},
+		{
+			name:     "certificate of the CA",
+			issuer:   ca,
+			expectOK: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			tlsConfig := &tls.Config{RootCAs: pki.NewCertPoolFromCA(ca.Certificate)}
+			if testCase.issuer != nil {
+				client, err := testCase.issuer.CreateCertificate(clientCommonName, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				certificate, err := tls.X509KeyPair(client.CertificatePem, client.PrivateKeyPem)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Present the certificate even if the server asks for
+				// another issuer, for the server to verify it
+				tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &certificate, nil
+				}
+			}
+
+			httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			response, err := httpClient.Get(url)
+			if err == nil {
+				response.Body.Close()
+			}
+			if (err == nil) != testCase.expectOK {
+				t.Errorf("expected the request to succeed to be %v, got %v", testCase.expectOK, err)
+			}
+		})
+	}
+}
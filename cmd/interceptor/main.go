@@ -1,102 +1,103 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"crypto/tls"
-	"crypto/x509"
 	"flag"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"os"
-	"strconv"
-	"strings"
 
+	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-func runServer(certFile, keyFile, addr string) error {
-	config, err := loadClientConfig()
+// proxyOptions configure the proxy however it is served
+type proxyOptions struct {
+	mode         authMode
+	clientCAFile string
+	mappingsFile string
+}
+
+func (o *proxyOptions) addFlags(flags *flag.FlagSet) {
+	o.mode = authModeKubeconfig
+	flags.Var(&o.mode, "auth-mode", "Whose credentials requests are forwarded with: kubeconfig forwards every request as the interceptor's own kubeconfig user, passthrough forwards callers' own bearer tokens, refusing callers with only client certificates, and impersonate authenticates callers and impersonates them.")
+	flags.StringVar(&o.clientCAFile, "client-ca-file", "", "Path to the CA bundle client certificates are verified with when impersonating callers. Callers can only authenticate with bearer tokens if unset.")
+	flags.StringVar(&o.mappingsFile, "mappings", "", "Path to a file mapping native resources to the CRDs which polyfill them. Defaults to the v1alpha1 ValidatingAdmissionPolicy resources.")
+}
+
+// newHandler returns the proxy to the apiserver of config
+func newHandler(config *rest.Config, options proxyOptions) (http.Handler, error) {
+	m, err := newMappings(defaultMappings)
+	if len(options.mappingsFile) > 0 {
+		m, err = loadMappings(options.mappingsFile)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	t, _ := config.TransportConfig()
 	u, err := url.Parse(config.Host)
 	if err != nil {
-		return err
-	}
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{},
+		return nil, err
 	}
-	if len(t.TLS.CAData) > 0 {
-		pool := x509.NewCertPool()
-		pool.AppendCertsFromPEM(t.TLS.CAData)
-		transport.TLSClientConfig.RootCAs = pool
+	transport, err := newTransport(config, options.mode)
+	if err != nil {
+		return nil, err
 	}
-	if len(t.TLS.CertData) > 0 && len(t.TLS.KeyData) > 0 {
-		cert, err := tls.X509KeyPair(t.TLS.CertData, t.TLS.KeyData)
+	var auth authenticator.Request
+	if options.mode == authModeImpersonate {
+		auth, err = newAuthenticator(config, options.clientCAFile)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
 	}
-	r := &httputil.ReverseProxy{
-		Transport: transport,
-		Rewrite: func(request *httputil.ProxyRequest) {
-			log.Printf("%6s %s", request.In.Method, request.In.URL)
-			request.SetURL(u)
-			if !strings.Contains(request.In.URL.Path, "admissionregistration.k8s.io/v1alpha1") {
-				return
-			}
-			reader, writer := io.Pipe()
-			request.Out.Body = reader
-			request.Out.URL.Path = strings.ReplaceAll(request.Out.URL.Path, "admissionregistration.k8s.io/v1alpha1", "admissionregistration.x-k8s.io/v1alpha1")
-			request.Out.URL.RawPath = strings.ReplaceAll(request.Out.URL.RawPath, "admissionregistration.k8s.io/v1alpha1", "admissionregistration.x-k8s.io/v1alpha1")
-			request.Out.Header.Set("Accept", "application/json")
-			request.Out.ContentLength = -1
-			go func() {
-				scanner := bufio.NewScanner(request.In.Body)
-				defer writer.Close()
-				for scanner.Scan() {
-					b := scanner.Bytes()
-					b = bytes.ReplaceAll(b, []byte("admissionregistration.k8s.io/v1alpha1"), []byte("admissionregistration.x-k8s.io/v1alpha1"))
-					_, _ = writer.Write(b)
-				}
-			}()
-		},
-		ModifyResponse: func(response *http.Response) error {
-			if !strings.Contains(response.Request.URL.Path, "admissionregistration.x-k8s.io/v1alpha1") {
-				return nil
-			}
-			b, err := io.ReadAll(response.Body)
-			_ = response.Body.Close()
-			b = bytes.ReplaceAll(b, []byte("admissionregistration.x-k8s.io/v1alpha1"), []byte("admissionregistration.k8s.io/v1alpha1"))
-			response.Body = io.NopCloser(bytes.NewReader(b))
-			response.ContentLength = int64(len(b))
-			response.Header.Set("Content-Length", strconv.Itoa(len(b)))
-			if err != nil {
-				return err
-			}
-			return nil
+	return withCredentials(newProxy(u, transport, m), options.mode, auth), nil
+}
+
+func newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler: handler,
+		TLSConfig: &tls.Config{
+			// Client certificates are verified by the authenticator, if at
+			// all
+			ClientAuth: tls.RequestClientCert,
 		},
 	}
-	return http.ListenAndServeTLS(addr, certFile, keyFile, r)
+}
+
+func runServer(certFile, keyFile, addr string, options proxyOptions) error {
+	config, err := loadClientConfig()
+	if err != nil {
+		return err
+	}
+	handler, err := newHandler(config, options)
+	if err != nil {
+		return err
+	}
+	server := newServer(handler)
+	server.Addr = addr
+	return server.ListenAndServeTLS(certFile, keyFile)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		if err := runInit(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var certFile string
 	var keyFile string
 	var addr string
+	var options proxyOptions
 	flag.StringVar(&certFile, "cert", "server.pem", "Path to TLS certificate file.")
 	flag.StringVar(&keyFile, "key", "server-key.pem", "Path to TLS key file.")
 	flag.StringVar(&addr, "addr", "0.0.0.0:8443", "Address to listen on")
+	options.addFlags(flag.CommandLine)
 	flag.Parse()
-	err := runServer(certFile, keyFile, addr)
+	err := runServer(certFile, keyFile, addr, options)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
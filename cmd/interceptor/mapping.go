@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// resource identifies an API resource in a mapping file
+type resource struct {
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+}
+
+func (r resource) groupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource}
+}
+
+// mapping redirects requests for a native API resource to the CRD which
+// polyfills it
+type mapping struct {
+	Native resource `json:"native"`
+	CRD    resource `json:"crd"`
+}
+
+// mappingFile is the format of the file passed to -mappings
+type mappingFile struct {
+	Mappings []mapping `json:"mappings"`
+}
+
+var defaultMappings = []mapping{
+	{
+		Native: resource{Group: "admissionregistration.k8s.io", Version: "v1alpha1", Resource: "validatingadmissionpolicies"},
+		CRD:    resource{Group: "admissionregistration.x-k8s.io", Version: "v1alpha1", Resource: "validatingadmissionpolicies"},
+	},
+	{
+		Native: resource{Group: "admissionregistration.k8s.io", Version: "v1alpha1", Resource: "validatingadmissionpolicybindings"},
+		CRD:    resource{Group: "admissionregistration.x-k8s.io", Version: "v1alpha1", Resource: "validatingadmissionpolicybindings"},
+	},
+}
+
+// mappings is a table of native resources redirected to CRDs, and the
+// rewriters translating between them
+type mappings struct {
+	resources []mapping
+
+	toCRD    rewriter
+	toNative rewriter
+}
+
+func loadMappings(path string) (*mappings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := mappingFile{}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return newMappings(file.Mappings)
+}
+
+// newMappings checks that resources can be translated both ways. Each
+// group version is only ever redirected to a single other group version, so
+// that apiVersions can be rewritten without knowing their resource.
+func newMappings(resources []mapping) (*mappings, error) {
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("no mappings")
+	}
+	m := &mappings{
+		resources: resources,
+		toCRD:     newRewriter(),
+		toNative:  newRewriter(),
+	}
+	for i, resource := range resources {
+		native, crd := resource.Native.groupVersionResource(), resource.CRD.groupVersionResource()
+		for _, gvr := range []schema.GroupVersionResource{native, crd} {
+			if len(gvr.Group) == 0 || len(gvr.Version) == 0 || len(gvr.Resource) == 0 {
+				return nil, fmt.Errorf("mappings[%d]: group, version and resource are required", i)
+			}
+		}
+		if err := m.toCRD.add(native, crd); err != nil {
+			return nil, fmt.Errorf("mappings[%d]: %w", i, err)
+		}
+		if err := m.toNative.add(crd, native); err != nil {
+			return nil, fmt.Errorf("mappings[%d]: %w", i, err)
+		}
+	}
+	return m, nil
+}
+
+// nativeGroupVersions returns each native group version once, in the order
+// they are mapped
+func (m *mappings) nativeGroupVersions() []schema.GroupVersion {
+	var result []schema.GroupVersion
+	seen := map[schema.GroupVersion]bool{}
+	for _, resource := range m.resources {
+		gv := resource.Native.groupVersionResource().GroupVersion()
+		if !seen[gv] {
+			seen[gv] = true
+			result = append(result, gv)
+		}
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadMappings(t *testing.T) {
+	for _, testCase := range []struct {
+		name string
+		file string
+		err  string
+	}{
+		{
+			name: "valid",
+			file: `
+mappings:
+- native: {group: admissionregistration.k8s.io, version: v1beta1, resource: validatingadmissionpolicies}
+  crd: {group: admissionregistration.x-k8s.io, version: v1beta1, resource: validatingadmissionpolicies}
+- native: {group: admissionregistration.k8s.io, version: v1beta1, resource: validatingadmissionpolicybindings}
+  crd: {group: admissionregistration.x-k8s.io, version: v1beta1, resource: validatingadmissionpolicybindings}
+`,
+		},
+		{
+			name: "empty",
+			file: `mappings: []`,
+			err:  "no mappings",
+		},
+		{
+			name: "unknown field",
+			file: `
+mappings:
+- native: {group: a.k8s.io, version: v1, resource: widgets, kind: Widget}
+  crd: {group: a.example.com, version: v1, resource: widgets}
+`,
+			err: "unknown field",
+		},
+		{
+			name: "missing resource",
+			file: `
+mappings:
+- native: {group: a.k8s.io, version: v1}
+  crd: {group: a.example.com, version: v1, resource: widgets}
+`,
+			err: "mappings[0]: group, version and resource are required",
+		},
+		{
+			name: "resource mapped twice",
+			file: `
+mappings:
+- native: {group: a.k8s.io, version: v1, resource: widgets}
+  crd: {group: a.example.com, version: v1, resource: widgets}
+- native: {group: a.k8s.io, version: v1, resource: widgets}
+  crd: {group: a.example.com, version: v1, resource: gadgets}
+`,
+			err: "mappings[1]: a.k8s.io/v1, Resource=widgets is already mapped",
+		},
+		{
+			name: "group version mapped to two group versions",
+			file: `
+mappings:
+- native: {group: a.k8s.io, version: v1, resource: widgets}
+  crd: {group: a.example.com, version: v1, resource: widgets}
+- native: {group: a.k8s.io, version: v1, resource: gadgets}
+  crd: {group: b.example.com, version: v1, resource: gadgets}
+`,
+			err: "mappings[1]: a.k8s.io/v1 is already mapped to a.example.com/v1",
+		},
+		{
+			name: "two group versions mapped to one",
+			file: `
+mappings:
+- native: {group: a.k8s.io, version: v1, resource: widgets}
+  crd: {group: a.example.com, version: v1, resource: widgets}
+- native: {group: b.k8s.io, version: v1, resource: gadgets}
+  crd: {group: a.example.com, version: v1, resource: gadgets}
+`,
+			err: "mappings[1]: a.example.com/v1 is already mapped to a.k8s.io/v1",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mappings.yaml")
+			if err := os.WriteFile(path, []byte(testCase.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadMappings(path)
+			if len(testCase.err) == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if len(testCase.err) > 0 && (err == nil || !strings.Contains(err.Error(), testCase.err)) {
+				t.Fatalf("expected error containing %q, got %v", testCase.err, err)
+			}
+		})
+	}
+}
+
+func TestProxyMappings(t *testing.T) {
+	resources := []mapping{
+		{
+			Native: resource{Group: "widgets.k8s.io", Version: "v1alpha1", Resource: "widgets"},
+			CRD:    resource{Group: "widgets.example.com", Version: "v1", Resource: "polyfilledwidgets"},
+		},
+	}
+	widget := func(apiVersion string) string {
+		return `{"apiVersion":"` + apiVersion + `","kind":"Widget","metadata":{"name":"a","namespace":"default"},"spec":{"note":"widgets.k8s.io/v1alpha1"}}`
+	}
+
+	for _, testCase := range []struct {
+		name string
+		path string
+
+		// Expected request URI received by the server
+		uri string
+	}{
+		{
+			name: "get",
+			path: "/apis/widgets.k8s.io/v1alpha1/namespaces/default/widgets/a",
+			uri:  "/apis/widgets.example.com/v1/namespaces/default/polyfilledwidgets/a",
+		},
+		{
+			name: "field selector",
+			path: "/apis/widgets.k8s.io/v1alpha1/widgets?fieldSelector=spec.ref%3Dwidgets.k8s.io%2Fv1alpha1",
+			uri:  "/apis/widgets.example.com/v1/polyfilledwidgets?fieldSelector=spec.ref%3Dwidgets.example.com%2Fv1",
+		},
+		{
+			name: "unmapped resource",
+			path: "/apis/widgets.k8s.io/v1alpha1/namespaces/default/gadgets/a",
+			uri:  "/apis/widgets.k8s.io/v1alpha1/namespaces/default/gadgets/a",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			upstream := newFakeAPIServer(t)
+			upstream.documents = map[string]string{
+				"/apis/widgets.example.com/v1/namespaces/default/polyfilledwidgets/a": widget("widgets.example.com/v1"),
+				"/apis/widgets.example.com/v1/polyfilledwidgets":                      widget("widgets.example.com/v1"),
+			}
+			u, err := url.Parse(newTestProxyWithMappings(t, upstream, resources))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := http.Get(u.Scheme + "://" + u.Host + testCase.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			body, err := io.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if upstream.uri != testCase.uri {
+				t.Errorf("expected request for %s, got %s", testCase.uri, upstream.uri)
+			}
+			if response.StatusCode == http.StatusOK {
+				expectJSON(t, widget("widgets.k8s.io/v1alpha1"), string(body))
+			}
+		})
+	}
+}
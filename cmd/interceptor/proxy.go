@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"log"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+type redirectKey struct{}
+
+// redirect records how a request for a native resource was redirected, so
+// that its response can be rewritten to match
+type redirect struct {
+	negotiation
+
+	// Prints Tables of the native resource, with rows which include
+	// includeObject
+	printer       *printer
+	includeObject string
+	columns       crdColumns
+}
+
+// newProxy forwards requests to upstream, redirecting the native resources
+// in mappings to the CRDs which polyfill them. Resource lists for the native
+// group versions only list the mapped resources.
+func newProxy(upstream *url.URL, transport http.RoundTripper, m *mappings) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(request *httputil.ProxyRequest) {
+			log.Printf("%6s %s", request.In.Method, request.In.URL)
+			request.SetURL(upstream)
+			if path, native, ok := m.toCRD.path(request.In.URL.Path); ok {
+				r := &redirect{}
+				request.Out = request.Out.WithContext(context.WithValue(request.Out.Context(), redirectKey{}, r))
+				request.Out.URL.Path = path
+				request.Out.URL.RawPath = ""
+
+				var accept string
+				r.negotiation, accept = negotiate(request.In.Header.Get("Accept"), native.GroupVersion())
+				if len(accept) > 0 {
+					request.Out.Header.Set("Accept", accept)
+				}
+				query := request.Out.URL.Query()
+				if p, ok := printers[native.GroupResource()]; ok && r.table {
+					r.printer = &p
+					r.includeObject = query.Get("includeObject")
+					query.Set("includeObject", "Object")
+				}
+				if selector := query.Get("fieldSelector"); len(selector) > 0 {
+					if rewritten, err := m.toCRD.fieldSelector(selector); err == nil {
+						query.Set("fieldSelector", rewritten)
+					}
+				}
+				request.Out.URL.RawQuery = query.Encode()
+
+				if request.Out.Body != nil && request.Out.Body != http.NoBody {
+					if mediaType, _, _ := mime.ParseMediaType(request.Out.Header.Get("Content-Type")); mediaType == protobufContentType {
+						request.Out.Body = protobufToJSON(request.Out.Body)
+						request.Out.Header.Set("Content-Type", "application/json")
+					}
+					if isJSON(request.Out.Header.Get("Content-Type")) {
+						request.Out.Body = newRewritingReader(request.Out.Body, request.Out.Header.Get("Content-Type"), m.toCRD.request)
+					}
+					request.Out.ContentLength = -1
+					request.Out.Header.Del("Content-Length")
+				}
+			}
+			if m.responseRewrite(request.Out) != nil {
+				// Leave compression to the transport, which decompresses
+				// responses itself when it asked for compression
+				request.Out.Header.Del("Accept-Encoding")
+			}
+		},
+		ModifyResponse: func(response *http.Response) error {
+			rewrite := m.responseRewrite(response.Request)
+			if rewrite == nil || !isJSON(response.Header.Get("Content-Type")) {
+				return nil
+			}
+			// Rewrite the body as it arrives, so that watches are streamed to
+			// the client rather than buffered. The length of the rewritten
+			// body isn't known up front, which also makes the proxy flush
+			// every write.
+			reader := newRewritingReader(response.Body, response.Header.Get("Content-Type"), rewrite)
+			if r, _ := response.Request.Context().Value(redirectKey{}).(*redirect); r != nil && r.protobuf {
+				if isWatch(response.Request) {
+					reader.encode = encodeProtobufEvent
+					response.Header.Set("Content-Type", protobufContentType+";stream=watch")
+				} else {
+					reader.encode = encodeProtobuf
+					response.Header.Set("Content-Type", protobufContentType)
+				}
+			}
+			response.Body = reader
+			response.ContentLength = -1
+			response.Header.Del("Content-Length")
+			return nil
+		},
+	}
+}
+
+// responseRewrite returns how to rewrite the response to a request made
+// upstream, or nil if the response is passed through as is
+func (m *mappings) responseRewrite(request *http.Request) func(value interface{}) {
+	r, _ := request.Context().Value(redirectKey{}).(*redirect)
+	switch {
+	case r == nil:
+		return m.discoveryRewrite(request.URL.Path)
+	case strings.HasPrefix(request.URL.Path, "/openapi/"):
+		return m.toNative.openAPI
+	}
+
+	rewrite, table := m.toNative.response, func(value interface{}) interface{} { return value }
+	if isWatch(request) {
+		rewrite = m.toNative.event
+		table = func(value interface{}) interface{} {
+			event, _ := value.(map[string]interface{})
+			return event["object"]
+		}
+	}
+	if r.printer == nil {
+		return rewrite
+	}
+	return func(value interface{}) {
+		rewrite(value)
+		if obj, ok := table(value).(map[string]interface{}); ok && obj["kind"] == "Table" {
+			r.printer.print(obj, r.includeObject, &r.columns)
+		}
+	}
+}
+
+func isWatch(request *http.Request) bool {
+	if watch := request.URL.Query().Get("watch"); watch == "true" || watch == "1" {
+		return true
+	}
+	return strings.Contains(request.URL.Path, "/watch/")
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	nativeGroupVersion = "admissionregistration.k8s.io/v1alpha1"
+	crdGroupVersion    = "admissionregistration.x-k8s.io/v1alpha1"
+	policiesPath       = "/apis/" + crdGroupVersion + "/validatingadmissionpolicies"
+)
+
+// fakeAPIServer serves the policy CRDs. Reads write each of chunks to the
+// response separately, waiting on next before writing the next one, while
+// writes echo the body they were sent.
+type fakeAPIServer struct {
+	*httptest.Server
+	chunks []string
+	next   chan struct{}
+
+	// URI and headers of the last request, and body of the last write
+	uri      string
+	header   http.Header
+	received string
+
+	// Served as is for other paths
+	documents map[string]string
+}
+
+func newFakeAPIServer(t *testing.T, chunks ...string) *fakeAPIServer {
+	s := &fakeAPIServer{chunks: chunks}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.uri = r.RequestURI
+		s.header = r.Header.Clone()
+		if document, ok := s.documents[r.URL.Path]; ok {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, document)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, policiesPath) {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.received = string(body)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(body)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for _, chunk := range s.chunks {
+			if s.next != nil {
+				select {
+				case <-s.next:
+				case <-r.Context().Done():
+					return
+				}
+			}
+			_, _ = io.WriteString(w, chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestProxy(t *testing.T, upstream *fakeAPIServer) string {
+	return newTestProxyWithMappings(t, upstream, defaultMappings)
+}
+
+func newTestProxyWithMappings(t *testing.T, upstream *fakeAPIServer, resources []mapping) string {
+	u, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newMappings(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httptest.NewServer(newProxy(u, http.DefaultTransport, m))
+	t.Cleanup(proxy.Close)
+	return proxy.URL + "/apis/" + nativeGroupVersion + "/validatingadmissionpolicies"
+}
+
+func expectJSON(t *testing.T, expected, actual string) {
+	t.Helper()
+	var expectedValue, actualValue interface{}
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		t.Fatalf("invalid expected JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(actual), &actualValue); err != nil {
+		t.Fatalf("invalid JSON %q: %v", actual, err)
+	}
+	if !reflect.DeepEqual(expectedValue, actualValue) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+// policy returns a policy of apiVersion whose message mentions both groups,
+// which is never rewritten
+func policy(apiVersion, name string) string {
+	return fmt.Sprintf(`{"apiVersion":%q,"kind":"ValidatingAdmissionPolicy","metadata":{"name":%q},`+
+		`"spec":{"validations":[{"expression":"true","message":"%s is not %s"}]}}`,
+		apiVersion, name, crdGroupVersion, nativeGroupVersion)
+}
+
+func TestProxyWatch(t *testing.T) {
+	event := func(eventType, apiVersion string) string {
+		return fmt.Sprintf(`{"type":%q,"object":%s}`, eventType, policy(apiVersion, "a"))
+	}
+	upstream := newFakeAPIServer(t,
+		event("ADDED", crdGroupVersion)+"\n",
+		event("MODIFIED", crdGroupVersion)+"\n",
+	)
+	upstream.next = make(chan struct{})
+
+	response, err := http.Get(newTestProxy(t, upstream) + "?watch=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	reader := bufio.NewReader(response.Body)
+
+	// Each event is received before the server sends the next one
+	for i, expected := range []string{event("ADDED", nativeGroupVersion), event("MODIFIED", nativeGroupVersion)} {
+		upstream.next <- struct{}{}
+
+		received := make(chan string)
+		go func() {
+			line, _ := reader.ReadString('\n')
+			received <- line
+		}()
+		select {
+		case line := <-received:
+			expectJSON(t, expected, line)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("event %d: timed out waiting for event", i)
+		}
+	}
+}
+
+func TestProxyChunkedList(t *testing.T) {
+	list := func(apiVersion string) string {
+		return fmt.Sprintf(`{"apiVersion":"%s","kind":"ValidatingAdmissionPolicyList","items":[%s,%s]}`,
+			apiVersion, policy(apiVersion, "a"), policy(apiVersion, "b"))
+	}
+	upstreamList := list(crdGroupVersion)
+
+	for _, testCase := range []struct {
+		name  string
+		split []int
+	}{
+		{
+			name: "single chunk",
+		},
+		{
+			name:  "group split across chunks",
+			split: []int{20, 30, 40},
+		},
+		{
+			name: "byte at a time",
+			split: func() []int {
+				split := make([]int, len(upstreamList)-1)
+				for i := range split {
+					split[i] = i + 1
+				}
+				return split
+			}(),
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			var chunks []string
+			start := 0
+			for _, end := range append(testCase.split, len(upstreamList)) {
+				chunks = append(chunks, upstreamList[start:end])
+				start = end
+			}
+
+			response, err := http.Get(newTestProxy(t, newFakeAPIServer(t, chunks...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			body, err := io.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectJSON(t, list(nativeGroupVersion), string(body))
+		})
+	}
+}
+
+func TestProxyRewrite(t *testing.T) {
+	// Larger than the default bufio.Scanner limit
+	large := strings.Repeat("x", 100*1024)
+
+	for _, testCase := range []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+
+		// Expected body received by the server, and by the client
+		received string
+		response string
+	}{
+		{
+			name:        "create",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body:        policy(nativeGroupVersion, "a"),
+			received:    policy(crdGroupVersion, "a"),
+			response:    policy(nativeGroupVersion, "a"),
+		},
+		{
+			name:        "large object",
+			method:      http.MethodPut,
+			contentType: "application/json",
+			body:        `{"apiVersion":"` + nativeGroupVersion + `","kind":"ValidatingAdmissionPolicy","metadata":{"name":"a","annotations":{"large":"` + large + `\n` + large + `"}}}`,
+			received:    `{"apiVersion":"` + crdGroupVersion + `","kind":"ValidatingAdmissionPolicy","metadata":{"name":"a","annotations":{"large":"` + large + `\n` + large + `"}}}`,
+			response:    `{"apiVersion":"` + nativeGroupVersion + `","kind":"ValidatingAdmissionPolicy","metadata":{"name":"a","annotations":{"large":"` + large + `\n` + large + `"}}}`,
+		},
+		{
+			name:        "paramKind and owner references",
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body: `{"apiVersion":"` + nativeGroupVersion + `","kind":"ValidatingAdmissionPolicy","metadata":{"name":"a","ownerReferences":[{"apiVersion":"` + nativeGroupVersion + `","kind":"ValidatingAdmissionPolicy","name":"b"},{"apiVersion":"v1","kind":"ConfigMap","name":"c"}]},` +
+				`"spec":{"paramKind":{"apiVersion":"` + nativeGroupVersion + `","kind":"ValidatingAdmissionPolicy"}}}`,
+			received: `{"apiVersion":"` + crdGroupVersion + `","kind":"ValidatingAdmissionPolicy","metadata":{"name":"a","ownerReferences":[{"apiVersion":"` + crdGroupVersion + `","kind":"ValidatingAdmissionPolicy","name":"b"},{"apiVersion":"v1","kind":"ConfigMap","name":"c"}]},` +
+				`"spec":{"paramKind":{"apiVersion":"` + crdGroupVersion + `","kind":"ValidatingAdmissionPolicy"}}}`,
+			response: `{"apiVersion":"` + nativeGroupVersion + `","kind":"ValidatingAdmissionPolicy","metadata":{"name":"a","ownerReferences":[{"apiVersion":"` + nativeGroupVersion + `","kind":"ValidatingAdmissionPolicy","name":"b"},{"apiVersion":"v1","kind":"ConfigMap","name":"c"}]},` +
+				`"spec":{"paramKind":{"apiVersion":"` + nativeGroupVersion + `","kind":"ValidatingAdmissionPolicy"}}}`,
+		},
+		{
+			name:        "merge patch",
+			method:      http.MethodPatch,
+			contentType: "application/merge-patch+json",
+			body:        `{"spec":{"validations":[{"expression":"true","message":"` + nativeGroupVersion + `"}]}}`,
+			received:    `{"spec":{"validations":[{"expression":"true","message":"` + nativeGroupVersion + `"}]}}`,
+			response:    `{"spec":{"validations":[{"expression":"true","message":"` + nativeGroupVersion + `"}]}}`,
+		},
+		{
+			name:        "json patch",
+			method:      http.MethodPatch,
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"replace","path":"/apiVersion","value":"` + nativeGroupVersion + `"},{"op":"replace","path":"/metadata/annotations/a","value":"` + nativeGroupVersion + `"}]`,
+			received:    `[{"op":"replace","path":"/apiVersion","value":"` + crdGroupVersion + `"},{"op":"replace","path":"/metadata/annotations/a","value":"` + nativeGroupVersion + `"}]`,
+			// Not a response the apiserver would make, but the echoed patch
+			// is left as is
+			response: `[{"op":"replace","path":"/apiVersion","value":"` + crdGroupVersion + `"},{"op":"replace","path":"/metadata/annotations/a","value":"` + nativeGroupVersion + `"}]`,
+		},
+		{
+			name:        "apply patch",
+			method:      http.MethodPatch,
+			contentType: "application/apply-patch+yaml",
+			body:        "apiVersion: " + nativeGroupVersion + "\nkind: ValidatingAdmissionPolicy\nmetadata:\n  name: a\n",
+			received:    `{"apiVersion":"` + crdGroupVersion + `","kind":"ValidatingAdmissionPolicy","metadata":{"name":"a"}}`,
+			response:    `{"apiVersion":"` + nativeGroupVersion + `","kind":"ValidatingAdmissionPolicy","metadata":{"name":"a"}}`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			upstream := newFakeAPIServer(t)
+			request, err := http.NewRequest(testCase.method, newTestProxy(t, upstream)+"/a", strings.NewReader(testCase.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			request.Header.Set("Content-Type", testCase.contentType)
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			body, err := io.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectJSON(t, testCase.received, upstream.received)
+			expectJSON(t, testCase.response, string(body))
+		})
+	}
+}
+
+func TestProxyStatus(t *testing.T) {
+	status := func(group string) string {
+		return `{"apiVersion":"v1","kind":"Status","status":"Failure","reason":"NotFound","code":404,` +
+			`"message":"validatingadmissionpolicies.admissionregistration.x-k8s.io \"a\" not found",` +
+			`"details":{"name":"a","group":"` + group + `","kind":"validatingadmissionpolicies"}}`
+	}
+	response, err := http.Get(newTestProxy(t, newFakeAPIServer(t, status("admissionregistration.x-k8s.io"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectJSON(t, status("admissionregistration.k8s.io"), string(body))
+}
+
+func TestProxyDiscovery(t *testing.T) {
+	resources := func(group string) string {
+		return `[{"resource":"validatingadmissionpolicies","responseKind":{"group":"` + group + `","version":"v1alpha1","kind":"ValidatingAdmissionPolicy"},"scope":"Cluster","singularResource":"validatingadmissionpolicy","verbs":["get","list"],"shortNames":["vap"],` +
+			`"subresources":[{"subresource":"status","responseKind":{"group":"` + group + `","version":"v1alpha1","kind":"ValidatingAdmissionPolicy"},"verbs":["get"]}]}]`
+	}
+	documents := map[string]string{
+		"/apis": `{"kind":"APIGroupList","apiVersion":"v1","groups":[` +
+			`{"name":"admissionregistration.k8s.io","versions":[{"groupVersion":"admissionregistration.k8s.io/v1","version":"v1"}],"preferredVersion":{"groupVersion":"admissionregistration.k8s.io/v1","version":"v1"}}]}`,
+		"/apis/admissionregistration.k8s.io": `{"kind":"APIGroup","apiVersion":"v1","name":"admissionregistration.k8s.io","versions":[{"groupVersion":"admissionregistration.k8s.io/v1","version":"v1"}],"preferredVersion":{"groupVersion":"admissionregistration.k8s.io/v1","version":"v1"}}`,
+		"/apis/" + crdGroupVersion:           `{"kind":"APIResourceList","apiVersion":"v1","groupVersion":"` + crdGroupVersion + `","resources":[{"name":"validatingadmissionpolicies","singularName":"validatingadmissionpolicy","namespaced":false,"kind":"ValidatingAdmissionPolicy","verbs":["get"],"shortNames":["vap"]}]}`,
+		"/openapi/v3":                        `{"paths":{"apis/` + crdGroupVersion + `":{"serverRelativeURL":"/openapi/v3/apis/` + crdGroupVersion + `?hash=ABC"}}}`,
+		"/openapi/v3/apis/" + crdGroupVersion: `{"openapi":"3.0.0","paths":{"/apis/` + crdGroupVersion + `/validatingadmissionpolicies":{"get":{"x-kubernetes-group-version-kind":{"group":"admissionregistration.x-k8s.io","version":"v1alpha1","kind":"ValidatingAdmissionPolicy"}}}},` +
+			`"components":{"schemas":{"io.x-k8s.admissionregistration.v1alpha1.ValidatingAdmissionPolicy":{"description":"admissionregistration.x-k8s.io","x-kubernetes-group-version-kind":[{"group":"admissionregistration.x-k8s.io","version":"v1alpha1","kind":"ValidatingAdmissionPolicy"}]}}}}`,
+	}
+
+	for _, testCase := range []struct {
+		name     string
+		path     string
+		accept   string
+		upstream string
+		expected string
+	}{
+		{
+			name: "group list",
+			path: "/apis",
+			expected: `{"kind":"APIGroupList","apiVersion":"v1","groups":[` +
+				`{"name":"admissionregistration.k8s.io","versions":[{"groupVersion":"admissionregistration.k8s.io/v1","version":"v1"},{"groupVersion":"` + nativeGroupVersion + `","version":"v1alpha1"}],"preferredVersion":{"groupVersion":"admissionregistration.k8s.io/v1","version":"v1"}}]}`,
+		},
+		{
+			name:   "aggregated group list",
+			path:   "/apis",
+			accept: "application/json;g=apidiscovery.k8s.io;v=v2beta1;as=APIGroupDiscoveryList,application/json",
+			upstream: `{"kind":"APIGroupDiscoveryList","apiVersion":"apidiscovery.k8s.io/v2beta1","metadata":{},"items":[` +
+				`{"metadata":{"name":"admissionregistration.k8s.io"},"versions":[{"version":"v1","freshness":"Current"}]},` +
+				`{"metadata":{"name":"admissionregistration.x-k8s.io"},"versions":[{"version":"v1alpha1","resources":` + resources("admissionregistration.x-k8s.io") + `,"freshness":"Current"}]}]}`,
+			expected: `{"kind":"APIGroupDiscoveryList","apiVersion":"apidiscovery.k8s.io/v2beta1","metadata":{},"items":[` +
+				`{"metadata":{"name":"admissionregistration.k8s.io"},"versions":[{"version":"v1","freshness":"Current"},{"version":"v1alpha1","resources":` + resources("admissionregistration.k8s.io") + `,"freshness":"Current"}]},` +
+				`{"metadata":{"name":"admissionregistration.x-k8s.io"},"versions":[{"version":"v1alpha1","resources":` + resources("admissionregistration.x-k8s.io") + `,"freshness":"Current"}]}]}`,
+		},
+		{
+			name: "group",
+			path: "/apis/admissionregistration.k8s.io",
+			expected: `{"kind":"APIGroup","apiVersion":"v1","name":"admissionregistration.k8s.io","versions":[{"groupVersion":"admissionregistration.k8s.io/v1","version":"v1"},{"groupVersion":"` + nativeGroupVersion + `","version":"v1alpha1"}],` +
+				`"preferredVersion":{"groupVersion":"admissionregistration.k8s.io/v1","version":"v1"}}`,
+		},
+		{
+			name:     "resource list",
+			path:     "/apis/" + nativeGroupVersion,
+			expected: `{"kind":"APIResourceList","apiVersion":"v1","groupVersion":"` + nativeGroupVersion + `","resources":[{"name":"validatingadmissionpolicies","singularName":"validatingadmissionpolicy","namespaced":false,"kind":"ValidatingAdmissionPolicy","verbs":["get"],"shortNames":["vap"]}]}`,
+		},
+		{
+			name: "openapi index",
+			path: "/openapi/v3",
+			expected: `{"paths":{"apis/` + crdGroupVersion + `":{"serverRelativeURL":"/openapi/v3/apis/` + crdGroupVersion + `?hash=ABC"},` +
+				`"apis/` + nativeGroupVersion + `":{"serverRelativeURL":"/openapi/v3/apis/` + nativeGroupVersion + `?hash=ABC"}}}`,
+		},
+		{
+			name: "openapi document",
+			path: "/openapi/v3/apis/" + nativeGroupVersion,
+			expected: `{"openapi":"3.0.0","paths":{"/apis/` + nativeGroupVersion + `/validatingadmissionpolicies":{"get":{"x-kubernetes-group-version-kind":{"group":"admissionregistration.k8s.io","version":"v1alpha1","kind":"ValidatingAdmissionPolicy"}}}},` +
+				`"components":{"schemas":{"io.x-k8s.admissionregistration.v1alpha1.ValidatingAdmissionPolicy":{"description":"admissionregistration.x-k8s.io","x-kubernetes-group-version-kind":[{"group":"admissionregistration.k8s.io","version":"v1alpha1","kind":"ValidatingAdmissionPolicy"}]}}}}`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			upstream := newFakeAPIServer(t)
+			upstream.documents = documents
+			if len(testCase.upstream) > 0 {
+				upstream.documents = map[string]string{testCase.path: testCase.upstream}
+			}
+			u, err := url.Parse(newTestProxy(t, upstream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			u.Path = testCase.path
+
+			request, err := http.NewRequest(http.MethodGet, u.String(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(testCase.accept) > 0 {
+				request.Header.Set("Accept", testCase.accept)
+			}
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			body, err := io.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectJSON(t, testCase.expected, string(body))
+		})
+	}
+}
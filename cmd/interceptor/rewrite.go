@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// rewriter rewrites references to some resources and group versions into
+// others. Only paths and fields which identify an API group are rewritten, so
+// user data such as messages and annotations passes through untouched.
+type rewriter struct {
+	groupVersions map[schema.GroupVersion]schema.GroupVersion
+	resources     map[schema.GroupVersionResource]schema.GroupVersionResource
+}
+
+func newRewriter() rewriter {
+	return rewriter{
+		groupVersions: map[schema.GroupVersion]schema.GroupVersion{},
+		resources:     map[schema.GroupVersionResource]schema.GroupVersionResource{},
+	}
+}
+
+func (r rewriter) add(from, to schema.GroupVersionResource) error {
+	if existing, ok := r.resources[from]; ok {
+		return fmt.Errorf("%s is already mapped to %s", from, existing)
+	}
+	if existing, ok := r.groupVersions[from.GroupVersion()]; ok && existing != to.GroupVersion() {
+		return fmt.Errorf("%s is already mapped to %s", from.GroupVersion(), existing)
+	}
+	r.resources[from] = to
+	r.groupVersions[from.GroupVersion()] = to.GroupVersion()
+	return nil
+}
+
+// groupVersion returns what apiVersion is rewritten to, if anything
+func (r rewriter) groupVersion(apiVersion string) (string, bool) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return "", false
+	}
+	to, ok := r.groupVersions[gv]
+	return to.String(), ok
+}
+
+func (r rewriter) apiVersion(obj map[string]interface{}, field string) {
+	if apiVersion, ok := obj[field].(string); ok {
+		if to, ok := r.groupVersion(apiVersion); ok {
+			obj[field] = to
+		}
+	}
+}
+
+// path rewrites the group version of an API path, along with its resource
+// if it has one, returning the resource it was rewritten from and whether it
+// was rewritten. OpenAPI v3 paths for group versions are rewritten too.
+func (r rewriter) path(path string) (string, schema.GroupVersionResource, bool) {
+	segments := strings.Split(path, "/")
+	i := 2
+	if len(segments) > 4 && segments[1] == "openapi" && segments[2] == "v3" {
+		i = 4
+	}
+	if len(segments) < i+2 || segments[i-1] != "apis" {
+		return path, schema.GroupVersionResource{}, false
+	}
+	gv := schema.GroupVersion{Group: segments[i], Version: segments[i+1]}
+	to, ok := r.groupVersions[gv]
+	if !ok {
+		return path, schema.GroupVersionResource{}, false
+	}
+
+	from := gv.WithResource("")
+	rest := segments[i+2:]
+	if len(rest) > 0 {
+		j := 0
+		if rest[j] == "watch" {
+			j++
+		}
+		if len(rest) > j+2 && rest[j] == "namespaces" {
+			j += 2
+		}
+		if j >= len(rest) {
+			return path, schema.GroupVersionResource{}, false
+		}
+		from = gv.WithResource(rest[j])
+		gvr, ok := r.resources[from]
+		if !ok {
+			return path, schema.GroupVersionResource{}, false
+		}
+		rest[j] = gvr.Resource
+	}
+	segments[i], segments[i+1] = to.Group, to.Version
+	return strings.Join(segments, "/"), from, true
+}
+
+// fieldSelector rewrites apiVersions selected by a field selector
+func (r rewriter) fieldSelector(selector string) (string, error) {
+	parsed, err := fields.ParseSelector(selector)
+	if err != nil {
+		return "", err
+	}
+	parsed, err = parsed.Transform(func(field, value string) (string, string, error) {
+		if to, ok := r.groupVersion(value); ok {
+			return field, to, nil
+		}
+		return field, value, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return parsed.String(), nil
+}
+
+// object rewrites an object, list or Status
+func (r rewriter) object(obj map[string]interface{}) {
+	r.apiVersion(obj, "apiVersion")
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		for _, field := range []string{"ownerReferences", "managedFields"} {
+			for _, ref := range objects(metadata[field]) {
+				r.apiVersion(ref, "apiVersion")
+			}
+		}
+	}
+	if spec, ok := obj["spec"].(map[string]interface{}); ok {
+		if paramKind, ok := spec["paramKind"].(map[string]interface{}); ok {
+			r.apiVersion(paramKind, "apiVersion")
+		}
+	}
+	for _, item := range objects(obj["items"]) {
+		r.object(item)
+	}
+	switch obj["kind"] {
+	case "Table":
+		for _, row := range objects(obj["rows"]) {
+			r.response(row["object"])
+		}
+	case "APIResourceList":
+		r.resourceList(obj)
+	case "Status":
+		// Details identify the resource by group and resource, without a
+		// version
+		if details, ok := obj["details"].(map[string]interface{}); ok {
+			group, _ := details["group"].(string)
+			resource, _ := details["kind"].(string)
+			for from, to := range r.resources {
+				if from.Group == group && from.Resource == resource {
+					details["group"], details["kind"] = to.Group, to.Resource
+					break
+				}
+			}
+		}
+	}
+}
+
+// resourceList rewrites an APIResourceList, leaving out resources which
+// aren't rewritten
+func (r rewriter) resourceList(list map[string]interface{}) {
+	groupVersion, _ := list["groupVersion"].(string)
+	gv, err := schema.ParseGroupVersion(groupVersion)
+	if err != nil {
+		return
+	}
+	to, ok := r.groupVersions[gv]
+	if !ok {
+		return
+	}
+	list["groupVersion"] = to.String()
+
+	var resources []interface{}
+	for _, resource := range objects(list["resources"]) {
+		name, _ := resource["name"].(string)
+		resourceName, subresource, _ := strings.Cut(name, "/")
+		gvr, ok := r.resources[gv.WithResource(resourceName)]
+		if !ok {
+			continue
+		}
+		if len(subresource) > 0 {
+			resource["name"] = gvr.Resource + "/" + subresource
+		} else {
+			resource["name"] = gvr.Resource
+		}
+		resources = append(resources, resource)
+	}
+	list["resources"] = resources
+}
+
+// response rewrites a decoded response body
+func (r rewriter) response(value interface{}) {
+	if obj, ok := value.(map[string]interface{}); ok {
+		r.object(obj)
+	}
+}
+
+// event rewrites a decoded watch event
+func (r rewriter) event(value interface{}) {
+	if event, ok := value.(map[string]interface{}); ok {
+		r.response(event["object"])
+	}
+}
+
+// request rewrites a decoded request body, which may be a JSON patch
+func (r rewriter) request(value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		r.object(value)
+	case []interface{}:
+		for _, op := range objects(value) {
+			switch opValue := op["value"].(type) {
+			case string:
+				if path, _ := op["path"].(string); strings.HasSuffix(path, "/apiVersion") {
+					if to, ok := r.groupVersion(opValue); ok {
+						op["value"] = to
+					}
+				}
+			case map[string]interface{}:
+				r.object(opValue)
+			}
+		}
+	}
+}
+
+func objects(value interface{}) []map[string]interface{} {
+	values, _ := value.([]interface{})
+	var result []map[string]interface{}
+	for _, value := range values {
+		if obj, ok := value.(map[string]interface{}); ok {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
+
+// isJSON returns whether bodies of contentType are JSON, or for apply
+// patches YAML
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/json",
+		"application/merge-patch+json",
+		"application/strategic-merge-patch+json",
+		"application/json-patch+json",
+		"application/apply-patch+yaml":
+		return true
+	}
+	return false
+}
+
+type decoder interface {
+	Decode(into interface{}) error
+}
+
+// rewritingReader decodes each value of a JSON stream in source, such as a
+// single object or a series of watch events, and re-encodes it once
+// rewritten. Values are returned as soon as they are decoded, so streams are
+// never buffered beyond the value in progress.
+type rewritingReader struct {
+	source  io.Closer
+	decoder decoder
+	rewrite func(value interface{})
+	encode  func(value interface{}, out *bytes.Buffer) error
+
+	out bytes.Buffer
+	err error
+}
+
+func newRewritingReader(source io.ReadCloser, contentType string, rewrite func(value interface{})) *rewritingReader {
+	var d decoder
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/apply-patch+yaml" {
+		d = utilyaml.NewYAMLOrJSONDecoder(source, 4096)
+	} else {
+		// Keep numbers as they were written, rather than as float64
+		jsonDecoder := json.NewDecoder(source)
+		jsonDecoder.UseNumber()
+		d = jsonDecoder
+	}
+	return &rewritingReader{
+		source:  source,
+		decoder: d,
+		rewrite: rewrite,
+		encode:  encodeJSON,
+	}
+}
+
+func (r *rewritingReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		var value interface{}
+		if r.err = r.decoder.Decode(&value); r.err != nil {
+			continue
+		}
+		r.rewrite(value)
+		r.err = r.encode(value, &r.out)
+	}
+	return r.out.Read(p)
+}
+
+func encodeJSON(value interface{}, out *bytes.Buffer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(value)
+}
+
+func (r *rewritingReader) Close() error {
+	return r.source.Close()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// printer prints a native resource with the columns the apiserver would
+type printer struct {
+	columns []interface{}
+
+	// Cells after the name, and before the age
+	cells func(obj map[string]interface{}) []interface{}
+}
+
+// printers are the native resources whose columns the CRDs lack
+var printers = map[schema.GroupResource]printer{
+	{Group: "admissionregistration.k8s.io", Resource: "validatingadmissionpolicies"}: {
+		columns: []interface{}{
+			column("Validations", "integer", "Validations indicates the number of validation rules defined in this configuration"),
+			column("ParamKind", "string", "ParamKind specifies the kind of resources used to parameterize this policy"),
+		},
+		cells: func(obj map[string]interface{}) []interface{} {
+			spec, _ := obj["spec"].(map[string]interface{})
+			paramKind := "<unset>"
+			if ref, ok := spec["paramKind"].(map[string]interface{}); ok {
+				apiVersion, _ := ref["apiVersion"].(string)
+				kind, _ := ref["kind"].(string)
+				paramKind = apiVersion + "/" + kind
+			}
+			return []interface{}{len(items(spec["validations"])), paramKind}
+		},
+	},
+	{Group: "admissionregistration.k8s.io", Resource: "validatingadmissionpolicybindings"}: {
+		columns: []interface{}{
+			column("PolicyName", "string", "PolicyName indicates the policy definition which the policy binding binded to"),
+			column("ParamRef", "string", "ParamRef indicates the param resource which sets the configration param"),
+		},
+		cells: func(obj map[string]interface{}) []interface{} {
+			spec, _ := obj["spec"].(map[string]interface{})
+			paramRef := "<unset>"
+			if ref, ok := spec["paramRef"].(map[string]interface{}); ok {
+				name, _ := ref["name"].(string)
+				paramRef = name
+				if namespace, _ := ref["namespace"].(string); len(namespace) > 0 {
+					paramRef = namespace + "/" + name
+				}
+			}
+			return []interface{}{spec["policyName"], paramRef}
+		},
+	},
+}
+
+func column(name, columnType, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"type":        columnType,
+		"format":      "",
+		"description": description,
+		"priority":    0,
+	}
+}
+
+// crdColumns are the positions of the CRD's Table columns the native Table
+// keeps. Tables after the first of a watch have no column definitions, so
+// they are remembered from the first.
+type crdColumns struct {
+	name, age, count int
+}
+
+// print replaces the columns of a Table of the CRD with those of the native
+// resource. Rows must include their whole object, which is then reduced to
+// what includeObject asked for.
+func (p printer) print(table map[string]interface{}, includeObject string, columns *crdColumns) {
+	if definitions := objects(table["columnDefinitions"]); len(definitions) > 0 {
+		found := crdColumns{name: -1, age: -1, count: len(definitions)}
+		for i, definition := range definitions {
+			switch definition["name"] {
+			case "Name":
+				found.name = i
+			case "Age":
+				found.age = i
+			}
+		}
+		if found.name < 0 || found.age < 0 {
+			return
+		}
+		*columns = found
+
+		printed := []interface{}{definitions[found.name]}
+		printed = append(printed, p.columns...)
+		table["columnDefinitions"] = append(printed, definitions[found.age])
+	} else if columns.count == 0 {
+		return
+	}
+
+	for _, row := range objects(table["rows"]) {
+		cells := items(row["cells"])
+		obj, _ := row["object"].(map[string]interface{})
+		if len(cells) != columns.count || obj == nil {
+			continue
+		}
+		printed := []interface{}{cells[columns.name]}
+		printed = append(printed, p.cells(obj)...)
+		row["cells"] = append(printed, cells[columns.age])
+
+		switch includeObject {
+		case "None":
+			delete(row, "object")
+		case "Object":
+		default:
+			row["object"] = map[string]interface{}{
+				"apiVersion": "meta.k8s.io/v1",
+				"kind":       "PartialObjectMetadata",
+				"metadata":   obj["metadata"],
+			}
+		}
+	}
+}
@@ -39,3 +39,10 @@ echo "copying manifests"
 cp "${SCRIPT_ROOT}/manifests/"*.yaml "${SCRIPT_ROOT}/_output/manifests"
 
 go run github.com/mikefarah/yq/v4 eval -i ".webhooks[0].clientConfig.caBundle = env(CA_PEM)" "${SCRIPT_ROOT}/_output/manifests/webhook-config.yaml"
+
+echo "copying crds"
+for CRD in "${SCRIPT_ROOT}/crds/"*.yaml; do
+  OUT="${SCRIPT_ROOT}/_output/manifests/$(basename "${CRD}")"
+  cp "${CRD}" "${OUT}"
+  go run github.com/mikefarah/yq/v4 eval -i ".spec.conversion.webhook.clientConfig.caBundle = env(CA_PEM)" "${OUT}"
+done
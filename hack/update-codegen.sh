@@ -32,7 +32,7 @@ function codegen::join() {
 
 PKG_NAME="k8s.io/cel-admission-webhook"
 
-GROUPS_WITH_VERSIONS="admissionregistration.x-k8s.io:v1alpha1"
+GROUPS_WITH_VERSIONS="admissionregistration.x-k8s.io:v1alpha1,v1beta1,v1"
 
 APIS_PKG="${PKG_NAME}/pkg/apis"
 OUTPUT_PKG="pkg/generated"
@@ -86,9 +86,15 @@ go run sigs.k8s.io/controller-tools/cmd/controller-gen \
   output:dir=./crds
 
 # Generated CRDs cannot have the empty object defaults, overwriting afterwards
-go run github.com/mikefarah/yq/v4 eval ".spec.versions[0].schema.openAPIV3Schema.properties.spec.properties.matchConstraints.properties.namespaceSelector.default = {}" "./crds/admissionregistration.x-k8s.io_validatingadmissionpolicies.yaml" -i
-go run github.com/mikefarah/yq/v4 eval ".spec.versions[0].schema.openAPIV3Schema.properties.spec.properties.matchConstraints.properties.objectSelector.default = {}" "./crds/admissionregistration.x-k8s.io_validatingadmissionpolicies.yaml" -i
-go run github.com/mikefarah/yq/v4 eval ".spec.versions[0].schema.openAPIV3Schema.properties.spec.properties.matchResources.properties.namespaceSelector.default = {}" "./crds/admissionregistration.x-k8s.io_validatingadmissionpolicybindings.yaml" -i
-go run github.com/mikefarah/yq/v4 eval ".spec.versions[0].schema.openAPIV3Schema.properties.spec.properties.matchResources.properties.objectSelector.default = {}" "./crds/admissionregistration.x-k8s.io_validatingadmissionpolicybindings.yaml" -i
+go run github.com/mikefarah/yq/v4 eval ".spec.versions[].schema.openAPIV3Schema.properties.spec.properties.matchConstraints.properties.namespaceSelector.default = {}" "./crds/admissionregistration.x-k8s.io_validatingadmissionpolicies.yaml" -i
+go run github.com/mikefarah/yq/v4 eval ".spec.versions[].schema.openAPIV3Schema.properties.spec.properties.matchConstraints.properties.objectSelector.default = {}" "./crds/admissionregistration.x-k8s.io_validatingadmissionpolicies.yaml" -i
+go run github.com/mikefarah/yq/v4 eval ".spec.versions[].schema.openAPIV3Schema.properties.spec.properties.matchResources.properties.namespaceSelector.default = {}" "./crds/admissionregistration.x-k8s.io_validatingadmissionpolicybindings.yaml" -i
+go run github.com/mikefarah/yq/v4 eval ".spec.versions[].schema.openAPIV3Schema.properties.spec.properties.matchResources.properties.objectSelector.default = {}" "./crds/admissionregistration.x-k8s.io_validatingadmissionpolicybindings.yaml" -i
+
+# Versions are converted by the polyfill's webhook server. The caBundle is
+# filled in by hack/gen-manifests.sh
+for CRD in ./crds/admissionregistration.x-k8s.io_*.yaml; do
+  go run github.com/mikefarah/yq/v4 eval '.spec.conversion = {"strategy": "Webhook", "webhook": {"conversionReviewVersions": ["v1"], "clientConfig": {"service": {"namespace": "default", "name": "cel-shim-webhook", "path": "/convert", "port": 443}}}}' "${CRD}" -i
+done
 
 popd >/dev/null
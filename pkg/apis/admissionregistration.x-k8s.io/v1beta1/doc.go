@@ -0,0 +1,10 @@
+// Package v1beta1 mirrors the same types of the Kubernetes
+// admissionregistration.x-k8s.io v1beta1, with markers that aids the generation
+// of CRDs.
+//
+// +k8s:deepcopy-gen=package
+// +k8s:protobuf-gen=package
+// +k8s:openapi-gen=true
+// +k8s:defaulter-gen=TypeMeta
+// +groupName=admissionregistration.x-k8s.io
+package v1beta1
@@ -0,0 +1,196 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"k8s.io/klog/v2"
+)
+
+var logger klog.Logger = klog.LoggerWithName(klog.Background(), "authz")
+
+// How long a SubjectAccessReview may take
+const reviewTimeout = 10 * time.Second
+
+type Options struct {
+	// How long allowed decisions are cached for. Zero disables caching them
+	AllowedTTL time.Duration
+
+	// How long denied decisions, and those without an opinion, are cached
+	// for. Zero disables caching them
+	DeniedTTL time.Duration
+
+	// Maximum number of decisions cached
+	CacheSize int
+}
+
+// SubjectAccessReviewAuthorizer authorizes requests by creating a
+// SubjectAccessReview for the user making the request, so that CEL
+// authorizer checks see the same decisions the apiserver would make for that
+// user.
+//
+// Decisions are cached, and concurrent checks of the same attributes share a
+// single SubjectAccessReview. Errors are not cached.
+type SubjectAccessReviewAuthorizer struct {
+	client  authorizationv1client.SubjectAccessReviewInterface
+	options Options
+	cache   *cache.LRUExpireCache
+
+	lock     sync.Mutex
+	inflight map[string]*check
+}
+
+var _ authorizer.Authorizer = &SubjectAccessReviewAuthorizer{}
+
+type decision struct {
+	decision authorizer.Decision
+	reason   string
+}
+
+// A SubjectAccessReview in progress
+type check struct {
+	done chan struct{}
+
+	result decision
+	err    error
+}
+
+func New(client authorizationv1client.SubjectAccessReviewInterface, options Options) *SubjectAccessReviewAuthorizer {
+	return newWithClock(client, options, nil)
+}
+
+func newWithClock(client authorizationv1client.SubjectAccessReviewInterface, options Options, clock cache.Clock) *SubjectAccessReviewAuthorizer {
+	if options.CacheSize <= 0 {
+		options.CacheSize = 1
+	}
+	a := &SubjectAccessReviewAuthorizer{
+		client:   client,
+		options:  options,
+		inflight: map[string]*check{},
+	}
+	if clock != nil {
+		a.cache = cache.NewLRUExpireCacheWithClock(options.CacheSize, clock)
+	} else {
+		a.cache = cache.NewLRUExpireCache(options.CacheSize)
+	}
+	return a
+}
+
+func (a *SubjectAccessReviewAuthorizer) Authorize(ctx context.Context, attributes authorizer.Attributes) (authorizer.Decision, string, error) {
+	spec := subjectAccessReviewSpec(attributes)
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return authorizer.DecisionNoOpinion, "", err
+	}
+	key := string(data)
+
+	if cached, ok := a.cache.Get(key); ok {
+		result := cached.(decision)
+		return result.decision, result.reason, nil
+	}
+
+	a.lock.Lock()
+	c, ok := a.inflight[key]
+	if !ok {
+		c = &check{done: make(chan struct{})}
+		a.inflight[key] = c
+		go a.check(key, spec, c)
+	}
+	a.lock.Unlock()
+
+	select {
+	case <-c.done:
+		return c.result.decision, c.result.reason, c.err
+	case <-ctx.Done():
+		return authorizer.DecisionNoOpinion, "", ctx.Err()
+	}
+}
+
+// check makes the SubjectAccessReview shared by every caller waiting on c.
+// It is not bound to any caller's context, so that one caller giving up
+// does not fail the others.
+func (a *SubjectAccessReviewAuthorizer) check(key string, spec authorizationv1.SubjectAccessReviewSpec, c *check) {
+	ctx, cancel := context.WithTimeout(context.Background(), reviewTimeout)
+	defer cancel()
+
+	c.result, c.err = a.review(ctx, spec)
+	if c.err == nil {
+		ttl := a.options.DeniedTTL
+		if c.result.decision == authorizer.DecisionAllow {
+			ttl = a.options.AllowedTTL
+		}
+		if ttl > 0 {
+			a.cache.Add(key, c.result, ttl)
+		}
+	}
+
+	a.lock.Lock()
+	delete(a.inflight, key)
+	a.lock.Unlock()
+	close(c.done)
+}
+
+func (a *SubjectAccessReviewAuthorizer) review(ctx context.Context, spec authorizationv1.SubjectAccessReviewSpec) (decision, error) {
+	review, err := a.client.Create(ctx, &authorizationv1.SubjectAccessReview{Spec: spec}, metav1.CreateOptions{})
+	if err != nil {
+		logger.Error(err, "SubjectAccessReview failed", "user", spec.User)
+		return decision{decision: authorizer.DecisionNoOpinion}, err
+	}
+
+	// Like the webhook authorizer, trust a decision even if some authorizer
+	// in the chain failed to evaluate
+	status := review.Status
+	switch {
+	case status.Allowed:
+		return decision{decision: authorizer.DecisionAllow, reason: status.Reason}, nil
+	case status.Denied:
+		return decision{decision: authorizer.DecisionDeny, reason: status.Reason}, nil
+	case len(status.EvaluationError) > 0:
+		return decision{decision: authorizer.DecisionNoOpinion, reason: status.Reason}, errors.New(status.EvaluationError)
+	default:
+		return decision{decision: authorizer.DecisionNoOpinion, reason: status.Reason}, nil
+	}
+}
+
+// subjectAccessReviewSpec asks whether the user of attributes may perform
+// the request described by them
+func subjectAccessReviewSpec(attributes authorizer.Attributes) authorizationv1.SubjectAccessReviewSpec {
+	spec := authorizationv1.SubjectAccessReviewSpec{}
+	if user := attributes.GetUser(); user != nil {
+		spec.User = user.GetName()
+		spec.UID = user.GetUID()
+		spec.Groups = user.GetGroups()
+		if extra := user.GetExtra(); len(extra) > 0 {
+			spec.Extra = make(map[string]authorizationv1.ExtraValue, len(extra))
+			for k, v := range extra {
+				spec.Extra[k] = authorizationv1.ExtraValue(v)
+			}
+		}
+	}
+
+	if attributes.IsResourceRequest() {
+		spec.ResourceAttributes = &authorizationv1.ResourceAttributes{
+			Namespace:   attributes.GetNamespace(),
+			Verb:        attributes.GetVerb(),
+			Group:       attributes.GetAPIGroup(),
+			Version:     attributes.GetAPIVersion(),
+			Resource:    attributes.GetResource(),
+			Subresource: attributes.GetSubresource(),
+			Name:        attributes.GetName(),
+		}
+	} else {
+		spec.NonResourceAttributes = &authorizationv1.NonResourceAttributes{
+			Path: attributes.GetPath(),
+			Verb: attributes.GetVerb(),
+		}
+	}
+	return spec
+}
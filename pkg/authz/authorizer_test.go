@@ -0,0 +1,313 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+// fakeSARServer answers SubjectAccessReviews, allowing users in the
+// "allowed" group and denying the others. Users in the "no-opinion" group get
+// neither, and users in the "broken" group get an evaluation error as well.
+type fakeSARServer struct {
+	*httptest.Server
+
+	requests atomic.Int32
+}
+
+func newFakeSARServer(t *testing.T) *fakeSARServer {
+	s := &fakeSARServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/authorization.k8s.io/v1/subjectaccessreviews" {
+			http.NotFound(w, r)
+			return
+		}
+		s.requests.Add(1)
+
+		review := &authorizationv1.SubjectAccessReview{}
+		if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		noOpinion := false
+		for _, group := range review.Spec.Groups {
+			switch group {
+			case "allowed":
+				review.Status.Allowed = true
+				review.Status.Reason = "allowed group"
+			case "no-opinion":
+				noOpinion = true
+			case "broken":
+				review.Status.EvaluationError = "webhook authorizer failed"
+			}
+		}
+		if !review.Status.Allowed && !noOpinion {
+			review.Status.Denied = true
+			review.Status.Reason = "not in allowed group"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeSARServer) authorizer(t *testing.T, options Options, clock cache.Clock) *SubjectAccessReviewAuthorizer {
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newWithClock(client.AuthorizationV1().SubjectAccessReviews(), options, clock)
+}
+
+func attributes(groups ...string) authorizer.Attributes {
+	return authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "user", Groups: groups},
+		Verb:            "create",
+		Namespace:       "default",
+		APIGroup:        "",
+		APIVersion:      "v1",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	ctx := context.Background()
+	clock := testingclock.NewFakeClock(time.Now())
+	server := newFakeSARServer(t)
+	a := server.authorizer(t, Options{AllowedTTL: time.Minute, DeniedTTL: 10 * time.Second, CacheSize: 10}, clock)
+
+	for _, testCase := range []struct {
+		name       string
+		attributes authorizer.Attributes
+		advance    time.Duration
+		decision   authorizer.Decision
+		requests   int32
+	}{
+		{
+			name:       "allowed",
+			attributes: attributes("allowed"),
+			decision:   authorizer.DecisionAllow,
+			requests:   1,
+		},
+		{
+			name:       "allowed cached",
+			attributes: attributes("allowed"),
+			advance:    30 * time.Second,
+			decision:   authorizer.DecisionAllow,
+			requests:   1,
+		},
+		{
+			name:       "denied",
+			attributes: attributes("other"),
+			decision:   authorizer.DecisionDeny,
+			requests:   2,
+		},
+		{
+			name:       "denied cached",
+			attributes: attributes("other"),
+			advance:    5 * time.Second,
+			decision:   authorizer.DecisionDeny,
+			requests:   2,
+		},
+		{
+			name:       "denied expired",
+			attributes: attributes("other"),
+			advance:    10 * time.Second,
+			decision:   authorizer.DecisionDeny,
+			requests:   3,
+		},
+		{
+			name:       "allowed expired",
+			attributes: attributes("allowed"),
+			advance:    30 * time.Second,
+			decision:   authorizer.DecisionAllow,
+			requests:   4,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			clock.Step(testCase.advance)
+			decision, _, err := a.Authorize(ctx, testCase.attributes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision != testCase.decision {
+				t.Errorf("expected decision %v, got %v", testCase.decision, decision)
+			}
+			if requests := server.requests.Load(); requests != testCase.requests {
+				t.Errorf("expected %d SubjectAccessReviews, got %d", testCase.requests, requests)
+			}
+		})
+	}
+}
+
+func TestAuthorizeEvaluationError(t *testing.T) {
+	server := newFakeSARServer(t)
+	a := server.authorizer(t, Options{}, nil)
+
+	for _, testCase := range []struct {
+		name      string
+		groups    []string
+		decision  authorizer.Decision
+		expectErr bool
+	}{
+		{
+			name:     "allowed",
+			groups:   []string{"allowed", "broken"},
+			decision: authorizer.DecisionAllow,
+		},
+		{
+			name:     "denied",
+			groups:   []string{"broken"},
+			decision: authorizer.DecisionDeny,
+		},
+		{
+			name:      "no opinion",
+			groups:    []string{"no-opinion", "broken"},
+			decision:  authorizer.DecisionNoOpinion,
+			expectErr: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			decision, _, err := a.Authorize(context.Background(), attributes(testCase.groups...))
+			if (err != nil) != testCase.expectErr {
+				t.Errorf("expected error %v, got %v", testCase.expectErr, err)
+			}
+			if decision != testCase.decision {
+				t.Errorf("expected decision %v, got %v", testCase.decision, decision)
+			}
+		})
+	}
+}
+
+// blockingClient allows every SubjectAccessReview, through a fake clientset
+// which counts them. Each one waits for release to be closed before it is
+// answered.
+type blockingClient struct {
+	*fake.Clientset
+
+	creates atomic.Int32
+	release chan struct{}
+}
+
+func newBlockingClient() *blockingClient {
+	c := &blockingClient{Clientset: fake.NewSimpleClientset(), release: make(chan struct{})}
+	c.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		c.creates.Add(1)
+		<-c.release
+		review := action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview).DeepCopy()
+		review.Status.Allowed = true
+		return true, review, nil
+	})
+	return c
+}
+
+// waitingContext announces on waiting when Authorize starts waiting on it,
+// which it only does once it has started or joined a check
+type waitingContext struct {
+	context.Context
+	waiting chan<- struct{}
+}
+
+func (c waitingContext) Done() <-chan struct{} {
+	c.waiting <- struct{}{}
+	return c.Context.Done()
+}
+
+func TestAuthorizeDeduplicates(t *testing.T) {
+	client := newBlockingClient()
+
+	// Nothing is cached, so only deduplication can save requests
+	a := newWithClock(client.AuthorizationV1().SubjectAccessReviews(), Options{}, nil)
+
+	const checks = 5
+	var wg sync.WaitGroup
+	waiting := make(chan struct{}, checks)
+	decisions := make([]authorizer.Decision, checks)
+	for i := 0; i < checks; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			decisions[i], _, _ = a.Authorize(waitingContext{context.Background(), waiting}, attributes("allowed"))
+		}(i)
+	}
+
+	// Every check waits before the first is answered
+	for i := 0; i < checks; i++ {
+		<-waiting
+	}
+	close(client.release)
+	wg.Wait()
+
+	if creates := client.creates.Load(); creates != 1 {
+		t.Errorf("expected 1 SubjectAccessReview, got %d", creates)
+	}
+	for i, decision := range decisions {
+		if decision != authorizer.DecisionAllow {
+			t.Errorf("check %d: expected allow, got %v", i, decision)
+		}
+	}
+
+	// Checks after the first completed make a new request
+	if _, _, err := a.Authorize(context.Background(), attributes("allowed")); err != nil {
+		t.Fatal(err)
+	}
+	if creates := client.creates.Load(); creates != 2 {
+		t.Errorf("expected 2 SubjectAccessReviews, got %d", creates)
+	}
+}
+
+func TestAuthorizeFirstCallerCancelled(t *testing.T) {
+	client := newBlockingClient()
+	a := newWithClock(client.AuthorizationV1().SubjectAccessReviews(), Options{}, nil)
+
+	waiting := make(chan struct{}, 2)
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, _, err := a.Authorize(waitingContext{first, waiting}, attributes("allowed"))
+		firstErr <- err
+	}()
+	<-waiting
+
+	second := make(chan authorizer.Decision)
+	go func() {
+		decision, _, err := a.Authorize(waitingContext{context.Background(), waiting}, attributes("allowed"))
+		if err != nil {
+			t.Errorf("expected the second check not to fail, got %v", err)
+		}
+		second <- decision
+	}()
+	<-waiting
+
+	// The first caller gives up, but the review it started carries on
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Errorf("expected the first check to be cancelled, got %v", err)
+	}
+	close(client.release)
+
+	if decision := <-second; decision != authorizer.DecisionAllow {
+		t.Errorf("expected allow, got %v", decision)
+	}
+	if creates := client.creates.Load(); creates != 1 {
+		t.Errorf("expected 1 SubjectAccessReview, got %d", creates)
+	}
+}
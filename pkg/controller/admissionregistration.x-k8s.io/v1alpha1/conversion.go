@@ -0,0 +1,231 @@
+package v1alpha1
+
+import (
+	admissionregistrationv1alpha1types "k8s.io/api/admissionregistration/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1alpha1"
+)
+
+// The native and x-k8s types have the same shape, so conversion copies field
+// by field. Types without pointers or slices are converted directly, so that
+// a field added upstream fails to compile rather than being dropped. The
+// others are covered by the round trip tests.
+//
+// Results never share memory with their input, since inputs are frequently
+// read from informer caches.
+
+func NativeToCRDPolicy(in *admissionregistrationv1alpha1types.ValidatingAdmissionPolicy) (*v1alpha1.ValidatingAdmissionPolicy, error) {
+	if in == nil {
+		return nil, nil
+	}
+
+	out := &v1alpha1.ValidatingAdmissionPolicy{
+		TypeMeta: convertTypeMeta(in.TypeMeta, v1alpha1.SchemeGroupVersion.String()),
+		Spec: v1alpha1.ValidatingAdmissionPolicySpec{
+			ParamKind:        (*v1alpha1.ParamKind)(in.Spec.ParamKind.DeepCopy()),
+			MatchConstraints: nativeToCRDMatchResources(in.Spec.MatchConstraints),
+			Validations: convertSlice(in.Spec.Validations, func(in *admissionregistrationv1alpha1types.Validation) v1alpha1.Validation {
+				return v1alpha1.Validation{
+					Expression:        in.Expression,
+					Message:           in.Message,
+					Reason:            copyPointer(in.Reason),
+					MessageExpression: in.MessageExpression,
+				}
+			}),
+			FailurePolicy: (*v1alpha1.FailurePolicyType)(copyPointer(in.Spec.FailurePolicy)),
+			AuditAnnotations: convertSlice(in.Spec.AuditAnnotations, func(in *admissionregistrationv1alpha1types.AuditAnnotation) v1alpha1.AuditAnnotation {
+				return v1alpha1.AuditAnnotation(*in)
+			}),
+			MatchConditions: convertSlice(in.Spec.MatchConditions, func(in *admissionregistrationv1alpha1types.MatchCondition) v1alpha1.MatchCondition {
+				return v1alpha1.MatchCondition(*in)
+			}),
+		},
+		Status: v1alpha1.ValidatingAdmissionPolicyStatus{
+			ObservedGeneration: in.Status.ObservedGeneration,
+			Conditions:         copyConditions(in.Status.Conditions),
+		},
+	}
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+
+	if in.Status.TypeChecking != nil {
+		out.Status.TypeChecking = &v1alpha1.TypeChecking{
+			ExpressionWarnings: convertSlice(in.Status.TypeChecking.ExpressionWarnings, func(in *admissionregistrationv1alpha1types.ExpressionWarning) v1alpha1.ExpressionWarning {
+				return v1alpha1.ExpressionWarning(*in)
+			}),
+		}
+	}
+	return out, nil
+}
+
+func CRDToNativePolicy(in *v1alpha1.ValidatingAdmissionPolicy) (*admissionregistrationv1alpha1types.ValidatingAdmissionPolicy, error) {
+	if in == nil {
+		return nil, nil
+	}
+
+	out := &admissionregistrationv1alpha1types.ValidatingAdmissionPolicy{
+		TypeMeta: convertTypeMeta(in.TypeMeta, admissionregistrationv1alpha1types.SchemeGroupVersion.String()),
+		Spec: admissionregistrationv1alpha1types.ValidatingAdmissionPolicySpec{
+			ParamKind:        (*admissionregistrationv1alpha1types.ParamKind)(in.Spec.ParamKind.DeepCopy()),
+			MatchConstraints: crdToNativeMatchResources(in.Spec.MatchConstraints),
+			Validations: convertSlice(in.Spec.Validations, func(in *v1alpha1.Validation) admissionregistrationv1alpha1types.Validation {
+				return admissionregistrationv1alpha1types.Validation{
+					Expression:        in.Expression,
+					Message:           in.Message,
+					Reason:            copyPointer(in.Reason),
+					MessageExpression: in.MessageExpression,
+				}
+			}),
+			FailurePolicy: (*admissionregistrationv1alpha1types.FailurePolicyType)(copyPointer(in.Spec.FailurePolicy)),
+			AuditAnnotations: convertSlice(in.Spec.AuditAnnotations, func(in *v1alpha1.AuditAnnotation) admissionregistrationv1alpha1types.AuditAnnotation {
+				return admissionregistrationv1alpha1types.AuditAnnotation(*in)
+			}),
+			MatchConditions: convertSlice(in.Spec.MatchConditions, func(in *v1alpha1.MatchCondition) admissionregistrationv1alpha1types.MatchCondition {
+				return admissionregistrationv1alpha1types.MatchCondition(*in)
+			}),
+		},
+		Status: admissionregistrationv1alpha1types.ValidatingAdmissionPolicyStatus{
+			ObservedGeneration: in.Status.ObservedGeneration,
+			Conditions:         copyConditions(in.Status.Conditions),
+		},
+	}
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+
+	if in.Status.TypeChecking != nil {
+		out.Status.TypeChecking = &admissionregistrationv1alpha1types.TypeChecking{
+			ExpressionWarnings: convertSlice(in.Status.TypeChecking.ExpressionWarnings, func(in *v1alpha1.ExpressionWarning) admissionregistrationv1alpha1types.ExpressionWarning {
+				return admissionregistrationv1alpha1types.ExpressionWarning(*in)
+			}),
+		}
+	}
+	return out, nil
+}
+
+func NativeToCRDPolicyBinding(in *admissionregistrationv1alpha1types.ValidatingAdmissionPolicyBinding) (*v1alpha1.ValidatingAdmissionPolicyBinding, error) {
+	if in == nil {
+		return nil, nil
+	}
+
+	out := &v1alpha1.ValidatingAdmissionPolicyBinding{
+		TypeMeta: convertTypeMeta(in.TypeMeta, v1alpha1.SchemeGroupVersion.String()),
+		Spec: v1alpha1.ValidatingAdmissionPolicyBindingSpec{
+			PolicyName:     in.Spec.PolicyName,
+			ParamRef:       (*v1alpha1.ParamRef)(in.Spec.ParamRef.DeepCopy()),
+			MatchResources: nativeToCRDMatchResources(in.Spec.MatchResources),
+			ValidationActions: convertSlice(in.Spec.ValidationActions, func(in *admissionregistrationv1alpha1types.ValidationAction) v1alpha1.ValidationAction {
+				return v1alpha1.ValidationAction(*in)
+			}),
+		},
+	}
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return out, nil
+}
+
+func CRDToNativePolicyBinding(in *v1alpha1.ValidatingAdmissionPolicyBinding) (*admissionregistrationv1alpha1types.ValidatingAdmissionPolicyBinding, error) {
+	if in == nil {
+		return nil, nil
+	}
+
+	out := &admissionregistrationv1alpha1types.ValidatingAdmissionPolicyBinding{
+		TypeMeta: convertTypeMeta(in.TypeMeta, admissionregistrationv1alpha1types.SchemeGroupVersion.String()),
+		Spec: admissionregistrationv1alpha1types.ValidatingAdmissionPolicyBindingSpec{
+			PolicyName:     in.Spec.PolicyName,
+			ParamRef:       (*admissionregistrationv1alpha1types.ParamRef)(in.Spec.ParamRef.DeepCopy()),
+			MatchResources: crdToNativeMatchResources(in.Spec.MatchResources),
+			ValidationActions: convertSlice(in.Spec.ValidationActions, func(in *v1alpha1.ValidationAction) admissionregistrationv1alpha1types.ValidationAction {
+				return admissionregistrationv1alpha1types.ValidationAction(*in)
+			}),
+		},
+	}
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return out, nil
+}
+
+func nativeToCRDMatchResources(in *admissionregistrationv1alpha1types.MatchResources) *v1alpha1.MatchResources {
+	if in == nil {
+		return nil
+	}
+
+	return &v1alpha1.MatchResources{
+		NamespaceSelector:    in.NamespaceSelector.DeepCopy(),
+		ObjectSelector:       in.ObjectSelector.DeepCopy(),
+		ResourceRules:        convertSlice(in.ResourceRules, nativeToCRDNamedRule),
+		ExcludeResourceRules: convertSlice(in.ExcludeResourceRules, nativeToCRDNamedRule),
+		MatchPolicy:          (*v1alpha1.MatchPolicyType)(copyPointer(in.MatchPolicy)),
+	}
+}
+
+func crdToNativeMatchResources(in *v1alpha1.MatchResources) *admissionregistrationv1alpha1types.MatchResources {
+	if in == nil {
+		return nil
+	}
+
+	return &admissionregistrationv1alpha1types.MatchResources{
+		NamespaceSelector:    in.NamespaceSelector.DeepCopy(),
+		ObjectSelector:       in.ObjectSelector.DeepCopy(),
+		ResourceRules:        convertSlice(in.ResourceRules, crdToNativeNamedRule),
+		ExcludeResourceRules: convertSlice(in.ExcludeResourceRules, crdToNativeNamedRule),
+		MatchPolicy:          (*admissionregistrationv1alpha1types.MatchPolicyType)(copyPointer(in.MatchPolicy)),
+	}
+}
+
+func nativeToCRDNamedRule(in *admissionregistrationv1alpha1types.NamedRuleWithOperations) v1alpha1.NamedRuleWithOperations {
+	out := v1alpha1.NamedRuleWithOperations{
+		ResourceNames: copySlice(in.ResourceNames),
+	}
+	in.RuleWithOperations.DeepCopyInto(&out.RuleWithOperations)
+	return out
+}
+
+func crdToNativeNamedRule(in *v1alpha1.NamedRuleWithOperations) admissionregistrationv1alpha1types.NamedRuleWithOperations {
+	out := admissionregistrationv1alpha1types.NamedRuleWithOperations{
+		ResourceNames: copySlice(in.ResourceNames),
+	}
+	in.RuleWithOperations.DeepCopyInto(&out.RuleWithOperations)
+	return out
+}
+
+// convertTypeMeta sets the apiVersion to the converted group version, if it
+// was set at all. Objects read from informers have no type meta.
+func convertTypeMeta(in metav1.TypeMeta, apiVersion string) metav1.TypeMeta {
+	if len(in.APIVersion) > 0 {
+		in.APIVersion = apiVersion
+	}
+	return in
+}
+
+func copyConditions(in []metav1.Condition) []metav1.Condition {
+	return convertSlice(in, func(in *metav1.Condition) metav1.Condition {
+		var out metav1.Condition
+		in.DeepCopyInto(&out)
+		return out
+	})
+}
+
+// convertSlice converts each element of in, keeping nil slices nil
+func convertSlice[In any, Out any](in []In, convert func(*In) Out) []Out {
+	if in == nil {
+		return nil
+	}
+
+	out := make([]Out, len(in))
+	for i := range in {
+		out[i] = convert(&in[i])
+	}
+	return out
+}
+
+func copySlice[T any](in []T) []T {
+	if in == nil {
+		return nil
+	}
+	return append(make([]T, 0, len(in)), in...)
+}
+
+func copyPointer[T any](in *T) *T {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	return &out
+}
@@ -0,0 +1,138 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+
+	admissionregistrationv1alpha1types "k8s.io/api/admissionregistration/v1alpha1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1alpha1"
+)
+
+// Seeds run by go test. go test -fuzz explores further
+const fuzzSeeds = 200
+
+func newFuzzer(seed int64) *fuzz.Fuzzer {
+	return fuzz.NewWithSeed(seed).NilChance(0.2).NumElements(0, 3)
+}
+
+func FuzzPolicyRoundTrip(f *testing.F) {
+	for seed := int64(0); seed < fuzzSeeds; seed++ {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		fuzzer := newFuzzer(seed)
+
+		var native admissionregistrationv1alpha1types.ValidatingAdmissionPolicy
+		fuzzer.Fuzz(&native)
+		native.TypeMeta = metav1.TypeMeta{APIVersion: admissionregistrationv1alpha1types.SchemeGroupVersion.String(), Kind: "ValidatingAdmissionPolicy"}
+		original := native.DeepCopy()
+
+		crd, err := NativeToCRDPolicy(&native)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if crd.APIVersion != v1alpha1.SchemeGroupVersion.String() {
+			t.Errorf("expected apiVersion %s, got %s", v1alpha1.SchemeGroupVersion, crd.APIVersion)
+		}
+		roundTripped, err := CRDToNativePolicy(crd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !apiequality.Semantic.DeepEqual(original, roundTripped) {
+			t.Errorf("policy changed in round trip:\n%v\n%v", original, roundTripped)
+		}
+		if !apiequality.Semantic.DeepEqual(original, &native) {
+			t.Errorf("conversion modified its input")
+		}
+
+		var fromCRD v1alpha1.ValidatingAdmissionPolicy
+		fuzzer.Fuzz(&fromCRD)
+		fromCRD.TypeMeta = metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: "ValidatingAdmissionPolicy"}
+
+		converted, err := CRDToNativePolicy(&fromCRD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if converted.APIVersion != admissionregistrationv1alpha1types.SchemeGroupVersion.String() {
+			t.Errorf("expected apiVersion %s, got %s", admissionregistrationv1alpha1types.SchemeGroupVersion, converted.APIVersion)
+		}
+		crdRoundTripped, err := NativeToCRDPolicy(converted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !apiequality.Semantic.DeepEqual(&fromCRD, crdRoundTripped) {
+			t.Errorf("policy changed in round trip:\n%v\n%v", &fromCRD, crdRoundTripped)
+		}
+	})
+}
+
+func FuzzPolicyBindingRoundTrip(f *testing.F) {
+	for seed := int64(0); seed < fuzzSeeds; seed++ {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		fuzzer := newFuzzer(seed)
+
+		var native admissionregistrationv1alpha1types.ValidatingAdmissionPolicyBinding
+		fuzzer.Fuzz(&native)
+		native.TypeMeta = metav1.TypeMeta{APIVersion: admissionregistrationv1alpha1types.SchemeGroupVersion.String(), Kind: "ValidatingAdmissionPolicyBinding"}
+		original := native.DeepCopy()
+
+		crd, err := NativeToCRDPolicyBinding(&native)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if crd.APIVersion != v1alpha1.SchemeGroupVersion.String() {
+			t.Errorf("expected apiVersion %s, got %s", v1alpha1.SchemeGroupVersion, crd.APIVersion)
+		}
+		roundTripped, err := CRDToNativePolicyBinding(crd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !apiequality.Semantic.DeepEqual(original, roundTripped) {
+			t.Errorf("binding changed in round trip:\n%v\n%v", original, roundTripped)
+		}
+		if !apiequality.Semantic.DeepEqual(original, &native) {
+			t.Errorf("conversion modified its input")
+		}
+
+		var fromCRD v1alpha1.ValidatingAdmissionPolicyBinding
+		fuzzer.Fuzz(&fromCRD)
+		fromCRD.TypeMeta = metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: "ValidatingAdmissionPolicyBinding"}
+
+		converted, err := CRDToNativePolicyBinding(&fromCRD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if converted.APIVersion != admissionregistrationv1alpha1types.SchemeGroupVersion.String() {
+			t.Errorf("expected apiVersion %s, got %s", admissionregistrationv1alpha1types.SchemeGroupVersion, converted.APIVersion)
+		}
+		crdRoundTripped, err := NativeToCRDPolicyBinding(converted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !apiequality.Semantic.DeepEqual(&fromCRD, crdRoundTripped) {
+			t.Errorf("binding changed in round trip:\n%v\n%v", &fromCRD, crdRoundTripped)
+		}
+	})
+}
+
+func BenchmarkCRDToNativePolicy(b *testing.B) {
+	var policy v1alpha1.ValidatingAdmissionPolicy
+	fuzz.NewWithSeed(0).NilChance(0).NumElements(3, 3).Fuzz(&policy)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := CRDToNativePolicy(&policy); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionregistrationv1alpha1types "k8s.io/api/admissionregistration/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	admissionregistrationv1alpha1apply "k8s.io/client-go/applyconfigurations/admissionregistration/v1alpha1"
+	clienttesting "k8s.io/client-go/testing"
+
+	"k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1alpha1"
+	"k8s.io/cel-admission-webhook/pkg/controller"
+	"k8s.io/cel-admission-webhook/pkg/generated/clientset/versioned/fake"
+	admissionregistrationxclient "k8s.io/cel-admission-webhook/pkg/generated/clientset/versioned/typed/admissionregistration.x-k8s.io/v1alpha1"
+)
+
+// optionsRecorder records the options of patches, which the fake clientset
+// does not keep on its actions
+type optionsRecorder struct {
+	admissionregistrationxclient.ValidatingAdmissionPolicyInterface
+	patchOptions  []metav1.PatchOptions
+	updateOptions []metav1.UpdateOptions
+}
+
+func (r *optionsRecorder) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*v1alpha1.ValidatingAdmissionPolicy, error) {
+	r.patchOptions = append(r.patchOptions, opts)
+	return r.ValidatingAdmissionPolicyInterface.Patch(ctx, name, pt, data, opts, subresources...)
+}
+
+func (r *optionsRecorder) Update(ctx context.Context, object *v1alpha1.ValidatingAdmissionPolicy, opts metav1.UpdateOptions) (*v1alpha1.ValidatingAdmissionPolicy, error) {
+	r.updateOptions = append(r.updateOptions, opts)
+	return r.ValidatingAdmissionPolicyInterface.Update(ctx, object, opts)
+}
+
+func TestTransformedClientPatch(t *testing.T) {
+	failurePolicy := admissionregistrationv1alpha1types.Fail
+	forceTrue := true
+
+	for _, testCase := range []struct {
+		name string
+		call func(context.Context, transformedPolicyClient) (*admissionregistrationv1alpha1types.ValidatingAdmissionPolicy, error)
+
+		// Verb, patch type and subresource the replacement client should
+		// receive
+		verb        string
+		patchType   types.PatchType
+		subresource string
+
+		// Expected body sent to the replacement client, for patches
+		patch         string
+		patchOptions  *metav1.PatchOptions
+		updateOptions *metav1.UpdateOptions
+	}{
+		{
+			name: "merge patch",
+			call: func(ctx context.Context, c transformedPolicyClient) (*admissionregistrationv1alpha1types.ValidatingAdmissionPolicy, error) {
+				return c.Patch(ctx, "policy", types.MergePatchType, []byte(`{"apiVersion":"admissionregistration.k8s.io/v1alpha1","spec":{"failurePolicy":"Fail"}}`), metav1.PatchOptions{FieldManager: "test"})
+			},
+			verb:         "patch",
+			patchType:    types.MergePatchType,
+			patch:        `{"apiVersion":"admissionregistration.x-k8s.io/v1alpha1","spec":{"failurePolicy":"Fail"}}`,
+			patchOptions: &metav1.PatchOptions{FieldManager: "test"},
+		},
+		{
+			name: "json patch",
+			call: func(ctx context.Context, c transformedPolicyClient) (*admissionregistrationv1alpha1types.ValidatingAdmissionPolicy, error) {
+				return c.Patch(ctx, "policy", types.JSONPatchType, []byte(`[{"op":"replace","path":"/apiVersion","value":"admissionregistration.k8s.io/v1alpha1"},{"op":"add","path":"/spec/failurePolicy","value":"Fail"}]`), metav1.PatchOptions{})
+			},
+			verb:      "patch",
+			patchType: types.JSONPatchType,
+			patch:     `[{"op":"replace","path":"/apiVersion","value":"admissionregistration.x-k8s.io/v1alpha1"},{"op":"add","path":"/spec/failurePolicy","value":"Fail"}]`,
+		},
+		{
+			name: "strategic merge patch is applied as an update",
+			call: func(ctx context.Context, c transformedPolicyClient) (*admissionregistrationv1alpha1types.ValidatingAdmissionPolicy, error) {
+				return c.Patch(ctx, "policy", types.StrategicMergePatchType, []byte(`{"spec":{"failurePolicy":"Fail"}}`), metav1.PatchOptions{FieldManager: "test"})
+			},
+			verb:          "update",
+			updateOptions: &metav1.UpdateOptions{FieldManager: "test"},
+		},
+		{
+			name: "apply",
+			call: func(ctx context.Context, c transformedPolicyClient) (*admissionregistrationv1alpha1types.ValidatingAdmissionPolicy, error) {
+				return c.Apply(ctx, admissionregistrationv1alpha1apply.ValidatingAdmissionPolicy("policy").
+					WithSpec(admissionregistrationv1alpha1apply.ValidatingAdmissionPolicySpec().WithFailurePolicy(failurePolicy)),
+					metav1.ApplyOptions{FieldManager: "test", Force: true})
+			},
+			verb:         "patch",
+			patchType:    types.ApplyPatchType,
+			patch:        `{"apiVersion":"admissionregistration.x-k8s.io/v1alpha1","kind":"ValidatingAdmissionPolicy","metadata":{"name":"policy"},"spec":{"failurePolicy":"Fail"}}`,
+			patchOptions: &metav1.PatchOptions{FieldManager: "test", Force: &forceTrue},
+		},
+		{
+			name: "apply status",
+			call: func(ctx context.Context, c transformedPolicyClient) (*admissionregistrationv1alpha1types.ValidatingAdmissionPolicy, error) {
+				return c.ApplyStatus(ctx, admissionregistrationv1alpha1apply.ValidatingAdmissionPolicy("policy").
+					WithStatus(admissionregistrationv1alpha1apply.ValidatingAdmissionPolicyStatus().WithObservedGeneration(1)),
+					metav1.ApplyOptions{FieldManager: "status-writer"})
+			},
+			verb:         "patch",
+			patchType:    types.ApplyPatchType,
+			subresource:  "status",
+			patch:        `{"apiVersion":"admissionregistration.x-k8s.io/v1alpha1","kind":"ValidatingAdmissionPolicy","metadata":{"name":"policy"},"status":{"observedGeneration":1}}`,
+			patchOptions: &metav1.PatchOptions{FieldManager: "status-writer", Force: new(bool)},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := context.Background()
+			clientset := fake.NewSimpleClientset(&v1alpha1.ValidatingAdmissionPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "policy"},
+			})
+			recorder := &optionsRecorder{ValidatingAdmissionPolicyInterface: clientset.AdmissionregistrationV1alpha1().ValidatingAdmissionPolicies()}
+			client := newTransformedPolicyClient(recorder)
+			clientset.ClearActions()
+
+			result, err := testCase.call(ctx, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Name != "policy" {
+				t.Errorf("expected result to be converted to the native policy, got %v", result)
+			}
+
+			var action clienttesting.Action
+			for _, a := range clientset.Actions() {
+				if a.GetVerb() == testCase.verb {
+					action = a
+				} else if a.GetVerb() != "get" {
+					t.Errorf("unexpected %s", a.GetVerb())
+				}
+			}
+			if action == nil {
+				t.Fatalf("expected a %s, got %v", testCase.verb, clientset.Actions())
+			}
+			if action.GetSubresource() != testCase.subresource {
+				t.Errorf("expected subresource %q, got %q", testCase.subresource, action.GetSubresource())
+			}
+
+			switch action := action.(type) {
+			case clienttesting.PatchAction:
+				if action.GetPatchType() != testCase.patchType {
+					t.Errorf("expected patch type %s, got %s", testCase.patchType, action.GetPatchType())
+				}
+				assertJSONEqual(t, testCase.patch, string(action.GetPatch()))
+			case clienttesting.UpdateAction:
+				updated := action.GetObject().(*v1alpha1.ValidatingAdmissionPolicy)
+				if updated.Spec.FailurePolicy == nil || *updated.Spec.FailurePolicy != v1alpha1.Fail {
+					t.Errorf("expected patch to be applied, got %v", updated.Spec)
+				}
+			}
+
+			if testCase.patchOptions != nil {
+				assertJSONEqual(t, marshal(t, testCase.patchOptions), marshal(t, recorder.patchOptions[0]))
+			}
+			if testCase.updateOptions != nil {
+				assertJSONEqual(t, marshal(t, testCase.updateOptions), marshal(t, recorder.updateOptions[0]))
+			}
+		})
+	}
+}
+
+type transformedPolicyClient = controller.TransformedClient[
+	admissionregistrationv1alpha1types.ValidatingAdmissionPolicy, admissionregistrationv1alpha1types.ValidatingAdmissionPolicyList, admissionregistrationv1alpha1apply.ValidatingAdmissionPolicyApplyConfiguration,
+	v1alpha1.ValidatingAdmissionPolicy, v1alpha1.ValidatingAdmissionPolicyList, any]
+
+func newTransformedPolicyClient(replacement admissionregistrationxclient.ValidatingAdmissionPolicyInterface) transformedPolicyClient {
+	return transformedPolicyClient{
+		ReplacementClient:       replacement,
+		To:                      CRDToNativePolicy,
+		From:                    NativeToCRDPolicy,
+		TargetGroupVersion:      admissionregistrationv1alpha1types.SchemeGroupVersion,
+		ReplacementGroupVersion: v1alpha1.SchemeGroupVersion,
+	}
+}
+
+func marshal(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func assertJSONEqual(t *testing.T, expected, actual string) {
+	t.Helper()
+	var expectedValue, actualValue interface{}
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(actual), &actualValue); err != nil {
+		t.Fatal(err)
+	}
+	if marshal(t, expectedValue) != marshal(t, actualValue) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
@@ -0,0 +1,107 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"time"
+
+	admissionregistrationv1alpha1types "k8s.io/api/admissionregistration/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	xv1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1"
+	"k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1alpha1"
+	"k8s.io/cel-admission-webhook/pkg/controller"
+	"k8s.io/cel-admission-webhook/pkg/conversion"
+	"k8s.io/cel-admission-webhook/pkg/generated/clientset/versioned"
+	admissionregistrationxinformers "k8s.io/cel-admission-webhook/pkg/generated/informers/externalversions/admissionregistration.x-k8s.io/v1"
+)
+
+// InjectInformers registers informers for the native ValidatingAdmissionPolicy
+// and ValidatingAdmissionPolicyBinding types with factory, which watch the
+// admissionregistration.x-k8s.io CRDs through customClient. The informers and
+// listers the factory returns for those types then serve native objects
+// converted from the CRDs.
+//
+// The CRDs are watched at v1, their storage version, and converted to v1alpha1
+// in process. Watching v1alpha1 would have the apiserver call the polyfill's
+// own conversion webhook, which can not answer until the polyfill has synced
+// its informers. Policy status is still written through v1alpha1, but only
+// once the webhook is serving, and failures to write it are ignored.
+//
+// Must be called before the factory is first asked for either informer.
+func InjectInformers(factory informers.SharedInformerFactory, customClient versioned.Interface) error {
+	for _, injected := range []struct {
+		obj      runtime.Object
+		informer func(time.Duration) cache.SharedIndexInformer
+	}{
+		{
+			obj: &admissionregistrationv1alpha1types.ValidatingAdmissionPolicy{},
+			informer: func(resyncPeriod time.Duration) cache.SharedIndexInformer {
+				informer, err := controller.NewTransformedInformer(
+					admissionregistrationxinformers.NewValidatingAdmissionPolicyInformer(customClient, resyncPeriod, cache.Indexers{}),
+					func(in *xv1.ValidatingAdmissionPolicy) (*admissionregistrationv1alpha1types.ValidatingAdmissionPolicy, error) {
+						out := &v1alpha1.ValidatingAdmissionPolicy{}
+						if err := fromStorageVersion(in, "ValidatingAdmissionPolicy", out); err != nil {
+							return nil, err
+						}
+						return CRDToNativePolicy(out)
+					},
+				)
+				// A new informer can always be given a transform
+				utilruntime.Must(err)
+				return informer
+			},
+		},
+		{
+			obj: &admissionregistrationv1alpha1types.ValidatingAdmissionPolicyBinding{},
+			informer: func(resyncPeriod time.Duration) cache.SharedIndexInformer {
+				informer, err := controller.NewTransformedInformer(
+					admissionregistrationxinformers.NewValidatingAdmissionPolicyBindingInformer(customClient, resyncPeriod, cache.Indexers{}),
+					func(in *xv1.ValidatingAdmissionPolicyBinding) (*admissionregistrationv1alpha1types.ValidatingAdmissionPolicyBinding, error) {
+						out := &v1alpha1.ValidatingAdmissionPolicyBinding{}
+						if err := fromStorageVersion(in, "ValidatingAdmissionPolicyBinding", out); err != nil {
+							return nil, err
+						}
+						return CRDToNativePolicyBinding(out)
+					},
+				)
+				utilruntime.Must(err)
+				return informer
+			},
+		},
+	} {
+		injected := injected
+		created := false
+		factory.InformerFor(injected.obj, func(_ kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+			created = true
+			return injected.informer(resyncPeriod)
+		})
+		if !created {
+			return fmt.Errorf("informer for %T was already created by the factory", injected.obj)
+		}
+	}
+	return nil
+}
+
+// fromStorageVersion converts a v1 policy or binding of the given kind to
+// v1alpha1 the same way the conversion webhook does
+func fromStorageVersion(in runtime.Object, kind string, out runtime.Object) error {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(in)
+	if err != nil {
+		return err
+	}
+
+	// Objects from informers have no type meta
+	u := &unstructured.Unstructured{Object: obj}
+	u.SetGroupVersionKind(xv1.SchemeGroupVersion.WithKind(kind))
+
+	converted, err := conversion.Convert(u, v1alpha1.SchemeGroupVersion)
+	if err != nil {
+		return err
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(converted.Object, out)
+}
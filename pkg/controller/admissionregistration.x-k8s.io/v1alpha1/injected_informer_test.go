@@ -0,0 +1,124 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	admissionregistrationv1alpha1types "k8s.io/api/admissionregistration/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	xv1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1"
+	"k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1alpha1"
+	"k8s.io/cel-admission-webhook/pkg/conversion"
+	"k8s.io/cel-admission-webhook/pkg/generated/clientset/versioned/fake"
+)
+
+func TestInjectInformers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failurePolicy := xv1.Fail
+	customClient := fake.NewSimpleClientset(
+		&xv1.ValidatingAdmissionPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "policy"},
+			Spec:       xv1.ValidatingAdmissionPolicySpec{FailurePolicy: &failurePolicy},
+		},
+		&xv1.ValidatingAdmissionPolicyBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "binding"},
+			Spec: xv1.ValidatingAdmissionPolicyBindingSpec{
+				PolicyName: "policy",
+				ParamRef: &xv1.ParamRef{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "a"}},
+				},
+			},
+		},
+	)
+	// Reading v1alpha1 would depend on the polyfill's own conversion
+	// webhook, since v1 is the storage version
+	customClient.PrependReactor("*", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetResource().Version == v1alpha1.SchemeGroupVersion.Version {
+			t.Errorf("unexpected %s of %v", action.GetVerb(), action.GetResource())
+		}
+		return false, nil, nil
+	})
+	factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+	if err := InjectInformers(factory, customClient); err != nil {
+		t.Fatal(err)
+	}
+
+	policies := factory.Admissionregistration().V1alpha1().ValidatingAdmissionPolicies()
+	bindings := factory.Admissionregistration().V1alpha1().ValidatingAdmissionPolicyBindings()
+
+	added := make(chan interface{}, 10)
+	policies.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { added <- obj },
+	})
+
+	factory.Start(ctx.Done())
+	for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			t.Fatalf("informer for %v did not sync", informerType)
+		}
+	}
+
+	policy, err := policies.Lister().Get("policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Spec.FailurePolicy == nil || *policy.Spec.FailurePolicy != admissionregistrationv1alpha1types.Fail {
+		t.Errorf("expected policy to be converted, got %v", policy.Spec)
+	}
+
+	binding, err := bindings.Lister().Get("binding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binding.Spec.PolicyName != "policy" {
+		t.Errorf("expected binding to be converted, got %v", binding.Spec)
+	}
+	// Fields v1alpha1 does not have are kept as they are by the conversion
+	// webhook
+	if paramRef, err := conversion.ParamRef(binding); err != nil {
+		t.Fatal(err)
+	} else if paramRef == nil || paramRef.Selector == nil || paramRef.Selector.MatchLabels["app"] != "a" {
+		t.Errorf("expected binding to keep its selector, got %v", binding.Annotations)
+	}
+
+	if _, err := customClient.AdmissionregistrationV1().ValidatingAdmissionPolicies().Create(ctx, &xv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "created"},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Handlers receive native objects for both the initial list and watch
+	// events
+	names := map[string]bool{}
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 10*time.Second, true, func(ctx context.Context) (bool, error) {
+		for {
+			select {
+			case obj := <-added:
+				native, ok := obj.(*admissionregistrationv1alpha1types.ValidatingAdmissionPolicy)
+				if !ok {
+					t.Fatalf("expected a native policy, got %T", obj)
+				}
+				names[native.Name] = true
+			default:
+				return names["policy"] && names["created"], nil
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("expected add events for both policies, got %v", names)
+	}
+
+	if err := InjectInformers(factory, customClient); err == nil {
+		t.Error("expected an error injecting informers into a factory which already has them")
+	}
+}
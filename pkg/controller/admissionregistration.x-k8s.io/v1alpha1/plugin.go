@@ -8,16 +8,19 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apiserver/pkg/admission"
-	"k8s.io/apiserver/pkg/admission/plugin/validatingadmissionpolicy"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 	"k8s.io/apiserver/pkg/cel/openapi/resolver"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+
+	"k8s.io/cel-admission-webhook/pkg/validatingadmissionpolicy"
 )
 
 type ValidationInterface interface {
 	admission.ValidationInterface
+	validatingadmissionpolicy.Explainer
+	validatingadmissionpolicy.Inspector
 	Run(context.Context) error
 	HasSynced() bool
 }
@@ -93,6 +96,26 @@ func (c *celAdmissionPlugin) Validate(
 	return c.evaluator.Validate(ctx, a, o)
 }
 
+func (c *celAdmissionPlugin) Explain(
+	ctx context.Context,
+	a admission.Attributes,
+	o admission.ObjectInterfaces,
+) (*validatingadmissionpolicy.Explanation, error) {
+	if isPolicyResource(a) {
+		return &validatingadmissionpolicy.Explanation{Allowed: true, Message: "policies and bindings are not validated"}, nil
+	}
+
+	if !c.HasSynced() {
+		return nil, fmt.Errorf("not yet ready to handle request")
+	}
+
+	return c.evaluator.(validatingadmissionpolicy.Explainer).Explain(ctx, a, o)
+}
+
+func (c *celAdmissionPlugin) Inspect() *validatingadmissionpolicy.Snapshot {
+	return c.evaluator.(validatingadmissionpolicy.Inspector).Inspect()
+}
+
 func isPolicyResource(attr admission.Attributes) bool {
 	gvk := attr.GetResource()
 	if gvk.Group == "admissionregistration.k8s.io" || gvk.Group == "admissionregistration.x-k8s.io" {
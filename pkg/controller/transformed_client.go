@@ -2,14 +2,22 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"regexp"
+	"strings"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
 )
 
 type TransformedClient[T any, TList any, TApplyConfiguration any, R any, RList any, RApplyConfiguration any] struct {
@@ -18,8 +26,15 @@ type TransformedClient[T any, TList any, TApplyConfiguration any, R any, RList a
 
 	To   func(*R) (*T, error)
 	From func(*T) (*R, error)
+
+	// Group versions of the target and replacement types, used to translate
+	// the apiVersion in patches and apply configurations
+	TargetGroupVersion      schema.GroupVersion
+	ReplacementGroupVersion schema.GroupVersion
 }
 
+var managedFieldsAPIVersionPath = regexp.MustCompile(`^/metadata/managedFields/[^/]+/apiVersion$`)
+
 func (c TransformedClient[T, TList, TApplyConfiguration, R, RList, RApplyConfiguration]) Create(ctx context.Context, object *T, opts metav1.CreateOptions) (*T, error) {
 	converted, err := c.From(object)
 	if err != nil {
@@ -143,19 +158,168 @@ func (c TransformedClient[T, TList, TApplyConfiguration, R, RList, RApplyConfigu
 	}), nil
 }
 
-// Ideally your replacement type is JSON compatible with your target type
-// in case of validatingadmissionpolicy polyfill that is true.
-// If we ever need this we can do something about it
+// Patch translates the apiVersion of the patch body from the target to the
+// replacement group before sending it to the replacement client. CRDs do not
+// support strategic merge patches, so those are applied to the current object
+// on the client side and written back with an update.
 func (c TransformedClient[T, TList, TApplyConfiguration, R, RList, RApplyConfiguration]) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (result *T, err error) {
-	panic("transform patch unsupported")
+	if pt == types.StrategicMergePatchType {
+		return c.strategicMergePatch(ctx, name, data, opts, subresources...)
+	}
+
+	translated, err := c.translatePatch(pt, data)
+	if err != nil {
+		return nil, err
+	}
+
+	replacementValue, err := c.ReplacementClient.Patch(ctx, name, pt, translated, opts, subresources...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.To(replacementValue)
 }
 
 func (c TransformedClient[T, TList, TApplyConfiguration, R, RList, RApplyConfiguration]) Apply(ctx context.Context, object *TApplyConfiguration, opts metav1.ApplyOptions) (result *T, err error) {
-	panic("transform apply unsupported")
+	return c.apply(ctx, object, opts)
 }
 
 func (c TransformedClient[T, TList, TApplyConfiguration, R, RList, RApplyConfiguration]) ApplyStatus(ctx context.Context, object *TApplyConfiguration, opts metav1.ApplyOptions) (result *T, err error) {
-	panic("transform applystatus unsupported")
+	return c.apply(ctx, object, opts, "status")
+}
+
+// apply sends the apply configuration to the replacement client as an apply
+// patch, the same way the typed clients implement Apply
+func (c TransformedClient[T, TList, TApplyConfiguration, R, RList, RApplyConfiguration]) apply(ctx context.Context, object *TApplyConfiguration, opts metav1.ApplyOptions, subresources ...string) (*T, error) {
+	if object == nil {
+		return nil, fmt.Errorf("apply configuration provided to Apply must not be nil")
+	}
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	} else if len(meta.Metadata.Name) == 0 {
+		return nil, fmt.Errorf("apply configuration.Name must be provided to Apply")
+	}
+
+	return c.Patch(ctx, meta.Metadata.Name, types.ApplyPatchType, data, opts.ToPatchOptions(), subresources...)
+}
+
+func (c TransformedClient[T, TList, TApplyConfiguration, R, RList, RApplyConfiguration]) strategicMergePatch(ctx context.Context, name string, data []byte, opts metav1.PatchOptions, subresources ...string) (*T, error) {
+	var status bool
+	switch strings.Join(subresources, "/") {
+	case "":
+	case "status":
+		status = true
+	default:
+		return nil, fmt.Errorf("strategic merge patch of subresource %q unsupported", strings.Join(subresources, "/"))
+	}
+
+	updateOpts := metav1.UpdateOptions{
+		DryRun:          opts.DryRun,
+		FieldManager:    opts.FieldManager,
+		FieldValidation: opts.FieldValidation,
+	}
+
+	var result *T
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := c.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		original, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+
+		patched, err := strategicpatch.StrategicMergePatch(original, data, new(T))
+		if err != nil {
+			return apierrors.NewBadRequest(err.Error())
+		}
+
+		var object T
+		if err := json.Unmarshal(patched, &object); err != nil {
+			return apierrors.NewBadRequest(err.Error())
+		}
+
+		// Updates use the resourceVersion of the object the patch was applied
+		// to, so that a concurrent write is retried rather than overwritten
+		if status {
+			result, err = c.UpdateStatus(ctx, &object, updateOpts)
+		} else {
+			result, err = c.Update(ctx, &object, updateOpts)
+		}
+		return err
+	})
+	return result, err
+}
+
+// translatePatch rewrites references to the target group version in a patch
+// body to the replacement group version
+func (c TransformedClient[T, TList, TApplyConfiguration, R, RList, RApplyConfiguration]) translatePatch(pt types.PatchType, data []byte) ([]byte, error) {
+	target, replacement := c.TargetGroupVersion.String(), c.ReplacementGroupVersion.String()
+	if target == replacement {
+		return data, nil
+	}
+
+	translate := func(value interface{}) interface{} {
+		if value == target {
+			return replacement
+		}
+		return value
+	}
+
+	switch pt {
+	case types.JSONPatchType:
+		var operations []map[string]interface{}
+		if err := json.Unmarshal(data, &operations); err != nil {
+			return nil, apierrors.NewBadRequest(err.Error())
+		}
+		for _, operation := range operations {
+			if path, _ := operation["path"].(string); path == "/apiVersion" || managedFieldsAPIVersionPath.MatchString(path) {
+				operation["value"] = translate(operation["value"])
+			}
+		}
+		return json.Marshal(operations)
+	case types.MergePatchType, types.ApplyPatchType:
+		// Apply patches may be YAML
+		asJSON, err := yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, apierrors.NewBadRequest(err.Error())
+		}
+
+		var object map[string]interface{}
+		if err := json.Unmarshal(asJSON, &object); err != nil {
+			return nil, apierrors.NewBadRequest(err.Error())
+		}
+		if apiVersion, ok := object["apiVersion"]; ok {
+			object["apiVersion"] = translate(apiVersion)
+		}
+		if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+			if managedFields, ok := metadata["managedFields"].([]interface{}); ok {
+				for _, entry := range managedFields {
+					if entry, ok := entry.(map[string]interface{}); ok {
+						if apiVersion, ok := entry["apiVersion"]; ok {
+							entry["apiVersion"] = translate(apiVersion)
+						}
+					}
+				}
+			}
+		}
+		return json.Marshal(object)
+	default:
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("unsupported patch type %q", pt))
+	}
 }
 
 // Given a list of []V and the type of a List type with Items field []V,
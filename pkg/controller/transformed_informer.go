@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewTransformedInformer converts the objects of an informer for the
+// replacement type R to the target type T as they are received, so that the
+// informer's store, listers and event handlers only ever see T. Each object
+// is converted once per event rather than on every read.
+//
+// The informer must not have been started, and must not be given another
+// transform.
+func NewTransformedInformer[T any, R any](informer cache.SharedIndexInformer, to func(*R) (*T, error)) (cache.SharedIndexInformer, error) {
+	err := informer.SetTransform(func(obj interface{}) (interface{}, error) {
+		switch typed := obj.(type) {
+		case *R:
+			return to(typed)
+		case *T, cache.DeletedFinalStateUnknown:
+			// Objects already in the store may be passed through the
+			// transform again when the informer relists, on their own or
+			// in a tombstone
+			return typed, nil
+		default:
+			return nil, fmt.Errorf("unexpected object of type %T", obj)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return informer, nil
+}
@@ -0,0 +1,263 @@
+package conversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	v1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1"
+	"k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1alpha1"
+)
+
+// Annotation keeping the fields of v1beta1 and v1 which v1alpha1 does not
+// have, so that they survive a round trip through v1alpha1. Its value is a
+// JSON object of the dropped fields keyed by their path.
+const DroppedFieldsAnnotation = "admissionregistration.x-k8s.io/v1alpha1-dropped-fields"
+
+// Versions of admissionregistration.x-k8s.io, oldest first. v1beta1 and v1
+// have the same schema.
+var Versions = []string{"v1alpha1", "v1beta1", "v1"}
+
+// Fields of each kind which v1alpha1 does not have
+var droppedFields = map[string][][]string{
+	"ValidatingAdmissionPolicy": {
+		{"spec", "variables"},
+	},
+	"ValidatingAdmissionPolicyBinding": {
+		{"spec", "paramRef", "selector"},
+		{"spec", "paramRef", "parameterNotFoundAction"},
+	},
+}
+
+// Fields v1alpha1 does have which are mutually exclusive with a dropped field.
+// If one was set through v1alpha1, the dropped field is not restored.
+var exclusiveFields = map[string][]string{
+	"spec.paramRef.selector": {"spec", "paramRef", "name"},
+}
+
+// Convert converts a policy or binding of any version of
+// admissionregistration.x-k8s.io to gv. obj is not modified.
+func Convert(obj *unstructured.Unstructured, gv schema.GroupVersion) (*unstructured.Unstructured, error) {
+	from := obj.GroupVersionKind()
+	if from.Group != v1alpha1.GroupName || gv.Group != v1alpha1.GroupName {
+		return nil, fmt.Errorf("can not convert %s to %s, only %s is supported", from.GroupVersion(), gv, v1alpha1.GroupName)
+	} else if _, ok := droppedFields[from.Kind]; !ok {
+		return nil, fmt.Errorf("unsupported kind %q", from.Kind)
+	} else if !supported(from.Version) {
+		return nil, fmt.Errorf("unsupported version %q", from.Version)
+	} else if !supported(gv.Version) {
+		return nil, fmt.Errorf("unsupported version %q", gv.Version)
+	}
+
+	converted := obj.DeepCopy()
+	converted.SetAPIVersion(gv.String())
+
+	switch {
+	case from.Version == gv.Version:
+	case gv.Version == v1alpha1.SchemeGroupVersion.Version:
+		if err := dropFields(converted, droppedFields[from.Kind]); err != nil {
+			return nil, err
+		}
+	case from.Version == v1alpha1.SchemeGroupVersion.Version:
+		if err := restoreFields(converted); err != nil {
+			return nil, err
+		}
+	}
+	return converted, nil
+}
+
+func supported(version string) bool {
+	for _, v := range Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// dropFields removes the fields v1alpha1 does not have from obj, keeping them
+// in DroppedFieldsAnnotation
+func dropFields(obj *unstructured.Unstructured, fields [][]string) error {
+	dropped := map[string]interface{}{}
+	for _, path := range fields {
+		value, found, err := unstructured.NestedFieldNoCopy(obj.Object, path...)
+		if err != nil {
+			return err
+		} else if !found || value == nil {
+			continue
+		}
+		dropped[fieldPath(path)] = value
+		unstructured.RemoveNestedField(obj.Object, path...)
+	}
+
+	annotations := obj.GetAnnotations()
+	delete(annotations, DroppedFieldsAnnotation)
+	if len(dropped) > 0 {
+		data, err := json.Marshal(dropped)
+		if err != nil {
+			return err
+		}
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[DroppedFieldsAnnotation] = string(data)
+	}
+	setAnnotations(obj, annotations)
+	return nil
+}
+
+// restoreFields sets the fields kept in DroppedFieldsAnnotation back on obj.
+// Fields are only restored if their parent still exists and neither they nor
+// a field they are exclusive with have been set since, as the object may
+// have been changed through v1alpha1.
+func restoreFields(obj *unstructured.Unstructured) error {
+	annotations := obj.GetAnnotations()
+	value, ok := annotations[DroppedFieldsAnnotation]
+	if !ok {
+		return nil
+	}
+	delete(annotations, DroppedFieldsAnnotation)
+	setAnnotations(obj, annotations)
+
+	var dropped map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &dropped); err != nil {
+		return fmt.Errorf("invalid %s annotation: %w", DroppedFieldsAnnotation, err)
+	}
+
+	for _, path := range droppedFields[obj.GetKind()] {
+		value, ok := dropped[fieldPath(path)]
+		if !ok {
+			continue
+		}
+		if exclusive, ok := exclusiveFields[fieldPath(path)]; ok {
+			if value, found, _ := unstructured.NestedFieldNoCopy(obj.Object, exclusive...); found && value != nil && value != "" {
+				continue
+			}
+		}
+
+		parent, found, err := unstructured.NestedFieldNoCopy(obj.Object, path[:len(path)-1]...)
+		if err != nil {
+			return err
+		}
+		parentMap, ok := parent.(map[string]interface{})
+		if !found || !ok {
+			continue
+		} else if _, exists := parentMap[path[len(path)-1]]; exists {
+			continue
+		}
+		parentMap[path[len(path)-1]] = value
+	}
+	return nil
+}
+
+// Variables returns the spec.variables a v1alpha1 policy was converted
+// without, if any
+func Variables(obj metav1.Object) ([]v1.Variable, error) {
+	var variables []v1.Variable
+	if _, err := droppedField(obj, []string{"spec", "variables"}, &variables); err != nil {
+		return nil, err
+	}
+	return variables, nil
+}
+
+// ParamRef returns the spec.paramRef fields a v1alpha1 binding was converted
+// without, or nil if it had none. Only Selector and ParameterNotFoundAction
+// are set.
+func ParamRef(obj metav1.Object) (*v1.ParamRef, error) {
+	paramRef := &v1.ParamRef{}
+	hasSelector, err := droppedField(obj, []string{"spec", "paramRef", "selector"}, &paramRef.Selector)
+	if err != nil {
+		return nil, err
+	}
+	hasAction, err := droppedField(obj, []string{"spec", "paramRef", "parameterNotFoundAction"}, &paramRef.ParameterNotFoundAction)
+	if err != nil {
+		return nil, err
+	}
+	if !hasSelector && !hasAction {
+		return nil, nil
+	}
+	return paramRef, nil
+}
+
+// droppedField decodes the field at path kept in DroppedFieldsAnnotation
+// into out, returning whether it was found
+func droppedField(obj metav1.Object, path []string, out interface{}) (bool, error) {
+	value, ok := obj.GetAnnotations()[DroppedFieldsAnnotation]
+	if !ok {
+		return false, nil
+	}
+
+	var dropped map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &dropped); err != nil {
+		return false, fmt.Errorf("invalid %s annotation: %w", DroppedFieldsAnnotation, err)
+	}
+	data, ok := dropped[fieldPath(path)]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return false, fmt.Errorf("invalid %s in %s annotation: %w", fieldPath(path), DroppedFieldsAnnotation, err)
+	}
+	return true, nil
+}
+
+func setAnnotations(obj *unstructured.Unstructured, annotations map[string]string) {
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "annotations")
+		return
+	}
+	obj.SetAnnotations(annotations)
+}
+
+func fieldPath(path []string) string {
+	return strings.Join(path, ".")
+}
+
+// Review converts the objects of a ConversionReview request. The conversion
+// fails as a whole if any of the objects can not be converted.
+func Review(request *apiextensionsv1.ConversionRequest) *apiextensionsv1.ConversionResponse {
+	response := &apiextensionsv1.ConversionResponse{UID: request.UID}
+
+	gv, err := schema.ParseGroupVersion(request.DesiredAPIVersion)
+	if err != nil {
+		response.Result = failure(err)
+		return response
+	}
+
+	for i, raw := range request.Objects {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(raw.Raw); err != nil {
+			response.Result = failure(fmt.Errorf("object %d: %w", i, err))
+			response.ConvertedObjects = nil
+			return response
+		}
+
+		converted, err := Convert(obj, gv)
+		if err != nil {
+			response.Result = failure(fmt.Errorf("%s %q: %w", obj.GetKind(), obj.GetName(), err))
+			response.ConvertedObjects = nil
+			return response
+		}
+
+		data, err := converted.MarshalJSON()
+		if err != nil {
+			response.Result = failure(err)
+			response.ConvertedObjects = nil
+			return response
+		}
+		response.ConvertedObjects = append(response.ConvertedObjects, runtime.RawExtension{Raw: data})
+	}
+
+	response.Result = metav1.Status{Status: metav1.StatusSuccess}
+	return response
+}
+
+func failure(err error) metav1.Status {
+	return metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+}
@@ -0,0 +1,283 @@
+package conversion
+
+import (
+	"encoding/json"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func gv(version string) schema.GroupVersion {
+	return schema.GroupVersion{Group: "admissionregistration.x-k8s.io", Version: version}
+}
+
+func parse(t *testing.T, data string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func assertJSONEqual(t *testing.T, expected string, actual *unstructured.Unstructured) {
+	t.Helper()
+	var expectedObj interface{}
+	if err := json.Unmarshal([]byte(expected), &expectedObj); err != nil {
+		t.Fatal(err)
+	}
+	expectedData, _ := json.Marshal(expectedObj)
+	actualData, _ := json.Marshal(actual.Object)
+	if string(expectedData) != string(actualData) {
+		t.Errorf("expected %s, got %s", expectedData, actualData)
+	}
+}
+
+const (
+	policyV1 = `{
+		"apiVersion": "admissionregistration.x-k8s.io/v1",
+		"kind": "ValidatingAdmissionPolicy",
+		"metadata": {"name": "policy", "annotations": {"team": "a"}},
+		"spec": {
+			"variables": [{"name": "replicas", "expression": "object.spec.replicas"}],
+			"validations": [{"expression": "variables.replicas < 5"}]
+		}
+	}`
+
+	bindingV1 = `{
+		"apiVersion": "admissionregistration.x-k8s.io/v1",
+		"kind": "ValidatingAdmissionPolicyBinding",
+		"metadata": {"name": "binding"},
+		"spec": {
+			"policyName": "policy",
+			"paramRef": {"namespace": "default", "selector": {"matchLabels": {"app": "a"}}, "parameterNotFoundAction": "Allow"}
+		}
+	}`
+)
+
+func TestConvert(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		input    string
+		version  string
+		expected string
+
+		// Whether converting back does not give the input
+		lossy bool
+	}{
+		{
+			name:    "policy to v1alpha1",
+			input:   policyV1,
+			version: "v1alpha1",
+			expected: `{
+				"apiVersion": "admissionregistration.x-k8s.io/v1alpha1",
+				"kind": "ValidatingAdmissionPolicy",
+				"metadata": {"name": "policy", "annotations": {
+					"team": "a",
+					"admissionregistration.x-k8s.io/v1alpha1-dropped-fields": "{\"spec.variables\":[{\"expression\":\"object.spec.replicas\",\"name\":\"replicas\"}]}"
+				}},
+				"spec": {"validations": [{"expression": "variables.replicas < 5"}]}
+			}`,
+		},
+		{
+			name:    "binding to v1alpha1",
+			input:   bindingV1,
+			version: "v1alpha1",
+			expected: `{
+				"apiVersion": "admissionregistration.x-k8s.io/v1alpha1",
+				"kind": "ValidatingAdmissionPolicyBinding",
+				"metadata": {"name": "binding", "annotations": {
+					"admissionregistration.x-k8s.io/v1alpha1-dropped-fields": "{\"spec.paramRef.parameterNotFoundAction\":\"Allow\",\"spec.paramRef.selector\":{\"matchLabels\":{\"app\":\"a\"}}}"
+				}},
+				"spec": {"policyName": "policy", "paramRef": {"namespace": "default"}}
+			}`,
+		},
+		{
+			name:    "policy to v1beta1",
+			input:   policyV1,
+			version: "v1beta1",
+			expected: `{
+				"apiVersion": "admissionregistration.x-k8s.io/v1beta1",
+				"kind": "ValidatingAdmissionPolicy",
+				"metadata": {"name": "policy", "annotations": {"team": "a"}},
+				"spec": {
+					"variables": [{"name": "replicas", "expression": "object.spec.replicas"}],
+					"validations": [{"expression": "variables.replicas < 5"}]
+				}
+			}`,
+		},
+		{
+			name: "v1alpha1 without annotation",
+			input: `{
+				"apiVersion": "admissionregistration.x-k8s.io/v1alpha1",
+				"kind": "ValidatingAdmissionPolicyBinding",
+				"metadata": {"name": "binding"},
+				"spec": {"policyName": "policy", "paramRef": {"name": "params"}}
+			}`,
+			version: "v1",
+			expected: `{
+				"apiVersion": "admissionregistration.x-k8s.io/v1",
+				"kind": "ValidatingAdmissionPolicyBinding",
+				"metadata": {"name": "binding"},
+				"spec": {"policyName": "policy", "paramRef": {"name": "params"}}
+			}`,
+		},
+		{
+			name: "paramRef name set through v1alpha1",
+			input: `{
+				"apiVersion": "admissionregistration.x-k8s.io/v1alpha1",
+				"kind": "ValidatingAdmissionPolicyBinding",
+				"metadata": {"name": "binding", "annotations": {
+					"admissionregistration.x-k8s.io/v1alpha1-dropped-fields": "{\"spec.paramRef.parameterNotFoundAction\":\"Allow\",\"spec.paramRef.selector\":{\"matchLabels\":{\"app\":\"a\"}}}"
+				}},
+				"spec": {"policyName": "policy", "paramRef": {"name": "params", "namespace": "default"}}
+			}`,
+			version: "v1",
+			expected: `{
+				"apiVersion": "admissionregistration.x-k8s.io/v1",
+				"kind": "ValidatingAdmissionPolicyBinding",
+				"metadata": {"name": "binding"},
+				"spec": {"policyName": "policy", "paramRef": {"name": "params", "namespace": "default", "parameterNotFoundAction": "Allow"}}
+			}`,
+			lossy: true,
+		},
+		{
+			name: "paramRef removed through v1alpha1",
+			input: `{
+				"apiVersion": "admissionregistration.x-k8s.io/v1alpha1",
+				"kind": "ValidatingAdmissionPolicyBinding",
+				"metadata": {"name": "binding", "annotations": {
+					"admissionregistration.x-k8s.io/v1alpha1-dropped-fields": "{\"spec.paramRef.selector\":{}}"
+				}},
+				"spec": {"policyName": "policy"}
+			}`,
+			version: "v1",
+			expected: `{
+				"apiVersion": "admissionregistration.x-k8s.io/v1",
+				"kind": "ValidatingAdmissionPolicyBinding",
+				"metadata": {"name": "binding"},
+				"spec": {"policyName": "policy"}
+			}`,
+			lossy: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			input := parse(t, testCase.input)
+
+			converted, err := Convert(input, gv(testCase.version))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSONEqual(t, testCase.expected, converted)
+
+			roundTripped, err := Convert(converted, input.GroupVersionKind().GroupVersion())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !testCase.lossy {
+				assertJSONEqual(t, testCase.input, roundTripped)
+			}
+
+			// The input is not modified
+			assertJSONEqual(t, testCase.input, input)
+		})
+	}
+}
+
+func TestConvertUnsupported(t *testing.T) {
+	for _, testCase := range []struct {
+		name    string
+		input   string
+		version schema.GroupVersion
+	}{
+		{
+			name:    "unknown version",
+			input:   policyV1,
+			version: gv("v2"),
+		},
+		{
+			name:    "other group",
+			input:   policyV1,
+			version: schema.GroupVersion{Group: "admissionregistration.k8s.io", Version: "v1"},
+		},
+		{
+			name:    "unknown kind",
+			input:   `{"apiVersion": "admissionregistration.x-k8s.io/v1", "kind": "Other"}`,
+			version: gv("v1alpha1"),
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if _, err := Convert(parse(t, testCase.input), testCase.version); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestReview(t *testing.T) {
+	request := &apiextensionsv1.ConversionRequest{
+		UID:               "uid",
+		DesiredAPIVersion: "admissionregistration.x-k8s.io/v1alpha1",
+		Objects:           []runtime.RawExtension{{Raw: []byte(policyV1)}, {Raw: []byte(bindingV1)}},
+	}
+
+	response := Review(request)
+	if response.UID != request.UID {
+		t.Errorf("expected uid %q, got %q", request.UID, response.UID)
+	}
+	if response.Result.Status != metav1.StatusSuccess {
+		t.Fatalf("expected success, got %v", response.Result)
+	}
+	if len(response.ConvertedObjects) != 2 {
+		t.Fatalf("expected 2 converted objects, got %d", len(response.ConvertedObjects))
+	}
+	for _, raw := range response.ConvertedObjects {
+		if obj := parse(t, string(raw.Raw)); obj.GetAPIVersion() != request.DesiredAPIVersion {
+			t.Errorf("expected %s, got %s", request.DesiredAPIVersion, obj.GetAPIVersion())
+		}
+	}
+
+	request.Objects = append(request.Objects, runtime.RawExtension{Raw: []byte(`{"apiVersion": "v1", "kind": "ConfigMap"}`)})
+	response = Review(request)
+	if response.Result.Status != metav1.StatusFailure || len(response.ConvertedObjects) > 0 {
+		t.Errorf("expected the conversion to fail, got %v", response)
+	}
+}
+
+func TestDroppedFields(t *testing.T) {
+	policy, err := Convert(parse(t, policyV1), gv("v1alpha1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	variables, err := Variables(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variables) != 1 || variables[0].Name != "replicas" || variables[0].Expression != "object.spec.replicas" {
+		t.Errorf("unexpected variables %+v", variables)
+	}
+
+	binding, err := Convert(parse(t, bindingV1), gv("v1alpha1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paramRef, err := ParamRef(binding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paramRef == nil || paramRef.Selector.MatchLabels["app"] != "a" || *paramRef.ParameterNotFoundAction != "Allow" {
+		t.Errorf("unexpected paramRef %+v", paramRef)
+	}
+
+	if paramRef, err := ParamRef(policy); err != nil || paramRef != nil {
+		t.Errorf("expected no paramRef fields, got %+v, %v", paramRef, err)
+	}
+
+	binding.SetAnnotations(map[string]string{DroppedFieldsAnnotation: "{"})
+	if _, err := ParamRef(binding); err == nil {
+		t.Error("expected an invalid annotation to be an error")
+	}
+}
@@ -24,7 +24,9 @@ import (
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
 	serializer "k8s.io/apimachinery/pkg/runtime/serializer"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	admissionregistrationv1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1"
 	admissionregistrationv1alpha1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1alpha1"
+	admissionregistrationv1beta1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1beta1"
 )
 
 var Scheme = runtime.NewScheme()
@@ -32,6 +34,8 @@ var Codecs = serializer.NewCodecFactory(Scheme)
 var ParameterCodec = runtime.NewParameterCodec(Scheme)
 var localSchemeBuilder = runtime.SchemeBuilder{
 	admissionregistrationv1alpha1.AddToScheme,
+	admissionregistrationv1beta1.AddToScheme,
+	admissionregistrationv1.AddToScheme,
 }
 
 // AddToScheme adds all types of this clientset into the given scheme. This allows composition
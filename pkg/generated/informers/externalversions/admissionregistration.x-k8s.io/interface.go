@@ -19,7 +19,9 @@ limitations under the License.
 package admissionregistration
 
 import (
+	v1 "k8s.io/cel-admission-webhook/pkg/generated/informers/externalversions/admissionregistration.x-k8s.io/v1"
 	v1alpha1 "k8s.io/cel-admission-webhook/pkg/generated/informers/externalversions/admissionregistration.x-k8s.io/v1alpha1"
+	v1beta1 "k8s.io/cel-admission-webhook/pkg/generated/informers/externalversions/admissionregistration.x-k8s.io/v1beta1"
 	internalinterfaces "k8s.io/cel-admission-webhook/pkg/generated/informers/externalversions/internalinterfaces"
 )
 
@@ -27,6 +29,10 @@ import (
 type Interface interface {
 	// V1alpha1 provides access to shared informers for resources in V1alpha1.
 	V1alpha1() v1alpha1.Interface
+	// V1beta1 provides access to shared informers for resources in V1beta1.
+	V1beta1() v1beta1.Interface
+	// V1 provides access to shared informers for resources in V1.
+	V1() v1.Interface
 }
 
 type group struct {
@@ -44,3 +50,13 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 func (g *group) V1alpha1() v1alpha1.Interface {
 	return v1alpha1.New(g.factory, g.namespace, g.tweakListOptions)
 }
+
+// V1beta1 returns a new v1beta1.Interface.
+func (g *group) V1beta1() v1beta1.Interface {
+	return v1beta1.New(g.factory, g.namespace, g.tweakListOptions)
+}
+
+// V1 returns a new v1.Interface.
+func (g *group) V1() v1.Interface {
+	return v1.New(g.factory, g.namespace, g.tweakListOptions)
+}
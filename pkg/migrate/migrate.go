@@ -0,0 +1,375 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+
+	crdv1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1"
+	"k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1alpha1"
+	"k8s.io/cel-admission-webhook/pkg/conversion"
+	"k8s.io/cel-admission-webhook/pkg/generated/clientset/versioned"
+)
+
+const (
+	// Label set on x-k8s policies and bindings once they have been migrated
+	MigratedLabel = "admissionregistration.x-k8s.io/migrated"
+
+	// Annotation set alongside MigratedLabel recording the native group
+	// version the object was migrated to
+	MigratedToAnnotation = "admissionregistration.x-k8s.io/migrated-to"
+
+	DefaultFieldManager = "cel-admission-polyfill-migrate"
+)
+
+var unknownFieldPattern = regexp.MustCompile(`^unknown field "(.*)"$`)
+
+type Options struct {
+	// Native group version to migrate to
+	GroupVersion schema.GroupVersion
+
+	// Print what would be done without writing anything. The apply is still
+	// sent to the server as a dry run, to find unsupported fields
+	DryRun bool
+
+	// Label and annotate the x-k8s objects once migrated
+	LabelOriginals bool
+
+	// Take ownership of fields set by other managers on the native objects
+	Force bool
+
+	FieldManager string
+}
+
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+)
+
+type Result struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Action Action `json:"action,omitempty"`
+
+	// Fields of the x-k8s object the target version does not support, which
+	// are dropped by the migration
+	Unsupported []string `json:"unsupported,omitempty"`
+
+	// Other warnings returned by the server
+	Warnings []string `json:"warnings,omitempty"`
+
+	Labelled bool   `json:"labelled,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Report struct {
+	GroupVersion string   `json:"groupVersion"`
+	DryRun       bool     `json:"dryRun"`
+	Results      []Result `json:"results"`
+}
+
+// Failed returns the number of objects which could not be migrated
+func (r *Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if len(result.Error) > 0 {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Migrator copies admissionregistration.x-k8s.io policies and bindings to the
+// native admissionregistration.k8s.io API with server-side apply
+type Migrator struct {
+	custom   versioned.Interface
+	dynamic  dynamic.Interface
+	warnings *warningCollector
+}
+
+// New creates a Migrator for the cluster of config. Warnings returned by the
+// cluster are collected to find unsupported fields, rather than logged.
+func New(config *rest.Config) (*Migrator, error) {
+	custom, err := versioned.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := &warningCollector{}
+	config = rest.CopyConfig(config)
+	config.WarningHandler = warnings
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{custom: custom, dynamic: dynamicClient, warnings: warnings}, nil
+}
+
+// Migrate applies every x-k8s policy, then every binding, to the native API.
+// Objects are migrated independently, and failures are reported in the
+// results rather than stopping the migration.
+func (m *Migrator) Migrate(ctx context.Context, options Options) (*Report, error) {
+	if len(options.FieldManager) == 0 {
+		options.FieldManager = DefaultFieldManager
+	}
+
+	report := &Report{GroupVersion: options.GroupVersion.String(), DryRun: options.DryRun}
+
+	policies, err := m.custom.AdmissionregistrationV1alpha1().ValidatingAdmissionPolicies().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies: %w", err)
+	}
+	for i := range policies.Items {
+		policy := &policies.Items[i]
+		result := m.migrate(ctx, options, "ValidatingAdmissionPolicy", "validatingadmissionpolicies", policy, &policy.ObjectMeta)
+		if options.LabelOriginals && !options.DryRun && len(result.Error) == 0 {
+			_, err := m.custom.AdmissionregistrationV1alpha1().ValidatingAdmissionPolicies().Patch(ctx, policy.Name, types.MergePatchType, migratedPatch(options), metav1.PatchOptions{FieldManager: options.FieldManager})
+			result.setLabelled(err)
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	bindings, err := m.custom.AdmissionregistrationV1alpha1().ValidatingAdmissionPolicyBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bindings: %w", err)
+	}
+	for i := range bindings.Items {
+		binding := &bindings.Items[i]
+		result := m.migrate(ctx, options, "ValidatingAdmissionPolicyBinding", "validatingadmissionpolicybindings", binding, &binding.ObjectMeta)
+		if options.LabelOriginals && !options.DryRun && len(result.Error) == 0 {
+			_, err := m.custom.AdmissionregistrationV1alpha1().ValidatingAdmissionPolicyBindings().Patch(ctx, binding.Name, types.MergePatchType, migratedPatch(options), metav1.PatchOptions{FieldManager: options.FieldManager})
+			result.setLabelled(err)
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report, nil
+}
+
+func (r *Result) setLabelled(err error) {
+	if err != nil {
+		r.Error = fmt.Sprintf("migrated, but failed to label original: %v", err)
+	} else {
+		r.Labelled = true
+	}
+}
+
+func (m *Migrator) migrate(ctx context.Context, options Options, kind, resource string, obj runtime.Object, meta *metav1.ObjectMeta) Result {
+	result := Result{Kind: kind, Name: meta.Name}
+	client := m.dynamic.Resource(options.GroupVersion.WithResource(resource))
+
+	switch _, err := client.Get(ctx, meta.Name, metav1.GetOptions{}); {
+	case apierrors.IsNotFound(err):
+		result.Action = ActionCreate
+	case err != nil:
+		result.Error = err.Error()
+		return result
+	default:
+		result.Action = ActionUpdate
+	}
+
+	converted, err := ToNative(obj, options.GroupVersion.WithKind(kind))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	data, err := json.Marshal(converted)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	patchOptions := metav1.PatchOptions{
+		FieldManager: options.FieldManager,
+		Force:        &options.Force,
+		// Report fields the target version does not know as warnings
+		// rather than failing, so that every one of them is reported
+		FieldValidation: metav1.FieldValidationWarn,
+	}
+	if options.DryRun {
+		patchOptions.DryRun = []string{metav1.DryRunAll}
+	}
+
+	m.warnings.reset()
+	_, err = client.Patch(ctx, meta.Name, types.ApplyPatchType, data, patchOptions)
+	for _, warning := range m.warnings.reset() {
+		if match := unknownFieldPattern.FindStringSubmatch(warning); match != nil {
+			result.Unsupported = append(result.Unsupported, match[1])
+		} else {
+			result.Warnings = append(result.Warnings, warning)
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// ToNative converts an x-k8s policy or binding to an apply configuration for
+// the native group version kind. Only the name, labels and annotations are
+// kept from the metadata, and the status is dropped. Fields v1alpha1 objects
+// keep in conversion.DroppedFieldsAnnotation are restored.
+func ToNative(obj runtime.Object, gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	original := &unstructured.Unstructured{Object: content}
+	if len(original.GetAPIVersion()) == 0 {
+		// Listed items have no type meta
+		original.SetGroupVersionKind(v1alpha1.SchemeGroupVersion.WithKind(gvk.Kind))
+	}
+	original, err = conversion.Convert(original, crdv1.SchemeGroupVersion)
+	if err != nil {
+		return nil, err
+	}
+	content = original.Object
+	pruneNulls(content)
+
+	converted := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if spec, ok := content["spec"]; ok {
+		converted.Object["spec"] = spec
+	}
+	converted.SetGroupVersionKind(gvk)
+	converted.SetName(original.GetName())
+
+	// v1beta1 and v1 require parameterNotFoundAction, which defaults to Deny
+	// in the polyfill
+	if gvk.Kind == "ValidatingAdmissionPolicyBinding" && gvk.Version != v1alpha1.SchemeGroupVersion.Version {
+		paramRef, found, err := unstructured.NestedMap(converted.Object, "spec", "paramRef")
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := paramRef["parameterNotFoundAction"]; found && !ok {
+			if err := unstructured.SetNestedField(converted.Object, string(crdv1.DenyAction), "spec", "paramRef", "parameterNotFoundAction"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	labels := original.GetLabels()
+	delete(labels, MigratedLabel)
+	if len(labels) > 0 {
+		converted.SetLabels(labels)
+	}
+
+	annotations := original.GetAnnotations()
+	delete(annotations, MigratedToAnnotation)
+	delete(annotations, conversion.DroppedFieldsAnnotation)
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	if len(annotations) > 0 {
+		converted.SetAnnotations(annotations)
+	}
+
+	return converted, nil
+}
+
+// pruneNulls removes null fields, which an apply configuration would
+// otherwise claim ownership of
+func pruneNulls(obj map[string]interface{}) {
+	for k, v := range obj {
+		switch typed := v.(type) {
+		case nil:
+			delete(obj, k)
+		case map[string]interface{}:
+			pruneNulls(typed)
+		case []interface{}:
+			for _, item := range typed {
+				if item, ok := item.(map[string]interface{}); ok {
+					pruneNulls(item)
+				}
+			}
+		}
+	}
+}
+
+func migratedPatch(options Options) []byte {
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      map[string]string{MigratedLabel: "true"},
+			"annotations": map[string]string{MigratedToAnnotation: options.GroupVersion.String()},
+		},
+	})
+	return patch
+}
+
+// warningCollector keeps the warnings returned by the server. Objects are
+// migrated one at a time, so warnings can be attributed to the last request.
+type warningCollector struct {
+	lock     sync.Mutex
+	warnings []string
+}
+
+func (w *warningCollector) HandleWarningHeader(code int, agent string, text string) {
+	if code != 299 || len(text) == 0 {
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.warnings = append(w.warnings, text)
+}
+
+// reset returns the warnings collected since the last reset
+func (w *warningCollector) reset() []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	warnings := w.warnings
+	w.warnings = nil
+	return warnings
+}
+
+// Print writes the report as a table
+func (r *Report) Print(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	if r.DryRun {
+		fmt.Fprintf(w, "Plan to migrate to %s (dry run, nothing was changed):\n\n", r.GroupVersion)
+	} else {
+		fmt.Fprintf(w, "Migrated to %s:\n\n", r.GroupVersion)
+	}
+
+	fmt.Fprintln(w, "KIND\tNAME\tACTION\tUNSUPPORTED FIELDS\tRESULT")
+	for _, result := range r.Results {
+		action := string(result.Action)
+		if len(action) == 0 {
+			action = "-"
+		}
+		unsupported := strings.Join(result.Unsupported, ",")
+		if len(unsupported) == 0 {
+			unsupported = "-"
+		}
+
+		status := "ok"
+		switch {
+		case len(result.Error) > 0:
+			status = "error: " + strings.ReplaceAll(result.Error, "\n", " ")
+		case result.Labelled:
+			status = "ok, original labelled"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.Kind, result.Name, action, unsupported, status)
+
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(w, "\t\t\t\twarning: %s\n", warning)
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,216 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1alpha1"
+	"k8s.io/cel-admission-webhook/pkg/conversion"
+	"k8s.io/cel-admission-webhook/pkg/generated/clientset/versioned/fake"
+)
+
+var nativeV1 = schema.GroupVersion{Group: "admissionregistration.k8s.io", Version: "v1"}
+
+func TestMigrate(t *testing.T) {
+	for _, testCase := range []struct {
+		name    string
+		options Options
+
+		expectedResults []Result
+
+		// Number of applies expected, and whether the originals are expected
+		// to be labelled
+		expectedApplies int
+		expectLabelled  bool
+	}{
+		{
+			name:    "dry run",
+			options: Options{GroupVersion: nativeV1, DryRun: true, LabelOriginals: true},
+			expectedResults: []Result{
+				{Kind: "ValidatingAdmissionPolicy", Name: "policy", Action: ActionCreate, Unsupported: []string{"spec.unsupported"}},
+				{Kind: "ValidatingAdmissionPolicyBinding", Name: "binding", Action: ActionUpdate},
+			},
+			expectedApplies: 2,
+		},
+		{
+			name:    "migrate and label",
+			options: Options{GroupVersion: nativeV1, LabelOriginals: true},
+			expectedResults: []Result{
+				{Kind: "ValidatingAdmissionPolicy", Name: "policy", Action: ActionCreate, Unsupported: []string{"spec.unsupported"}, Labelled: true},
+				{Kind: "ValidatingAdmissionPolicyBinding", Name: "binding", Action: ActionUpdate, Labelled: true},
+			},
+			expectedApplies: 2,
+			expectLabelled:  true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			custom := fake.NewSimpleClientset(
+				&v1alpha1.ValidatingAdmissionPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:            "policy",
+						ResourceVersion: "12",
+						Labels:          map[string]string{"team": "a", MigratedLabel: "true"},
+					},
+					Spec: v1alpha1.ValidatingAdmissionPolicySpec{
+						Validations: []v1alpha1.Validation{{Expression: "true"}},
+					},
+					Status: v1alpha1.ValidatingAdmissionPolicyStatus{ObservedGeneration: 3},
+				},
+				&v1alpha1.ValidatingAdmissionPolicyBinding{
+					ObjectMeta: metav1.ObjectMeta{Name: "binding"},
+					Spec:       v1alpha1.ValidatingAdmissionPolicyBindingSpec{PolicyName: "policy"},
+				},
+			)
+
+			existingBinding := &unstructured.Unstructured{}
+			existingBinding.SetGroupVersionKind(nativeV1.WithKind("ValidatingAdmissionPolicyBinding"))
+			existingBinding.SetName("binding")
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				nativeV1.WithResource("validatingadmissionpolicies"):       "ValidatingAdmissionPolicyList",
+				nativeV1.WithResource("validatingadmissionpolicybindings"): "ValidatingAdmissionPolicyBindingList",
+			}, existingBinding)
+
+			migrator := &Migrator{custom: custom, dynamic: dynamicClient, warnings: &warningCollector{}}
+
+			var applied []map[string]interface{}
+			dynamicClient.PrependReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				patch := action.(clienttesting.PatchAction)
+				if patch.GetPatchType() != types.ApplyPatchType {
+					t.Errorf("expected an apply patch, got %s", patch.GetPatchType())
+				}
+
+				var object map[string]interface{}
+				if err := json.Unmarshal(patch.GetPatch(), &object); err != nil {
+					t.Fatal(err)
+				}
+				applied = append(applied, object)
+
+				// The server warns about fields the version does not know
+				if patch.GetResource().Resource == "validatingadmissionpolicies" {
+					migrator.warnings.HandleWarningHeader(299, "", `unknown field "spec.unsupported"`)
+				}
+				return true, &unstructured.Unstructured{Object: object}, nil
+			})
+
+			report, err := migrator.Migrate(context.Background(), testCase.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected, _ := json.Marshal(testCase.expectedResults)
+			actual, _ := json.Marshal(report.Results)
+			if string(expected) != string(actual) {
+				t.Errorf("expected results %s, got %s", expected, actual)
+			}
+
+			if len(applied) != testCase.expectedApplies {
+				t.Fatalf("expected %d applies, got %d", testCase.expectedApplies, len(applied))
+			}
+			policy, _ := json.Marshal(applied[0])
+			expectedPolicy := `{"apiVersion":"admissionregistration.k8s.io/v1","kind":"ValidatingAdmissionPolicy","metadata":{"labels":{"team":"a"},"name":"policy"},"spec":{"validations":[{"expression":"true"}]}}`
+			if string(policy) != expectedPolicy {
+				t.Errorf("expected policy to be applied as %s, got %s", expectedPolicy, policy)
+			}
+
+			labelled := 0
+			for _, action := range custom.Actions() {
+				if action.GetVerb() == "patch" {
+					labelled++
+				}
+			}
+			if (labelled > 0) != testCase.expectLabelled {
+				t.Errorf("expected originals labelled to be %v, got %d patches", testCase.expectLabelled, labelled)
+			}
+		})
+	}
+}
+
+func TestToNative(t *testing.T) {
+	nativeV1alpha1 := schema.GroupVersion{Group: "admissionregistration.k8s.io", Version: "v1alpha1"}
+	for _, testCase := range []struct {
+		name     string
+		obj      runtime.Object
+		gvk      schema.GroupVersionKind
+		expected string
+	}{
+		{
+			name: "policy with variables",
+			obj: &v1alpha1.ValidatingAdmissionPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "policy",
+					Annotations: map[string]string{
+						"team":                             "a",
+						conversion.DroppedFieldsAnnotation: `{"spec.variables":[{"name":"replicas","expression":"object.spec.replicas"}]}`,
+					},
+				},
+				Spec: v1alpha1.ValidatingAdmissionPolicySpec{
+					Validations: []v1alpha1.Validation{{Expression: "variables.replicas != 5"}},
+				},
+			},
+			gvk:      nativeV1.WithKind("ValidatingAdmissionPolicy"),
+			expected: `{"apiVersion":"admissionregistration.k8s.io/v1","kind":"ValidatingAdmissionPolicy","metadata":{"annotations":{"team":"a"},"name":"policy"},"spec":{"validations":[{"expression":"variables.replicas != 5"}],"variables":[{"expression":"object.spec.replicas","name":"replicas"}]}}`,
+		},
+		{
+			name: "binding with selector",
+			obj: &v1alpha1.ValidatingAdmissionPolicyBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "binding",
+					Annotations: map[string]string{conversion.DroppedFieldsAnnotation: `{"spec.paramRef.selector":{"matchLabels":{"env":"prod"}}}`},
+				},
+				Spec: v1alpha1.ValidatingAdmissionPolicyBindingSpec{
+					PolicyName: "policy",
+					ParamRef:   &v1alpha1.ParamRef{Namespace: "default"},
+				},
+			},
+			gvk:      nativeV1.WithKind("ValidatingAdmissionPolicyBinding"),
+			expected: `{"apiVersion":"admissionregistration.k8s.io/v1","kind":"ValidatingAdmissionPolicyBinding","metadata":{"name":"binding"},"spec":{"paramRef":{"namespace":"default","parameterNotFoundAction":"Deny","selector":{"matchLabels":{"env":"prod"}}},"policyName":"policy"}}`,
+		},
+		{
+			name: "binding keeping parameterNotFoundAction",
+			obj: &v1alpha1.ValidatingAdmissionPolicyBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "binding",
+					Annotations: map[string]string{conversion.DroppedFieldsAnnotation: `{"spec.paramRef.parameterNotFoundAction":"Allow"}`},
+				},
+				Spec: v1alpha1.ValidatingAdmissionPolicyBindingSpec{
+					PolicyName: "policy",
+					ParamRef:   &v1alpha1.ParamRef{Name: "params"},
+				},
+			},
+			gvk:      nativeV1.WithKind("ValidatingAdmissionPolicyBinding"),
+			expected: `{"apiVersion":"admissionregistration.k8s.io/v1","kind":"ValidatingAdmissionPolicyBinding","metadata":{"name":"binding"},"spec":{"paramRef":{"name":"params","parameterNotFoundAction":"Allow"},"policyName":"policy"}}`,
+		},
+		{
+			name: "binding to v1alpha1",
+			obj: &v1alpha1.ValidatingAdmissionPolicyBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "binding"},
+				Spec: v1alpha1.ValidatingAdmissionPolicyBindingSpec{
+					PolicyName: "policy",
+					ParamRef:   &v1alpha1.ParamRef{Name: "params"},
+				},
+			},
+			gvk:      nativeV1alpha1.WithKind("ValidatingAdmissionPolicyBinding"),
+			expected: `{"apiVersion":"admissionregistration.k8s.io/v1alpha1","kind":"ValidatingAdmissionPolicyBinding","metadata":{"name":"binding"},"spec":{"paramRef":{"name":"params"},"policyName":"policy"}}`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			converted, err := ToNative(testCase.obj, testCase.gvk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, _ := json.Marshal(converted)
+			if string(actual) != testCase.expected {
+				t.Errorf("expected %s, got %s", testCase.expected, actual)
+			}
+		})
+	}
+}
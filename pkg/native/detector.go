@@ -0,0 +1,130 @@
+package native
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+)
+
+// Group versions the native ValidatingAdmissionPolicy API may be served at,
+// newest first
+var GroupVersions = []schema.GroupVersion{
+	{Group: "admissionregistration.k8s.io", Version: "v1"},
+	{Group: "admissionregistration.k8s.io", Version: "v1beta1"},
+	{Group: "admissionregistration.k8s.io", Version: "v1alpha1"},
+}
+
+// Detect returns the group versions at which the cluster serves the native
+// ValidatingAdmissionPolicy API, newest first.
+//
+// Discovery can not tell whether the ValidatingAdmissionPolicy admission
+// plugin is enabled, only whether the API is served.
+func Detect(client discovery.DiscoveryInterface) ([]schema.GroupVersion, error) {
+	var served []schema.GroupVersion
+	for _, gv := range GroupVersions {
+		resources, err := client.ServerResourcesForGroupVersion(gv.String())
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, resource := range resources.APIResources {
+			if resource.Name == "validatingadmissionpolicies" {
+				served = append(served, gv)
+				break
+			}
+		}
+	}
+	return served, nil
+}
+
+// Detector periodically checks whether the cluster serves the native
+// ValidatingAdmissionPolicy API
+type Detector struct {
+	client   discovery.DiscoveryInterface
+	interval time.Duration
+	logger   klog.Logger
+
+	lock   sync.RWMutex
+	synced bool
+	served []schema.GroupVersion
+}
+
+func NewDetector(client discovery.DiscoveryInterface, interval time.Duration) *Detector {
+	return &Detector{
+		client:   client,
+		interval: interval,
+		logger:   klog.LoggerWithName(klog.Background(), "native-detector"),
+	}
+}
+
+// Run checks discovery immediately, then once every interval until ctx is
+// cancelled
+func (d *Detector) Run(ctx context.Context) error {
+	wait.UntilWithContext(ctx, d.check, d.interval)
+	return ctx.Err()
+}
+
+func (d *Detector) check(ctx context.Context) {
+	served, err := Detect(d.client)
+	if err != nil {
+		// Keep the last known state rather than flapping on discovery
+		// errors
+		d.logger.Error(err, "Failed to discover native ValidatingAdmissionPolicy API")
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.synced || !equal(served, d.served) {
+		if len(served) > 0 {
+			d.logger.Info("Native ValidatingAdmissionPolicy API is served", "groupVersions", served)
+		} else {
+			d.logger.Info("Native ValidatingAdmissionPolicy API is not served")
+		}
+	}
+	d.synced = true
+	d.served = served
+}
+
+// Available returns whether the native API was served at the last check
+func (d *Detector) Available() bool {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return len(d.served) > 0
+}
+
+// Served returns the group versions the native API was served at, at the
+// last check
+func (d *Detector) Served() []schema.GroupVersion {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.served
+}
+
+// HasSynced returns whether discovery has been checked at least once
+func (d *Detector) HasSynced() bool {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.synced
+}
+
+func equal(a, b []schema.GroupVersion) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,251 @@
+package native
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/warning"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cel-admission-webhook/pkg/validatingadmissionpolicy"
+)
+
+// Mode decides what the polyfill does once the cluster serves the native
+// ValidatingAdmissionPolicy API
+type Mode string
+
+const (
+	// Keep enforcing the polyfill's policies
+	ModeEnforce Mode = "enforce"
+
+	// Allow every request, leaving enforcement to the native implementation
+	ModeDefer Mode = "defer"
+
+	// Allow every request, but evaluate both the polyfill's policies and the
+	// native policies and report any request on which they disagree
+	ModeShadow Mode = "shadow"
+)
+
+func ParseMode(mode string) (Mode, error) {
+	switch Mode(mode) {
+	case ModeEnforce, ModeDefer, ModeShadow:
+		return Mode(mode), nil
+	default:
+		return "", fmt.Errorf("unknown mode %q, must be one of %s, %s or %s", mode, ModeEnforce, ModeDefer, ModeShadow)
+	}
+}
+
+// Audit annotation added to requests on which the polyfill and native
+// decisions differ in shadow mode. The key has no prefix of its own, since the
+// apiserver prefixes it with the name of the webhook.
+const DecisionDifferenceAnnotation = "native-decision-difference"
+
+// Group version the native policies are read at in shadow mode. The vendored
+// client only has informers for v1alpha1.
+var ShadowGroupVersion = schema.GroupVersion{Group: "admissionregistration.k8s.io", Version: "v1alpha1"}
+
+// CheckShadow returns an error if shadow mode can not compare against the
+// newest of the served group versions. Objects read through an older version
+// lose the fields it does not have, so comparisons would be meaningless.
+func CheckShadow(served []schema.GroupVersion) error {
+	if len(served) > 0 && served[0] != ShadowGroupVersion {
+		return fmt.Errorf("shadow mode can only compare against the native %s API, but the cluster serves %s; use enforce or defer mode instead", ShadowGroupVersion, served[0])
+	}
+	return nil
+}
+
+type runnable interface {
+	Run(context.Context) error
+}
+
+type syncable interface {
+	HasSynced() bool
+}
+
+// Validator enforces the polyfill's policies until the detector finds the
+// native API, then behaves according to its mode.
+type Validator struct {
+	mode     Mode
+	detector *Detector
+	polyfill admission.ValidationInterface
+	native   admission.ValidationInterface
+	logger   klog.Logger
+
+	// Why comparisons were last skipped in shadow mode, so that it is only
+	// logged when it changes
+	skipped atomic.Value
+}
+
+// NewValidator wraps polyfill, which evaluates the x-k8s policies. native
+// evaluates the native policies, and is only used in shadow mode.
+func NewValidator(mode Mode, detector *Detector, polyfill, native admission.ValidationInterface) *Validator {
+	return &Validator{
+		mode:     mode,
+		detector: detector,
+		polyfill: polyfill,
+		native:   native,
+		logger:   klog.LoggerWithName(klog.Background(), "native-validator"),
+	}
+}
+
+// enforcing returns whether the polyfill's decisions are currently returned
+func (v *Validator) enforcing() bool {
+	return v.mode == ModeEnforce || !v.detector.Available()
+}
+
+func (v *Validator) Handles(operation admission.Operation) bool {
+	return v.polyfill.Handles(operation)
+}
+
+func (v *Validator) Validate(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	if v.enforcing() {
+		return v.polyfill.Validate(ctx, a, o)
+	}
+
+	if v.mode == ModeShadow {
+		v.shadow(ctx, a, o)
+	}
+	return nil
+}
+
+// shadow evaluates the request with both the polyfill and the native
+// policies, and reports it if their decisions differ. The apiserver returns
+// the warnings and audit annotations of the native policies itself, so
+// neither evaluation may add any to the response.
+func (v *Validator) shadow(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) {
+	if v.native == nil {
+		return
+	} else if err := CheckShadow(v.detector.Served()); err != nil {
+		v.skip(err.Error())
+		return
+	} else if s, ok := v.native.(syncable); ok && !s.HasSynced() {
+		v.skip("native policies have not synced")
+		return
+	}
+	v.skip("")
+
+	ctx = warning.WithWarningRecorder(ctx, discardWarnings{})
+	quiet := quietAttributes{a}
+
+	polyfillErr := v.polyfill.Validate(ctx, quiet, o)
+	nativeErr := v.native.Validate(ctx, quiet, o)
+	if (polyfillErr == nil) == (nativeErr == nil) {
+		return
+	}
+
+	difference := fmt.Sprintf("polyfill %s, native %s", decision(polyfillErr), decision(nativeErr))
+	v.logger.Info("Polyfill and native policy decisions differ",
+		"operation", a.GetOperation(),
+		"resource", a.GetResource(),
+		"subresource", a.GetSubresource(),
+		"namespace", a.GetNamespace(),
+		"name", a.GetName(),
+		"difference", difference,
+	)
+	if err := a.AddAnnotation(DecisionDifferenceAnnotation, difference); err != nil {
+		v.logger.Error(err, "Failed to add audit annotation")
+	}
+}
+
+// skip logs why comparisons are skipped whenever the reason changes. An
+// empty reason means comparisons are being made.
+func (v *Validator) skip(reason string) {
+	if last, _ := v.skipped.Swap(reason).(string); last == reason {
+		return
+	}
+	if len(reason) > 0 {
+		v.logger.Info("Skipping comparisons with the native policies", "reason", reason)
+	} else {
+		v.logger.Info("Comparing decisions with the native policies")
+	}
+}
+
+func decision(err error) string {
+	if err == nil {
+		return "allowed"
+	}
+	return fmt.Sprintf("denied: %v", err)
+}
+
+// Explain explains the polyfill's decision, or reports that the request is
+// allowed if the polyfill is not currently enforcing
+func (v *Validator) Explain(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) (*validatingadmissionpolicy.Explanation, error) {
+	explainer, ok := v.polyfill.(validatingadmissionpolicy.Explainer)
+	if !ok {
+		return nil, fmt.Errorf("validator can not explain its decisions")
+	}
+
+	explanation, err := explainer.Explain(ctx, a, o)
+	if err != nil || v.enforcing() {
+		return explanation, err
+	}
+
+	explanation.Allowed = true
+	explanation.Message = fmt.Sprintf("native ValidatingAdmissionPolicy API is served, polyfill is in %s mode", v.mode)
+	return explanation, nil
+}
+
+func (v *Validator) Inspect() *validatingadmissionpolicy.Snapshot {
+	if inspector, ok := v.polyfill.(validatingadmissionpolicy.Inspector); ok {
+		return inspector.Inspect()
+	}
+	return &validatingadmissionpolicy.Snapshot{}
+}
+
+// Run runs the detector and both validators until ctx is cancelled or any of
+// them stops
+func (v *Validator) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runnables := []runnable{v.detector}
+	for _, validator := range []admission.ValidationInterface{v.polyfill, v.native} {
+		if r, ok := validator.(runnable); ok {
+			runnables = append(runnables, r)
+		}
+	}
+
+	errs := make(chan error, len(runnables))
+	for _, r := range runnables {
+		go func(r runnable) {
+			errs <- r.Run(ctx)
+		}(r)
+	}
+
+	err := <-errs
+	cancel()
+	for i := 1; i < len(runnables); i++ {
+		<-errs
+	}
+	return err
+}
+
+// HasSynced returns whether the detector and the polyfill have synced. The
+// native policies may never sync if the cluster does not serve them.
+func (v *Validator) HasSynced() bool {
+	if s, ok := v.polyfill.(syncable); ok && !s.HasSynced() {
+		return false
+	}
+	return v.detector.HasSynced()
+}
+
+type discardWarnings struct{}
+
+func (discardWarnings) AddWarning(agent, text string) {}
+
+// quietAttributes drops the audit annotations added while evaluating
+type quietAttributes struct {
+	admission.Attributes
+}
+
+func (quietAttributes) AddAnnotation(key, value string) error {
+	return nil
+}
+
+func (quietAttributes) AddAnnotationWithLevel(key, value string, level auditinternal.Level) error {
+	return nil
+}
@@ -0,0 +1,218 @@
+package native
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/warning"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+type fakeValidator struct {
+	err      error
+	warning  string
+	validate int
+}
+
+func (f *fakeValidator) Handles(operation admission.Operation) bool {
+	return true
+}
+
+func (f *fakeValidator) Validate(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	f.validate++
+	if len(f.warning) > 0 {
+		warning.AddWarning(ctx, "", f.warning)
+	}
+	return f.err
+}
+
+type annotationRecorder struct {
+	admission.Attributes
+	annotations map[string]string
+}
+
+func (r *annotationRecorder) AddAnnotation(key, value string) error {
+	// Validate the key as the apiserver would, once it prefixes it with the
+	// name of the webhook
+	if err := r.Attributes.AddAnnotation("cel-admission-polyfill.example.com/"+key, value); err != nil {
+		return err
+	}
+	r.annotations[key] = value
+	return nil
+}
+
+type warningRecorder []string
+
+func (w *warningRecorder) AddWarning(agent, text string) {
+	*w = append(*w, text)
+}
+
+func newDiscovery(served ...string) *fakediscovery.FakeDiscovery {
+	discovery := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	for _, gv := range served {
+		discovery.Resources = append(discovery.Resources, &metav1.APIResourceList{
+			GroupVersion: gv,
+			APIResources: []metav1.APIResource{{Name: "validatingadmissionpolicies"}, {Name: "validatingadmissionpolicybindings"}},
+		})
+	}
+	return discovery
+}
+
+func TestDetect(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		served   []string
+		expected []schema.GroupVersion
+	}{
+		{
+			name: "not served",
+		},
+		{
+			name:     "alpha",
+			served:   []string{"admissionregistration.k8s.io/v1alpha1"},
+			expected: []schema.GroupVersion{{Group: "admissionregistration.k8s.io", Version: "v1alpha1"}},
+		},
+		{
+			name:   "newest first",
+			served: []string{"admissionregistration.k8s.io/v1alpha1", "admissionregistration.k8s.io/v1"},
+			expected: []schema.GroupVersion{
+				{Group: "admissionregistration.k8s.io", Version: "v1"},
+				{Group: "admissionregistration.k8s.io", Version: "v1alpha1"},
+			},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			served, err := Detect(newDiscovery(testCase.served...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equal(served, testCase.expected) {
+				t.Errorf("expected %v, got %v", testCase.expected, served)
+			}
+		})
+	}
+
+	// Other resources of the group do not count
+	discovery := newDiscovery()
+	discovery.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "admissionregistration.k8s.io/v1",
+		APIResources: []metav1.APIResource{{Name: "validatingwebhookconfigurations"}},
+	}}
+	if served, err := Detect(discovery); err != nil || len(served) > 0 {
+		t.Errorf("expected the API not to be served, got %v, %v", served, err)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	denied := errors.New("denied")
+
+	for _, testCase := range []struct {
+		name        string
+		mode        Mode
+		served      string
+		polyfillErr error
+		nativeErr   error
+
+		expectedErr      error
+		expectedNative   bool
+		expectedWarnings int
+		expectDifference bool
+	}{
+		{
+			name:             "enforce without native API",
+			mode:             ModeEnforce,
+			polyfillErr:      denied,
+			expectedErr:      denied,
+			expectedWarnings: 1,
+		},
+		{
+			name:             "enforce with native API",
+			mode:             ModeEnforce,
+			served:           "admissionregistration.k8s.io/v1alpha1",
+			polyfillErr:      denied,
+			expectedErr:      denied,
+			expectedWarnings: 1,
+		},
+		{
+			name:             "defer without native API",
+			mode:             ModeDefer,
+			polyfillErr:      denied,
+			expectedErr:      denied,
+			expectedWarnings: 1,
+		},
+		{
+			name:        "defer with native API",
+			mode:        ModeDefer,
+			served:      "admissionregistration.k8s.io/v1alpha1",
+			polyfillErr: denied,
+		},
+		{
+			name:             "shadow without native API",
+			mode:             ModeShadow,
+			polyfillErr:      denied,
+			expectedErr:      denied,
+			expectedWarnings: 1,
+		},
+		{
+			name:           "shadow with native API and same decision",
+			mode:           ModeShadow,
+			served:         "admissionregistration.k8s.io/v1alpha1",
+			polyfillErr:    denied,
+			nativeErr:      denied,
+			expectedNative: true,
+		},
+		{
+			name:             "shadow with native API and different decision",
+			mode:             ModeShadow,
+			served:           "admissionregistration.k8s.io/v1alpha1",
+			polyfillErr:      denied,
+			expectedNative:   true,
+			expectDifference: true,
+		},
+		{
+			name:        "shadow with newer native API",
+			mode:        ModeShadow,
+			served:      "admissionregistration.k8s.io/v1",
+			polyfillErr: denied,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			discovery := newDiscovery()
+			if len(testCase.served) > 0 {
+				discovery = newDiscovery(testCase.served)
+			}
+			detector := NewDetector(discovery, 0)
+			detector.check(context.Background())
+
+			polyfill := &fakeValidator{err: testCase.polyfillErr, warning: "polyfill warning"}
+			native := &fakeValidator{err: testCase.nativeErr, warning: "native warning"}
+			validator := NewValidator(testCase.mode, detector, polyfill, native)
+
+			warnings := &warningRecorder{}
+			ctx := warning.WithWarningRecorder(context.Background(), warnings)
+			attributes := &annotationRecorder{
+				Attributes:  admission.NewAttributesRecord(nil, nil, schema.GroupVersionKind{}, "default", "name", schema.GroupVersionResource{Resource: "configmaps"}, "", admission.Create, nil, false, nil),
+				annotations: map[string]string{},
+			}
+
+			err := validator.Validate(ctx, attributes, nil)
+			if err != testCase.expectedErr {
+				t.Errorf("expected error %v, got %v", testCase.expectedErr, err)
+			}
+			if (native.validate > 0) != testCase.expectedNative {
+				t.Errorf("expected native policies evaluated to be %v", testCase.expectedNative)
+			}
+			if len(*warnings) != testCase.expectedWarnings {
+				t.Errorf("expected %d warnings, got %v", testCase.expectedWarnings, *warnings)
+			}
+			if _, ok := attributes.annotations[DecisionDifferenceAnnotation]; ok != testCase.expectDifference {
+				t.Errorf("expected difference to be reported to be %v, got %v", testCase.expectDifference, attributes.annotations)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package policysource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/client-go/informers"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cel-admission-webhook/pkg/controller/admissionregistration.x-k8s.io/v1alpha1"
+	"k8s.io/cel-admission-webhook/pkg/validatingadmissionpolicy"
+)
+
+var logger klog.Logger = klog.LoggerWithName(klog.Background(), "policysource")
+
+// How long to wait for the directory to stop changing before reloading it
+const debounceInterval = 500 * time.Millisecond
+
+// How long a newly loaded set of policies has to become ready before it is
+// abandoned in favor of the last good set
+const syncTimeout = 30 * time.Second
+
+var _ v1alpha1.ValidationInterface = &FileSource{}
+
+// FileSource evaluates ValidatingAdmissionPolicies, bindings and params read
+// from a local directory rather than from the cluster.
+//
+// The directory is watched for changes. Each time it changes the whole
+// directory is reloaded and, if it is valid, evaluation atomically switches
+// over to the new set once it is ready. Invalid sets are logged and ignored,
+// leaving the last good set in use.
+type FileSource struct {
+	dir        string
+	authorizer authorizer.Authorizer
+
+	// Set of policies currently used for evaluation. nil until the first
+	// valid set has been loaded
+	current atomic.Pointer[fileSnapshot]
+
+	// Serializes reloads
+	lock sync.Mutex
+}
+
+type fileSnapshot struct {
+	bundle *Bundle
+	plugin v1alpha1.ValidationInterface
+
+	// Stops the informers and controllers backing plugin
+	cancel context.CancelFunc
+}
+
+func NewFileSource(dir string, authorizer authorizer.Authorizer) *FileSource {
+	return &FileSource{
+		dir:        dir,
+		authorizer: authorizer,
+	}
+}
+
+func (s *FileSource) Run(ctx context.Context) error {
+	logger.Info("starting file policy source", "dir", s.dir)
+	defer logger.Info("stopping file policy source", "dir", s.dir)
+
+	defer func() {
+		if current := s.current.Swap(nil); current != nil {
+			current.cancel()
+		}
+	}()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	reload := func() {
+		if err := s.watchDirs(watcher); err != nil {
+			logger.Error(err, "failed to watch policy directory", "dir", s.dir)
+		}
+		if err := s.Reload(ctx); err != nil {
+			logger.Error(err, "rejected policy directory, keeping last good set", "dir", s.dir)
+		}
+	}
+
+	reload()
+
+	// Coalesce bursts of events, such as a ConfigMap volume update, into
+	// a single reload
+	debounce := time.NewTimer(debounceInterval)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("policy directory watcher closed")
+			}
+			logger.V(4).Info("policy directory changed", "event", event.String())
+			debounce.Reset(debounceInterval)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("policy directory watcher closed")
+			}
+			logger.Error(err, "policy directory watch error", "dir", s.dir)
+		case <-debounce.C:
+			reload()
+		}
+	}
+}
+
+// watchDirs adds every directory loaded by LoadDir to the watcher, so that
+// newly created subdirectories are picked up
+func (s *FileSource) watchDirs(watcher *fsnotify.Watcher) error {
+	return filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != s.dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// Reload reads the policy directory and, if it is valid and differs from the
+// set currently in use, swaps to it once it has synced. If the directory is
+// invalid an error is returned and the current set is left in use.
+func (s *FileSource) Reload(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	bundle, err := LoadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	if current := s.current.Load(); current != nil && current.bundle.Hash == bundle.Hash {
+		return nil
+	}
+
+	snapshot, err := s.start(ctx, bundle)
+	if err != nil {
+		return err
+	}
+
+	if old := s.current.Swap(snapshot); old != nil {
+		old.cancel()
+	}
+
+	logger.Info("loaded policy directory",
+		"dir", s.dir,
+		"policies", len(bundle.Policies),
+		"bindings", len(bundle.Bindings),
+		"objects", len(bundle.Objects),
+	)
+	return nil
+}
+
+// start builds an evaluator for the bundle whose informers are backed by an
+// in-memory store of the bundle's objects, and waits for it to sync
+func (s *FileSource) start(ctx context.Context, bundle *Bundle) (*fileSnapshot, error) {
+	mapper := bundle.RESTMapper()
+	store, err := newObjectStore(bundle, mapper)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every informer the plugin asks the factory for is served from the
+	// store. Without a client, the plugin reads params through the store as
+	// unstructured objects, and does not write policy status.
+	factory := informers.NewSharedInformerFactory(nil, 0)
+	store.injectInformers(factory)
+	plugin := v1alpha1.NewPlugin(factory, nil, mapper, nil, store, s.authorizer)
+
+	pluginContext, cancel := context.WithCancel(ctx)
+	go func() {
+		if err := plugin.Run(pluginContext); err != nil {
+			logger.Error(err, "policy evaluator stopped")
+		}
+	}()
+	factory.Start(pluginContext.Done())
+
+	if err := wait.PollUntilContextTimeout(pluginContext, 100*time.Millisecond, syncTimeout, true, func(ctx context.Context) (bool, error) {
+		return plugin.HasSynced(), nil
+	}); err != nil {
+		cancel()
+		return nil, fmt.Errorf("policies failed to sync: %w", err)
+	}
+
+	return &fileSnapshot{
+		bundle: bundle,
+		plugin: plugin,
+		cancel: cancel,
+	}, nil
+}
+
+func (s *FileSource) HasSynced() bool {
+	return s.current.Load() != nil
+}
+
+func (s *FileSource) Handles(operation admission.Operation) bool {
+	return true
+}
+
+func (s *FileSource) Validate(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	current := s.current.Load()
+	if current == nil {
+		return admission.NewForbidden(a, fmt.Errorf("not yet ready to handle request"))
+	}
+	return current.plugin.Validate(ctx, a, o)
+}
+
+func (s *FileSource) Explain(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) (*validatingadmissionpolicy.Explanation, error) {
+	current := s.current.Load()
+	if current == nil {
+		return nil, fmt.Errorf("not yet ready to handle request")
+	}
+	return current.plugin.Explain(ctx, a, o)
+}
+
+func (s *FileSource) Inspect() *validatingadmissionpolicy.Snapshot {
+	current := s.current.Load()
+	if current == nil {
+		return &validatingadmissionpolicy.Snapshot{
+			Policies:   []validatingadmissionpolicy.PolicySnapshot{},
+			ParamKinds: []validatingadmissionpolicy.ParamKindSnapshot{},
+		}
+	}
+	return current.plugin.Inspect()
+}
@@ -0,0 +1,693 @@
+package policysource
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/warning"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"k8s.io/cel-admission-webhook/pkg/validatingadmissionpolicy"
+)
+
+const testPolicy = `
+apiVersion: admissionregistration.x-k8s.io/v1alpha1
+kind: ValidatingAdmissionPolicy
+metadata:
+  name: name-suffix
+spec:
+  paramKind:
+    apiVersion: v1
+    kind: ConfigMap
+  matchConstraints:
+    resourceRules:
+    - operations: ["CREATE"]
+      apiGroups: [""]
+      apiVersions: ["v1"]
+      resources: ["configmaps"]
+  validations:
+  - expression: object.metadata.name.endsWith(params.data.suffix)
+---
+apiVersion: admissionregistration.x-k8s.io/v1alpha1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: name-suffix
+spec:
+  policyName: name-suffix
+  paramRef:
+    name: suffix
+    namespace: default
+  validationActions: [Deny]
+`
+
+const testParam = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: suffix
+  namespace: default
+data:
+  suffix: -k8s
+`
+
+const testVariablesPolicy = `
+apiVersion: admissionregistration.x-k8s.io/v1
+kind: ValidatingAdmissionPolicy
+metadata:
+  name: name-suffix
+spec:
+  paramKind:
+    apiVersion: v1
+    kind: ConfigMap
+  matchConstraints:
+    resourceRules:
+    - operations: ["CREATE"]
+      apiGroups: [""]
+      apiVersions: ["v1"]
+      resources: ["configmaps"]
+  variables:
+  - name: suffix
+    expression: params.data.suffix
+  - name: suffixed
+    expression: object.metadata.name.endsWith(variables.suffix)
+  validations:
+  - expression: variables.suffixed
+    messageExpression: '"name must end with " + variables.suffix'
+---
+apiVersion: admissionregistration.x-k8s.io/v1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: name-suffix
+spec:
+  policyName: name-suffix
+  paramRef:
+    name: suffix
+    namespace: default
+  validationActions: [Deny]
+`
+
+const testSelectorParams = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: suffix
+  namespace: default
+  labels:
+    team: a
+data:
+  suffix: -k8s
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: short-suffix
+  namespace: default
+  labels:
+    team: a
+data:
+  suffix: s
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: suffix
+  namespace: other
+  labels:
+    team: a
+data:
+  suffix: -other
+`
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func configMapCreate(name string) admission.Attributes {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+	return admission.NewAttributesRecord(
+		cm, nil,
+		corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		"default", name,
+		corev1.SchemeGroupVersion.WithResource("configmaps"),
+		"",
+		admission.Create,
+		&metav1.CreateOptions{},
+		false,
+		&user.DefaultInfo{Name: "test"},
+	)
+}
+
+func TestLoadDir(t *testing.T) {
+	for _, testCase := range []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name:  "valid",
+			files: map[string]string{"policy.yaml": testPolicy, "param.yaml": testParam},
+		},
+		{
+			name: "hidden files ignored",
+			files: map[string]string{
+				"policy.yaml":   testPolicy,
+				".ignored.yaml": "not: [valid",
+				"README.md":     "not yaml",
+			},
+		},
+		{
+			name:  "unknown field",
+			files: map[string]string{"policy.yaml": strings.Replace(testPolicy, "validations:", "validation:", 1)},
+			err:   `unknown field "spec.validation"`,
+		},
+		{
+			name:  "bad expression",
+			files: map[string]string{"policy.yaml": strings.Replace(testPolicy, "endsWith(", "endsWith((", 1)},
+			err:   "spec.validations[0].expression",
+		},
+		{
+			name:  "missing validation actions",
+			files: map[string]string{"policy.yaml": strings.Replace(testPolicy, "validationActions: [Deny]", "", 1)},
+			err:   "spec.validationActions: Required value",
+		},
+		{
+			name:  "variables",
+			files: map[string]string{"policy.yaml": testVariablesPolicy, "param.yaml": testParam},
+		},
+		{
+			name:  "variable used before it is declared",
+			files: map[string]string{"policy.yaml": strings.Replace(testVariablesPolicy, "expression: params.data.suffix", "expression: variables.suffixed", 1)},
+			err:   "spec.variables[0]",
+		},
+		{
+			name:  "undeclared variable",
+			files: map[string]string{"policy.yaml": strings.Replace(testVariablesPolicy, "expression: variables.suffixed", "expression: variables.other", 1)},
+			err:   "spec.validations[0].expression",
+		},
+		{
+			name:  "paramRef without name or selector",
+			files: map[string]string{"policy.yaml": strings.Replace(testVariablesPolicy, "name: suffix\n    namespace: default", "namespace: default", 1)},
+			err:   "spec.paramRef.name: Required value",
+		},
+		{
+			name:  "unsupported parameterNotFoundAction",
+			files: map[string]string{"policy.yaml": strings.Replace(testVariablesPolicy, "namespace: default", "namespace: default\n    parameterNotFoundAction: Maybe", 1)},
+			err:   "Unsupported value",
+		},
+		{
+			name:  "duplicate",
+			files: map[string]string{"policy.yaml": testPolicy, "copy.yaml": testPolicy},
+			err:   "Duplicate value",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range testCase.files {
+				writeFile(t, dir, name, content)
+			}
+			bundle, err := LoadDir(dir)
+			if len(testCase.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), testCase.err) {
+					t.Fatalf("expected error containing %q, got %v", testCase.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(bundle.Policies) != 1 || len(bundle.Bindings) != 1 {
+				t.Errorf("expected 1 policy and 1 binding, got %d and %d", len(bundle.Policies), len(bundle.Bindings))
+			}
+		})
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := t.TempDir()
+	writeFile(t, dir, "policy.yaml", testPolicy)
+	writeFile(t, dir, "param.yaml", testParam)
+
+	source := NewFileSource(dir, nil)
+	if err := source.Validate(ctx, configMapCreate("foo"), nil); err == nil {
+		t.Fatal("expected request to be rejected before first load")
+	}
+	if err := source.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	o := admission.NewObjectInterfacesFromScheme(clientsetscheme.Scheme)
+	if err := source.Validate(ctx, configMapCreate("foo"), o); err == nil {
+		t.Error("expected foo to be denied")
+	}
+	if err := source.Validate(ctx, configMapCreate("foo-k8s"), o); err != nil {
+		t.Errorf("expected foo-k8s to be allowed: %v", err)
+	}
+
+	// Invalid directory keeps the last good set in use
+	writeFile(t, dir, "broken.yaml", "kind: [")
+	if err := source.Reload(ctx); err == nil {
+		t.Error("expected invalid directory to be rejected")
+	}
+	if err := source.Validate(ctx, configMapCreate("foo"), o); err == nil {
+		t.Error("expected foo to still be denied")
+	}
+
+	// Fixing the directory swaps to the new set
+	if err := os.Remove(filepath.Join(dir, "broken.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "param.yaml", strings.Replace(testParam, "-k8s", "foo", 1))
+	if err := source.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Validate(ctx, configMapCreate("foo"), o); err != nil {
+		t.Errorf("expected foo to be allowed after reload: %v", err)
+	}
+}
+
+const testClusterScopedParam = `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: suffixes.example.com
+spec:
+  group: example.com
+  scope: Cluster
+  names:
+    kind: Suffix
+    plural: suffixes
+    singular: suffix
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        x-kubernetes-preserve-unknown-fields: true
+---
+apiVersion: example.com/v1
+kind: Suffix
+metadata:
+  name: suffix
+suffix: -k8s
+---
+apiVersion: admissionregistration.x-k8s.io/v1alpha1
+kind: ValidatingAdmissionPolicy
+metadata:
+  name: name-suffix
+spec:
+  paramKind:
+    apiVersion: example.com/v1
+    kind: Suffix
+  matchConstraints:
+    resourceRules:
+    - operations: ["CREATE"]
+      apiGroups: [""]
+      apiVersions: ["v1"]
+      resources: ["configmaps"]
+  validations:
+  - expression: object.metadata.name.endsWith(params.suffix)
+---
+apiVersion: admissionregistration.x-k8s.io/v1alpha1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: name-suffix
+spec:
+  policyName: name-suffix
+  paramRef:
+    name: suffix
+  validationActions: [Deny]
+`
+
+func TestBundleRESTMapper(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "params.yaml", testClusterScopedParam+`---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: role
+---
+apiVersion: v1
+kind: Endpoints
+metadata:
+  name: endpoints
+  namespace: default
+`)
+	bundle, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapper := bundle.RESTMapper()
+
+	for _, testCase := range []struct {
+		kind     schema.GroupVersionKind
+		resource string
+		scope    meta.RESTScopeName
+	}{
+		{
+			kind:     schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Suffix"},
+			resource: "suffixes",
+			scope:    meta.RESTScopeNameRoot,
+		},
+		{
+			kind:     schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+			resource: "clusterroles",
+			scope:    meta.RESTScopeNameRoot,
+		},
+		{
+			kind:     schema.GroupVersionKind{Version: "v1", Kind: "Endpoints"},
+			resource: "endpoints",
+			scope:    meta.RESTScopeNameNamespace,
+		},
+	} {
+		t.Run(testCase.kind.Kind, func(t *testing.T) {
+			mapping, err := mapper.RESTMapping(testCase.kind.GroupKind(), testCase.kind.Version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mapping.Resource.Resource != testCase.resource {
+				t.Errorf("expected resource %q, got %q", testCase.resource, mapping.Resource.Resource)
+			}
+			if mapping.Scope.Name() != testCase.scope {
+				t.Errorf("expected scope %q, got %q", testCase.scope, mapping.Scope.Name())
+			}
+		})
+	}
+}
+
+func TestFileSourceClusterScopedParam(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := t.TempDir()
+	writeFile(t, dir, "policy.yaml", testClusterScopedParam)
+
+	source := NewFileSource(dir, nil)
+	if err := source.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The param is found by name even though the request is namespaced
+	o := admission.NewObjectInterfacesFromScheme(clientsetscheme.Scheme)
+	if err := source.Validate(ctx, configMapCreate("foo"), o); err == nil {
+		t.Error("expected foo to be denied")
+	}
+	if err := source.Validate(ctx, configMapCreate("foo-k8s"), o); err != nil {
+		t.Errorf("expected foo-k8s to be allowed: %v", err)
+	}
+}
+
+func TestFileSourceVariables(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := t.TempDir()
+	writeFile(t, dir, "policy.yaml", testVariablesPolicy)
+	writeFile(t, dir, "param.yaml", testParam)
+
+	source := NewFileSource(dir, nil)
+	if err := source.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	o := admission.NewObjectInterfacesFromScheme(clientsetscheme.Scheme)
+	if err := source.Validate(ctx, configMapCreate("foo"), o); err == nil || !strings.Contains(err.Error(), "name must end with -k8s") {
+		t.Errorf("expected foo to be denied by the messageExpression, got %v", err)
+	}
+	if err := source.Validate(ctx, configMapCreate("foo-k8s"), o); err != nil {
+		t.Errorf("expected foo-k8s to be allowed: %v", err)
+	}
+}
+
+func TestFileSourceParamRef(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	o := admission.NewObjectInterfacesFromScheme(clientsetscheme.Scheme)
+	for _, testCase := range []struct {
+		name     string
+		paramRef string
+		allowed  map[string]bool
+	}{
+		{
+			name:     "selector in request namespace",
+			paramRef: "{selector: {matchLabels: {team: a}}, parameterNotFoundAction: Deny}",
+			allowed:  map[string]bool{"foo": false, "foo-k8s": true, "foo-s": false},
+		},
+		{
+			name:     "selector in other namespace",
+			paramRef: "{namespace: other, selector: {matchLabels: {team: a}}, parameterNotFoundAction: Deny}",
+			allowed:  map[string]bool{"foo-k8s": false, "foo-other": true},
+		},
+		{
+			name:     "name in request namespace",
+			paramRef: "{name: short-suffix, parameterNotFoundAction: Deny}",
+			allowed:  map[string]bool{"foo": false, "foo-s": true},
+		},
+		{
+			name:     "nothing selected allowed",
+			paramRef: "{selector: {matchLabels: {team: b}}, parameterNotFoundAction: Allow}",
+			allowed:  map[string]bool{"foo": true},
+		},
+		{
+			name:     "nothing selected denied",
+			paramRef: "{selector: {matchLabels: {team: b}}, parameterNotFoundAction: Deny}",
+			allowed:  map[string]bool{"foo": false, "foo-k8s": false},
+		},
+		{
+			name:     "missing name allowed",
+			paramRef: "{name: missing, parameterNotFoundAction: Allow}",
+			allowed:  map[string]bool{"foo": true},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			policy := strings.Replace(testVariablesPolicy, `paramRef:
+    name: suffix
+    namespace: default`, "paramRef: "+testCase.paramRef, 1)
+
+			dir := t.TempDir()
+			writeFile(t, dir, "policy.yaml", policy)
+			writeFile(t, dir, "params.yaml", testSelectorParams)
+
+			source := NewFileSource(dir, nil)
+			if err := source.Reload(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, allowed := range testCase.allowed {
+				if err := source.Validate(ctx, configMapCreate(name), o); allowed && err != nil {
+					t.Errorf("expected %s to be allowed: %v", name, err)
+				} else if !allowed && err == nil {
+					t.Errorf("expected %s to be denied", name)
+				}
+			}
+		})
+	}
+}
+
+func TestFileSourceExplain(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := t.TempDir()
+	writeFile(t, dir, "policy.yaml", testPolicy)
+	writeFile(t, dir, "param.yaml", testParam)
+
+	source := NewFileSource(dir, nil)
+	if err := source.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	o := admission.NewObjectInterfacesFromScheme(clientsetscheme.Scheme)
+	explanation, err := source.Explain(ctx, configMapCreate("foo"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if explanation.Allowed || !strings.Contains(explanation.Message, "name-suffix") {
+		t.Errorf("expected request to be denied by name-suffix, got %v: %v", explanation.Allowed, explanation.Message)
+	}
+	if len(explanation.Policies) != 1 || len(explanation.Policies[0].Bindings) != 1 {
+		t.Fatalf("expected 1 policy with 1 binding, got %+v", explanation.Policies)
+	}
+
+	policy := explanation.Policies[0]
+	binding := policy.Bindings[0]
+	if !policy.MatchConstraints.Matched || !binding.MatchResources.Matched {
+		t.Errorf("expected policy and binding to match, got %+v and %+v", policy.MatchConstraints, binding.MatchResources)
+	}
+	if binding.Param == nil || binding.Param.Name != "suffix" || binding.Param.Object == nil {
+		t.Errorf("expected param suffix to be used, got %+v", binding.Param)
+	}
+	if len(binding.Validations) != 1 {
+		t.Fatalf("expected 1 validation, got %+v", binding.Validations)
+	}
+
+	validation := binding.Validations[0]
+	if validation.Result != false || len(validation.Error) > 0 || validation.Cost <= 0 {
+		t.Errorf("expected validation to evaluate to false at some cost, got %+v", validation)
+	}
+	if len(binding.Decisions) != 1 || binding.Decisions[0].Action != "deny" {
+		t.Errorf("expected a deny decision, got %+v", binding.Decisions)
+	}
+}
+
+const testAuthorizerPolicy = `
+apiVersion: admissionregistration.x-k8s.io/v1alpha1
+kind: ValidatingAdmissionPolicy
+metadata:
+  name: authorized
+spec:
+  matchConstraints:
+    resourceRules:
+    - operations: ["CREATE"]
+      apiGroups: [""]
+      apiVersions: ["v1"]
+      resources: ["configmaps"]
+  matchConditions:
+  - name: authorized
+    expression: authorizer.group('').resource('configmaps').check('create').allowed()
+  validations:
+  - expression: "!authorizer.group('').resource('secrets').check('get').allowed()"
+  auditAnnotations:
+  - key: name
+    valueExpression: string(object.metadata.name)
+---
+apiVersion: admissionregistration.x-k8s.io/v1alpha1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: authorized
+spec:
+  policyName: authorized
+  validationActions: [Warn, Audit]
+`
+
+type warningRecorder []string
+
+type annotationRecorder struct {
+	admission.Attributes
+	annotations map[string]string
+}
+
+func (r *annotationRecorder) AddAnnotation(key, value string) error {
+	r.annotations[key] = value
+	return nil
+}
+
+func (w *warningRecorder) AddWarning(agent, text string) {
+	*w = append(*w, text)
+}
+
+// countingAuthorizer allows everything, counting the authorization checks
+type countingAuthorizer struct {
+	checks int32
+}
+
+func (a *countingAuthorizer) Authorize(ctx context.Context, attributes authorizer.Attributes) (authorizer.Decision, string, error) {
+	atomic.AddInt32(&a.checks, 1)
+	return authorizer.DecisionAllow, "", nil
+}
+
+func TestFileSourceExplainSideEffects(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := t.TempDir()
+	writeFile(t, dir, "policy.yaml", testAuthorizerPolicy)
+
+	authz := &countingAuthorizer{}
+	source := NewFileSource(dir, authz)
+	if err := source.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := &warningRecorder{}
+	attributes := &annotationRecorder{Attributes: configMapCreate("foo"), annotations: map[string]string{}}
+	o := admission.NewObjectInterfacesFromScheme(clientsetscheme.Scheme)
+	explanation, err := source.Explain(warning.WithWarningRecorder(ctx, recorded), attributes, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Explaining the request doesn't warn or annotate it
+	if len(*recorded) > 0 {
+		t.Errorf("expected no warnings, got %v", *recorded)
+	}
+	if len(attributes.annotations) > 0 {
+		t.Errorf("expected no audit annotations, got %v", attributes.annotations)
+	}
+
+	// Each expression is evaluated once, for both the decision and its
+	// explanation
+	if checks := atomic.LoadInt32(&authz.checks); checks != 2 {
+		t.Errorf("expected 2 authorization checks, got %d", checks)
+	}
+	if len(explanation.Policies) != 1 || len(explanation.Policies[0].Bindings) != 1 {
+		t.Fatalf("expected 1 policy with 1 binding, got %+v", explanation.Policies)
+	}
+	binding := explanation.Policies[0].Bindings[0]
+	if binding.MatchConditions == nil || !binding.MatchConditions.Matched || len(binding.MatchConditions.Expressions) != 1 || binding.MatchConditions.Expressions[0].Result != true {
+		t.Errorf("expected the match condition to be met, got %+v", binding.MatchConditions)
+	}
+	if len(binding.Validations) != 1 || binding.Validations[0].Result != false || binding.Validations[0].Cost <= 0 {
+		t.Errorf("expected the validation to evaluate to false at some cost, got %+v", binding.Validations)
+	}
+	if len(binding.AuditAnnotations) != 1 || binding.AuditAnnotations[0].Result != "foo" {
+		t.Errorf("expected the audit annotation to evaluate to foo, got %+v", binding.AuditAnnotations)
+	}
+	if len(binding.Decisions) != 1 || binding.Decisions[0].Action != "deny" {
+		t.Errorf("expected a deny decision, got %+v", binding.Decisions)
+	}
+}
+
+func TestFileSourceInspect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := t.TempDir()
+	writeFile(t, dir, "policy.yaml", testPolicy)
+	writeFile(t, dir, "param.yaml", testParam)
+
+	source := NewFileSource(dir, nil)
+	if err := source.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The evaluator's snapshot of policies is refreshed asynchronously
+	var snapshot *validatingadmissionpolicy.Snapshot
+	if err := wait.PollUntilContextCancel(ctx, 100*time.Millisecond, true, func(ctx context.Context) (bool, error) {
+		snapshot = source.Inspect()
+		return len(snapshot.ParamKinds) == 1 && snapshot.ParamKinds[0].Synced, nil
+	}); err != nil {
+		t.Fatalf("param informer did not sync: %+v", snapshot)
+	}
+
+	if !snapshot.Synced || len(snapshot.Policies) != 1 {
+		t.Fatalf("expected a synced snapshot with 1 policy, got %+v", snapshot)
+	}
+	if policy := snapshot.Policies[0]; policy.Name != "name-suffix" || len(policy.Bindings) != 1 || len(policy.CompileErrors) != 0 {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+	if paramKind := snapshot.ParamKinds[0]; paramKind.Kind != "ConfigMap" || paramKind.Objects != 1 || len(paramKind.Policies) != 1 {
+		t.Errorf("unexpected param kind %+v", paramKind)
+	}
+}
@@ -0,0 +1,631 @@
+package policysource
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	admissionregistrationv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/matchconditions"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+
+	crdv1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1"
+	crdv1alpha1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1alpha1"
+	crdv1beta1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1beta1"
+	"k8s.io/cel-admission-webhook/pkg/controller/admissionregistration.x-k8s.io/v1alpha1"
+	"k8s.io/cel-admission-webhook/pkg/conversion"
+	"k8s.io/cel-admission-webhook/pkg/validatingadmissionpolicy"
+)
+
+// Scheme used to decode manifests in a policy directory. Knows about all
+// kubernetes builtin types and the admissionregistration.x-k8s.io CRD types.
+var bundleScheme = runtime.NewScheme()
+
+var bundleDecoder = json.NewSerializerWithOptions(json.DefaultMetaFactory, bundleScheme, bundleScheme, json.SerializerOptions{
+	Yaml:   true,
+	Strict: true,
+})
+
+func init() {
+	utilruntime.Must(clientsetscheme.AddToScheme(bundleScheme))
+	utilruntime.Must(crdv1alpha1.AddToScheme(bundleScheme))
+	utilruntime.Must(crdv1beta1.AddToScheme(bundleScheme))
+	utilruntime.Must(crdv1.AddToScheme(bundleScheme))
+}
+
+// Bundle is a validated set of policies, bindings and the objects they refer
+// to which was loaded from a directory.
+type Bundle struct {
+	Policies []*admissionregistrationv1alpha1.ValidatingAdmissionPolicy
+	Bindings []*admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding
+
+	// Any other objects found in the directory. These are made available as
+	// params, and Namespace objects are used to evaluate namespaceSelectors.
+	// Kinds known to the kubernetes clientset are decoded to their typed
+	// representation, everything else is left as unstructured.
+	Objects []runtime.Object
+
+	// Hash of the paths and contents of every file the bundle was loaded from
+	Hash [sha256.Size]byte
+}
+
+// LoadDir reads every .yaml, .yml and .json file beneath dir into a Bundle.
+// Files and directories starting with "." are skipped, so mounted ConfigMaps
+// are only read through their top-level symlinks.
+//
+// An error is returned if any file fails to parse, or if any policy or
+// binding is invalid. In that case no partial Bundle is returned.
+func LoadDir(dir string) (*Bundle, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		// Follow symlinks so ConfigMap volume entries are read
+		if info, err := os.Stat(path); err != nil {
+			return err
+		} else if !info.Mode().IsRegular() {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	bundle := &Bundle{}
+	hash := sha256.New()
+	var errs []error
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", path, len(data))
+		hash.Write(data)
+
+		if err := bundle.add(data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	copy(bundle.Hash[:], hash.Sum(nil))
+
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+
+	if err := bundle.Validate(); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// add decodes every document in a YAML or JSON stream and adds it to the
+// bundle
+func (b *Bundle) add(data []byte) error {
+	reader := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for i := 0; ; i++ {
+		document, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if len(bytes.TrimSpace(document)) == 0 {
+			continue
+		}
+
+		if err := b.addDocument(document); err != nil {
+			return fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+}
+
+func (b *Bundle) addDocument(document []byte) error {
+	data, err := yaml.ToJSON(document)
+	if err != nil {
+		return err
+	} else if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		// YAML documents which contain only comments decode to null
+		return nil
+	}
+
+	obj, _, err := bundleDecoder.Decode(data, nil, nil)
+	if runtime.IsNotRegisteredError(err) {
+		u := &unstructured.Unstructured{}
+		if _, _, err := unstructured.UnstructuredJSONScheme.Decode(data, nil, u); err != nil {
+			return err
+		}
+		b.Objects = append(b.Objects, u)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Later versions are read through v1alpha1, which keeps the fields it does
+	// not have in an annotation
+	switch obj.(type) {
+	case *crdv1beta1.ValidatingAdmissionPolicy, *crdv1.ValidatingAdmissionPolicy:
+		if obj, err = toV1alpha1(obj, &crdv1alpha1.ValidatingAdmissionPolicy{}); err != nil {
+			return err
+		}
+	case *crdv1beta1.ValidatingAdmissionPolicyBinding, *crdv1.ValidatingAdmissionPolicyBinding:
+		if obj, err = toV1alpha1(obj, &crdv1alpha1.ValidatingAdmissionPolicyBinding{}); err != nil {
+			return err
+		}
+	}
+
+	switch obj := obj.(type) {
+	case *crdv1alpha1.ValidatingAdmissionPolicy:
+		policy, err := v1alpha1.CRDToNativePolicy(obj)
+		if err != nil {
+			return err
+		}
+		b.addPolicy(policy)
+	case *crdv1alpha1.ValidatingAdmissionPolicyBinding:
+		binding, err := v1alpha1.CRDToNativePolicyBinding(obj)
+		if err != nil {
+			return err
+		}
+		b.addBinding(binding)
+	case *admissionregistrationv1alpha1.ValidatingAdmissionPolicy:
+		b.addPolicy(obj)
+	case *admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding:
+		b.addBinding(obj)
+	case *crdv1alpha1.ValidatingAdmissionPolicyList, *crdv1alpha1.ValidatingAdmissionPolicyBindingList,
+		*crdv1beta1.ValidatingAdmissionPolicyList, *crdv1beta1.ValidatingAdmissionPolicyBindingList,
+		*crdv1.ValidatingAdmissionPolicyList, *crdv1.ValidatingAdmissionPolicyBindingList,
+		*admissionregistrationv1alpha1.ValidatingAdmissionPolicyList, *admissionregistrationv1alpha1.ValidatingAdmissionPolicyBindingList:
+		return fmt.Errorf("lists are not supported, use one document per object")
+	default:
+		b.Objects = append(b.Objects, obj)
+	}
+	return nil
+}
+
+// toV1alpha1 converts a v1beta1 or v1 policy or binding to its v1alpha1
+// representation in out
+func toV1alpha1(obj runtime.Object, out runtime.Object) (runtime.Object, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(objectKind(obj))
+
+	converted, err := conversion.Convert(u, crdv1alpha1.SchemeGroupVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(converted.Object, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// addPolicy applies the same defaults the CRD schema would before adding the
+// policy to the bundle
+func (b *Bundle) addPolicy(policy *admissionregistrationv1alpha1.ValidatingAdmissionPolicy) {
+	if policy.Spec.FailurePolicy == nil {
+		failurePolicy := admissionregistrationv1alpha1.Fail
+		policy.Spec.FailurePolicy = &failurePolicy
+	}
+	setMatchResourcesDefaults(policy.Spec.MatchConstraints)
+	b.Policies = append(b.Policies, policy)
+}
+
+// addBinding applies the same defaults the CRD schema would before adding the
+// binding to the bundle
+func (b *Bundle) addBinding(binding *admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding) {
+	setMatchResourcesDefaults(binding.Spec.MatchResources)
+	b.Bindings = append(b.Bindings, binding)
+}
+
+func setMatchResourcesDefaults(matchResources *admissionregistrationv1alpha1.MatchResources) {
+	if matchResources == nil {
+		return
+	}
+	if matchResources.NamespaceSelector == nil {
+		matchResources.NamespaceSelector = &metav1.LabelSelector{}
+	}
+	if matchResources.ObjectSelector == nil {
+		matchResources.ObjectSelector = &metav1.LabelSelector{}
+	}
+	if matchResources.MatchPolicy == nil {
+		matchPolicy := admissionregistrationv1alpha1.Equivalent
+		matchResources.MatchPolicy = &matchPolicy
+	}
+}
+
+// Validate checks that the policies and bindings in the bundle are well
+// formed and that every CEL expression compiles
+func (b *Bundle) Validate() error {
+	var errs field.ErrorList
+
+	type key struct {
+		gvk             schema.GroupVersionKind
+		namespace, name string
+	}
+	seen := map[key]bool{}
+	checkName := func(path *field.Path, gvk schema.GroupVersionKind, obj runtime.Object) {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			errs = append(errs, field.InternalError(path, err))
+			return
+		}
+		if len(accessor.GetName()) == 0 {
+			errs = append(errs, field.Required(path.Child("metadata", "name"), ""))
+			return
+		}
+		k := key{gvk: gvk, namespace: accessor.GetNamespace(), name: accessor.GetName()}
+		if seen[k] {
+			errs = append(errs, field.Duplicate(path.Child("metadata", "name"), accessor.GetName()))
+		}
+		seen[k] = true
+	}
+
+	policyGVK := admissionregistrationv1alpha1.SchemeGroupVersion.WithKind("ValidatingAdmissionPolicy")
+	for _, policy := range b.Policies {
+		path := field.NewPath(policyGVK.Kind).Key(policy.Name)
+		checkName(path, policyGVK, policy)
+		errs = append(errs, validatePolicy(path.Child("spec"), policy)...)
+	}
+
+	bindingGVK := admissionregistrationv1alpha1.SchemeGroupVersion.WithKind("ValidatingAdmissionPolicyBinding")
+	for _, binding := range b.Bindings {
+		path := field.NewPath(bindingGVK.Kind).Key(binding.Name)
+		checkName(path, bindingGVK, binding)
+		errs = append(errs, validateBinding(path.Child("spec"), binding)...)
+	}
+
+	for _, obj := range b.Objects {
+		gvk := objectKind(obj)
+		checkName(field.NewPath(gvk.Kind), gvk, obj)
+	}
+
+	return errs.ToAggregate()
+}
+
+func validatePolicy(path *field.Path, policy *admissionregistrationv1alpha1.ValidatingAdmissionPolicy) field.ErrorList {
+	var errs field.ErrorList
+	spec := policy.Spec
+
+	if spec.MatchConstraints == nil {
+		errs = append(errs, field.Required(path.Child("matchConstraints"), ""))
+	}
+
+	if spec.ParamKind != nil {
+		if _, err := schema.ParseGroupVersion(spec.ParamKind.APIVersion); err != nil {
+			errs = append(errs, field.Invalid(path.Child("paramKind", "apiVersion"), spec.ParamKind.APIVersion, err.Error()))
+		}
+		if len(spec.ParamKind.Kind) == 0 {
+			errs = append(errs, field.Required(path.Child("paramKind", "kind"), ""))
+		}
+	}
+
+	if spec.FailurePolicy != nil {
+		switch *spec.FailurePolicy {
+		case admissionregistrationv1alpha1.Fail, admissionregistrationv1alpha1.Ignore:
+		default:
+			errs = append(errs, field.NotSupported(path.Child("failurePolicy"), *spec.FailurePolicy, []string{string(admissionregistrationv1alpha1.Fail), string(admissionregistrationv1alpha1.Ignore)}))
+		}
+	}
+
+	if len(spec.Validations) == 0 && len(spec.AuditAnnotations) == 0 {
+		errs = append(errs, field.Required(path.Child("validations"), "validations or auditAnnotations must contain at least one item"))
+	}
+
+	optionalVars := cel.OptionalVariableDeclarations{HasParams: spec.ParamKind != nil, HasAuthorizer: true}
+	messageOptionalVars := cel.OptionalVariableDeclarations{HasParams: spec.ParamKind != nil, HasAuthorizer: false}
+
+	// Expressions of policies with variables are compiled with them
+	// declared, as they will be when the policy is enforced
+	compileExpression := cel.CompileCELExpression
+	variables, err := validatingadmissionpolicy.PolicyVariables(policy)
+	if err != nil {
+		errs = append(errs, field.Invalid(path.Child("variables"), policy.Annotations[conversion.DroppedFieldsAnnotation], err.Error()))
+	} else if len(variables) > 0 {
+		compiler := validatingadmissionpolicy.NewCompositionCompiler(variables, spec.ParamKind != nil, celconfig.PerCallLimit)
+		compileExpression = compiler.CompileExpression
+		for i, err := range compiler.VariableErrors() {
+			variablePath := path.Child("variables").Index(i)
+			if len(variables[i].Expression) == 0 {
+				errs = append(errs, field.Required(variablePath.Child("expression"), ""))
+			} else if err != nil {
+				errs = append(errs, field.Invalid(variablePath, variables[i].Name, err.Error()))
+			}
+		}
+	}
+
+	compile := func(path *field.Path, accessor cel.ExpressionAccessor, optionalVars cel.OptionalVariableDeclarations) {
+		if len(accessor.GetExpression()) == 0 {
+			errs = append(errs, field.Required(path, ""))
+			return
+		}
+		result := compileExpression(accessor, optionalVars, celconfig.PerCallLimit)
+		if result.Error != nil {
+			errs = append(errs, field.Invalid(path, accessor.GetExpression(), result.Error.Error()))
+		}
+	}
+
+	for i, validation := range spec.Validations {
+		validationPath := path.Child("validations").Index(i)
+		compile(validationPath.Child("expression"), &validatingadmissionpolicy.ValidationCondition{
+			Expression: validation.Expression,
+		}, optionalVars)
+		if len(validation.MessageExpression) > 0 {
+			compile(validationPath.Child("messageExpression"), &validatingadmissionpolicy.MessageExpressionCondition{
+				MessageExpression: validation.MessageExpression,
+			}, messageOptionalVars)
+		}
+	}
+
+	for i, auditAnnotation := range spec.AuditAnnotations {
+		auditAnnotationPath := path.Child("auditAnnotations").Index(i)
+		if len(auditAnnotation.Key) == 0 {
+			errs = append(errs, field.Required(auditAnnotationPath.Child("key"), ""))
+		}
+		compile(auditAnnotationPath.Child("valueExpression"), &validatingadmissionpolicy.AuditAnnotationCondition{
+			Key:             auditAnnotation.Key,
+			ValueExpression: auditAnnotation.ValueExpression,
+		}, optionalVars)
+	}
+
+	for i := range spec.MatchConditions {
+		matchConditionPath := path.Child("matchConditions").Index(i)
+		if len(spec.MatchConditions[i].Name) == 0 {
+			errs = append(errs, field.Required(matchConditionPath.Child("name"), ""))
+		}
+		compile(matchConditionPath.Child("expression"), (*matchconditions.MatchCondition)(&spec.MatchConditions[i]), optionalVars)
+	}
+
+	return errs
+}
+
+func validateBinding(path *field.Path, binding *admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding) field.ErrorList {
+	var errs field.ErrorList
+	spec := binding.Spec
+
+	if len(spec.PolicyName) == 0 {
+		errs = append(errs, field.Required(path.Child("policyName"), ""))
+	}
+
+	if spec.ParamRef != nil {
+		errs = append(errs, validateParamRef(path.Child("paramRef"), binding)...)
+	}
+
+	if len(spec.ValidationActions) == 0 {
+		errs = append(errs, field.Required(path.Child("validationActions"), ""))
+	}
+	supportedActions := []string{string(admissionregistrationv1alpha1.Deny), string(admissionregistrationv1alpha1.Warn), string(admissionregistrationv1alpha1.Audit)}
+	for i, action := range spec.ValidationActions {
+		switch action {
+		case admissionregistrationv1alpha1.Deny, admissionregistrationv1alpha1.Warn, admissionregistrationv1alpha1.Audit:
+		default:
+			errs = append(errs, field.NotSupported(path.Child("validationActions").Index(i), action, supportedActions))
+		}
+	}
+
+	return errs
+}
+
+func validateParamRef(path *field.Path, binding *admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding) field.ErrorList {
+	var errs field.ErrorList
+
+	// selector and parameterNotFoundAction are kept in an annotation by the
+	// v1alpha1 representation
+	dropped, err := conversion.ParamRef(binding)
+	if err != nil {
+		return append(errs, field.Invalid(path, binding.Annotations[conversion.DroppedFieldsAnnotation], err.Error()))
+	} else if dropped == nil {
+		dropped = &crdv1.ParamRef{}
+	}
+
+	hasName := len(binding.Spec.ParamRef.Name) > 0
+	switch {
+	case hasName && dropped.Selector != nil:
+		errs = append(errs, field.Forbidden(path.Child("name"), "name and selector are mutually exclusive"))
+	case !hasName && dropped.Selector == nil:
+		errs = append(errs, field.Required(path.Child("name"), "one of name or selector must be set"))
+	}
+
+	if dropped.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(dropped.Selector); err != nil {
+			errs = append(errs, field.Invalid(path.Child("selector"), dropped.Selector, err.Error()))
+		}
+	}
+
+	if action := dropped.ParameterNotFoundAction; action != nil {
+		switch *action {
+		case crdv1.AllowAction, crdv1.DenyAction:
+		default:
+			errs = append(errs, field.NotSupported(path.Child("parameterNotFoundAction"), *action, []string{string(crdv1.AllowAction), string(crdv1.DenyAction)}))
+		}
+	}
+
+	return errs
+}
+
+// RESTMapper returns a mapper which can resolve the kinds of every object in
+// the bundle, as well as any kind referred to as a paramKind. Kinds defined
+// by a CustomResourceDefinition in the bundle are mapped as it describes.
+// Other kinds are cluster-scoped if kube-apiserver serves them as such, and
+// namespaced otherwise, with their resource name guessed from the kind.
+func (b *Bundle) RESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	crds := b.customResources()
+	for _, gvk := range b.paramKinds() {
+		if crd, ok := crds[gvk.GroupKind()]; ok {
+			mapper.AddSpecific(gvk, gvk.GroupVersion().WithResource(crd.plural), gvk.GroupVersion().WithResource(crd.singular), crd.scope)
+			continue
+		}
+
+		plural, singular := meta.UnsafeGuessKindToResource(gvk)
+		if resource, ok := irregularResources[gvk.GroupKind()]; ok {
+			plural.Resource = resource
+		}
+		scope := meta.RESTScopeNamespace
+		if clusterScopedKinds.Has(gvk.GroupKind()) {
+			scope = meta.RESTScopeRoot
+		}
+		mapper.AddSpecific(gvk, plural, singular, scope)
+	}
+	return mapper
+}
+
+// Kinds kube-apiserver serves as cluster-scoped resources. Any other builtin
+// kind is namespaced.
+var clusterScopedKinds = sets.New(
+	schema.GroupKind{Kind: "ComponentStatus"},
+	schema.GroupKind{Kind: "Namespace"},
+	schema.GroupKind{Kind: "Node"},
+	schema.GroupKind{Kind: "PersistentVolume"},
+	schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"},
+	schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicy"},
+	schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicyBinding"},
+	schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"},
+	schema.GroupKind{Group: "admissionregistration.x-k8s.io", Kind: "ValidatingAdmissionPolicy"},
+	schema.GroupKind{Group: "admissionregistration.x-k8s.io", Kind: "ValidatingAdmissionPolicyBinding"},
+	schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+	schema.GroupKind{Group: "apiregistration.k8s.io", Kind: "APIService"},
+	schema.GroupKind{Group: "authentication.k8s.io", Kind: "SelfSubjectReview"},
+	schema.GroupKind{Group: "authentication.k8s.io", Kind: "TokenReview"},
+	schema.GroupKind{Group: "authorization.k8s.io", Kind: "SelfSubjectAccessReview"},
+	schema.GroupKind{Group: "authorization.k8s.io", Kind: "SelfSubjectRulesReview"},
+	schema.GroupKind{Group: "authorization.k8s.io", Kind: "SubjectAccessReview"},
+	schema.GroupKind{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"},
+	schema.GroupKind{Group: "certificates.k8s.io", Kind: "ClusterTrustBundle"},
+	schema.GroupKind{Group: "flowcontrol.apiserver.k8s.io", Kind: "FlowSchema"},
+	schema.GroupKind{Group: "flowcontrol.apiserver.k8s.io", Kind: "PriorityLevelConfiguration"},
+	schema.GroupKind{Group: "internal.apiserver.k8s.io", Kind: "StorageVersion"},
+	schema.GroupKind{Group: "networking.k8s.io", Kind: "ClusterCIDR"},
+	schema.GroupKind{Group: "networking.k8s.io", Kind: "IPAddress"},
+	schema.GroupKind{Group: "networking.k8s.io", Kind: "IngressClass"},
+	schema.GroupKind{Group: "node.k8s.io", Kind: "RuntimeClass"},
+	schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"},
+	schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"},
+	schema.GroupKind{Group: "resource.k8s.io", Kind: "ResourceClass"},
+	schema.GroupKind{Group: "scheduling.k8s.io", Kind: "PriorityClass"},
+	schema.GroupKind{Group: "storage.k8s.io", Kind: "CSIDriver"},
+	schema.GroupKind{Group: "storage.k8s.io", Kind: "CSINode"},
+	schema.GroupKind{Group: "storage.k8s.io", Kind: "StorageClass"},
+	schema.GroupKind{Group: "storage.k8s.io", Kind: "VolumeAttachment"},
+)
+
+// Builtin kinds whose resource name can not be guessed from the kind
+var irregularResources = map[schema.GroupKind]string{
+	{Kind: "Endpoints"}: "endpoints",
+}
+
+// A kind defined by a CustomResourceDefinition in the bundle
+type customResource struct {
+	plural   string
+	singular string
+	scope    meta.RESTScope
+}
+
+// customResources returns the kinds defined by the CustomResourceDefinitions
+// in the bundle. CustomResourceDefinitions are not known to bundleScheme, so
+// they are read from their unstructured representation.
+func (b *Bundle) customResources() map[schema.GroupKind]customResource {
+	res := map[schema.GroupKind]customResource{}
+	for _, obj := range b.Objects {
+		crd, ok := obj.(*unstructured.Unstructured)
+		if !ok || crd.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+			continue
+		}
+
+		group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+		plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+		singular, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "singular")
+		scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope")
+		if len(kind) == 0 || len(plural) == 0 {
+			continue
+		}
+		if len(singular) == 0 {
+			singular = strings.ToLower(kind)
+		}
+
+		resource := customResource{plural: plural, singular: singular, scope: meta.RESTScopeNamespace}
+		if scope == "Cluster" {
+			resource.scope = meta.RESTScopeRoot
+		}
+		res[schema.GroupKind{Group: group, Kind: kind}] = resource
+	}
+	return res
+}
+
+// Returns the kinds of all objects, and every policy's paramKind
+func (b *Bundle) paramKinds() []schema.GroupVersionKind {
+	var res []schema.GroupVersionKind
+	seen := map[schema.GroupVersionKind]bool{}
+	add := func(gvk schema.GroupVersionKind) {
+		if !seen[gvk] {
+			seen[gvk] = true
+			res = append(res, gvk)
+		}
+	}
+	for _, obj := range b.Objects {
+		add(objectKind(obj))
+	}
+	for _, policy := range b.Policies {
+		if policy.Spec.ParamKind == nil {
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(policy.Spec.ParamKind.APIVersion)
+		if err != nil {
+			continue
+		}
+		add(gv.WithKind(policy.Spec.ParamKind.Kind))
+	}
+	return res
+}
+
+// objectKind returns the GVK of an object in the bundle. Typed objects have
+// their TypeMeta cleared by the decoder, so the scheme is consulted for them.
+func objectKind(obj runtime.Object) schema.GroupVersionKind {
+	if gvk := obj.GetObjectKind().GroupVersionKind(); !gvk.Empty() {
+		return gvk
+	}
+	gvks, _, err := bundleScheme.ObjectKinds(obj)
+	if err != nil || len(gvks) == 0 {
+		return schema.GroupVersionKind{}
+	}
+	return gvks[0]
+}
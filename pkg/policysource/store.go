@@ -0,0 +1,138 @@
+package policysource
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	admissionregistrationv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	policiesResource   = admissionregistrationv1alpha1.SchemeGroupVersion.WithResource("validatingadmissionpolicies")
+	bindingsResource   = admissionregistrationv1alpha1.SchemeGroupVersion.WithResource("validatingadmissionpolicybindings")
+	namespacesResource = corev1.SchemeGroupVersion.WithResource("namespaces")
+)
+
+// objectStore serves the objects of a bundle to informers in place of an
+// apiserver. The objects never change, so watches never see an event.
+//
+// It implements dynamic.Interface for the informers of param kinds, which
+// read every object as unstructured.
+type objectStore struct {
+	objects map[schema.GroupVersionResource][]runtime.Object
+}
+
+var _ dynamic.Interface = &objectStore{}
+
+func newObjectStore(bundle *Bundle, mapper meta.RESTMapper) (*objectStore, error) {
+	s := &objectStore{objects: map[schema.GroupVersionResource][]runtime.Object{}}
+	for _, policy := range bundle.Policies {
+		s.objects[policiesResource] = append(s.objects[policiesResource], policy)
+	}
+	for _, binding := range bundle.Bindings {
+		s.objects[bindingsResource] = append(s.objects[bindingsResource], binding)
+	}
+	for _, obj := range bundle.Objects {
+		gvk := objectKind(obj)
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, err
+		}
+		s.objects[mapping.Resource] = append(s.objects[mapping.Resource], obj)
+	}
+	return s, nil
+}
+
+// injectInformers registers informers serving the store's policies, bindings
+// and namespaces with factory, so that it never uses its client
+func (s *objectStore) injectInformers(factory informers.SharedInformerFactory) {
+	for gvr, obj := range map[schema.GroupVersionResource]runtime.Object{
+		policiesResource:   &admissionregistrationv1alpha1.ValidatingAdmissionPolicy{},
+		bindingsResource:   &admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding{},
+		namespacesResource: &corev1.Namespace{},
+	} {
+		gvr, obj := gvr, obj
+		factory.InformerFor(obj, func(_ kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+			return cache.NewSharedIndexInformer(s.listWatch(gvr), obj, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		})
+	}
+}
+
+// listWatch lists the typed objects of gvr as they were loaded
+func (s *objectStore) listWatch(gvr schema.GroupVersionResource) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			list := &metav1.List{}
+			for _, obj := range s.list(gvr, "") {
+				list.Items = append(list.Items, runtime.RawExtension{Object: obj.DeepCopyObject()})
+			}
+			return list, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}
+}
+
+// list returns the objects of gvr in namespace, or in every namespace if it
+// is empty
+func (s *objectStore) list(gvr schema.GroupVersionResource, namespace string) []runtime.Object {
+	var res []runtime.Object
+	for _, obj := range s.objects[gvr] {
+		accessor, err := meta.Accessor(obj)
+		if err != nil || (len(namespace) > 0 && accessor.GetNamespace() != namespace) {
+			continue
+		}
+		res = append(res, obj)
+	}
+	return res
+}
+
+func (s *objectStore) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &storeResource{store: s, gvr: gvr}
+}
+
+// storeResource lists and watches the objects of a resource in the store.
+// Informers only ever list and watch, so no other method is implemented.
+type storeResource struct {
+	dynamic.NamespaceableResourceInterface
+
+	store     *objectStore
+	gvr       schema.GroupVersionResource
+	namespace string
+}
+
+func (r *storeResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return &storeResource{store: r.store, gvr: r.gvr, namespace: namespace}
+}
+
+func (r *storeResource) List(ctx context.Context, options metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	list := &unstructured.UnstructuredList{}
+	for _, obj := range r.store.list(r.gvr, r.namespace) {
+		data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s to unstructured: %w", r.gvr.Resource, err)
+		}
+		// Typed objects have their TypeMeta cleared by the decoder
+		item := unstructured.Unstructured{Object: data}
+		item.SetGroupVersionKind(objectKind(obj))
+		list.Items = append(list.Items, item)
+	}
+	return list, nil
+}
+
+func (r *storeResource) Watch(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+	return watch.NewFake(), nil
+}
@@ -0,0 +1,218 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	admissionv1 "k8s.io/api/admission/v1"
+
+	"k8s.io/cel-admission-webhook/pkg/webhook"
+)
+
+var (
+	deniedPattern  = regexp.MustCompile(`ValidatingAdmissionPolicy '([^']*)'(?: with binding '([^']*)')? denied request`)
+	warningPattern = regexp.MustCompile(`^Validation failed for ValidatingAdmissionPolicy '([^']*)' with binding '([^']*)'`)
+)
+
+// Key identifies the policy and binding responsible for a change in decision.
+// Both are empty if the change could not be attributed to a policy, and
+// Binding is empty if the policy itself is misconfigured.
+type Key struct {
+	Policy  string `json:"policy"`
+	Binding string `json:"binding"`
+}
+
+// Change is a single request whose decision differs from the recorded one
+type Change struct {
+	UID       string `json:"uid"`
+	Operation string `json:"operation"`
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Message   string `json:"message"`
+}
+
+type Group struct {
+	Key
+	NewlyDenied  []Change `json:"newlyDenied,omitempty"`
+	NewlyAllowed []Change `json:"newlyAllowed,omitempty"`
+	NewWarnings  []Change `json:"newWarnings,omitempty"`
+}
+
+type Report struct {
+	// Number of requests replayed
+	Requests int `json:"requests"`
+
+	// Number of requests which could not be evaluated
+	Errors int `json:"errors"`
+
+	// Changes grouped by the policy and binding responsible, sorted by key
+	Groups []*Group `json:"groups"`
+}
+
+// HasChanges returns whether any decision differed from the recorded one
+func (r *Report) HasChanges() bool {
+	return len(r.Groups) > 0
+}
+
+// Replay reviews every recorded request again with reviewer, and reports the
+// requests for which it reaches a different decision than was recorded.
+func Replay(ctx context.Context, reviewer *webhook.Reviewer, reviews []webhook.RecordedReview) (*Report, error) {
+	report := &Report{}
+	groups := map[Key]*Group{}
+	group := func(key Key) *Group {
+		g, ok := groups[key]
+		if !ok {
+			g = &Group{Key: key}
+			groups[key] = g
+		}
+		return g
+	}
+
+	for _, recorded := range reviews {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if recorded.Request == nil {
+			continue
+		}
+
+		report.Requests++
+		replayed, err := reviewer.Review(ctx, &admissionv1.AdmissionReview{Request: recorded.Request})
+		if err != nil {
+			report.Errors++
+			continue
+		}
+
+		before := recorded.Response
+		if before == nil {
+			// Assume allowed if the response was not recorded
+			before = &admissionv1.AdmissionResponse{Allowed: true}
+		}
+		after := replayed.Response
+
+		switch {
+		case before.Allowed && !after.Allowed:
+			message := resultMessage(after)
+			g := group(keyFor(deniedPattern, message))
+			g.NewlyDenied = append(g.NewlyDenied, changeFor(recorded.Request, message))
+		case !before.Allowed && after.Allowed:
+			message := resultMessage(before)
+			g := group(keyFor(deniedPattern, message))
+			g.NewlyAllowed = append(g.NewlyAllowed, changeFor(recorded.Request, message))
+		}
+
+		for _, w := range after.Warnings {
+			if contains(before.Warnings, w) {
+				continue
+			}
+			g := group(keyFor(warningPattern, w))
+			g.NewWarnings = append(g.NewWarnings, changeFor(recorded.Request, w))
+		}
+	}
+
+	for _, g := range groups {
+		report.Groups = append(report.Groups, g)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i].Key, report.Groups[j].Key
+		if a.Policy != b.Policy {
+			return a.Policy < b.Policy
+		}
+		return a.Binding < b.Binding
+	})
+	return report, nil
+}
+
+func keyFor(pattern *regexp.Regexp, message string) Key {
+	match := pattern.FindStringSubmatch(message)
+	if match == nil {
+		return Key{}
+	}
+	return Key{Policy: match[1], Binding: match[2]}
+}
+
+func changeFor(request *admissionv1.AdmissionRequest, message string) Change {
+	resource := request.Resource.Resource
+	if len(request.Resource.Group) > 0 {
+		resource += "." + request.Resource.Group
+	}
+	if len(request.SubResource) > 0 {
+		resource += "/" + request.SubResource
+	}
+
+	return Change{
+		UID:       string(request.UID),
+		Operation: string(request.Operation),
+		Resource:  resource,
+		Namespace: request.Namespace,
+		Name:      request.Name,
+		Message:   message,
+	}
+}
+
+func resultMessage(response *admissionv1.AdmissionResponse) string {
+	if response.Result == nil {
+		return ""
+	}
+	return response.Result.Message
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes a human readable summary of the report to out
+func (r *Report) Print(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Replayed %d requests, %d could not be evaluated\n", r.Requests, r.Errors)
+	if !r.HasChanges() {
+		fmt.Fprintln(w, "No decisions changed")
+	}
+
+	for _, g := range r.Groups {
+		fmt.Fprintln(w)
+		switch {
+		case len(g.Policy) == 0:
+			fmt.Fprintln(w, "Unattributed:")
+		case len(g.Binding) == 0:
+			fmt.Fprintf(w, "Policy %s:\n", g.Policy)
+		default:
+			fmt.Fprintf(w, "Policy %s, binding %s:\n", g.Policy, g.Binding)
+		}
+
+		for _, section := range []struct {
+			title   string
+			changes []Change
+		}{
+			{"newly denied", g.NewlyDenied},
+			{"newly allowed", g.NewlyAllowed},
+			{"new warnings", g.NewWarnings},
+		} {
+			if len(section.changes) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "  %s (%d):\n", section.title, len(section.changes))
+			for _, c := range section.changes {
+				name := c.Name
+				if len(c.Namespace) > 0 {
+					name = c.Namespace + "/" + c.Name
+				}
+				fmt.Fprintf(w, "    %s\t%s\t%s\t%s\n", c.Operation, c.Resource, name, strings.ReplaceAll(c.Message, "\n", " "))
+			}
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,166 @@
+package replay
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"k8s.io/cel-admission-webhook/pkg/policysource"
+	"k8s.io/cel-admission-webhook/pkg/webhook"
+)
+
+const candidatePolicies = `
+apiVersion: admissionregistration.x-k8s.io/v1alpha1
+kind: ValidatingAdmissionPolicy
+metadata:
+  name: require-team
+spec:
+  matchConstraints:
+    resourceRules:
+    - operations: ["CREATE", "UPDATE"]
+      apiGroups: [""]
+      apiVersions: ["v1"]
+      resources: ["configmaps"]
+  validations:
+  - expression: "'team' in object.metadata.labels"
+---
+apiVersion: admissionregistration.x-k8s.io/v1alpha1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: require-team-deny
+spec:
+  policyName: require-team
+  validationActions: [Deny]
+---
+apiVersion: admissionregistration.x-k8s.io/v1alpha1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: require-team-warn
+spec:
+  policyName: require-team
+  validationActions: [Warn]
+`
+
+// One recorded review per line: allowed and still allowed, allowed but now
+// denied, denied but now allowed. Then an audit event for a create which is
+// now denied, and a read which is skipped
+const traffic = `
+{"time":"2023-01-01T00:00:00Z","request":{"uid":"1","kind":{"group":"","version":"v1","kind":"ConfigMap"},"resource":{"group":"","version":"v1","resource":"configmaps"},"namespace":"default","name":"labelled","operation":"CREATE","userInfo":{},"object":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"labelled","namespace":"default","labels":{"team":"a"}}}},"response":{"uid":"1","allowed":true}}
+{"time":"2023-01-01T00:00:00Z","request":{"uid":"2","kind":{"group":"","version":"v1","kind":"ConfigMap"},"resource":{"group":"","version":"v1","resource":"configmaps"},"namespace":"default","name":"unlabelled","operation":"CREATE","userInfo":{},"object":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"unlabelled","namespace":"default"}}},"response":{"uid":"2","allowed":true}}
+{"time":"2023-01-01T00:00:00Z","request":{"uid":"3","kind":{"group":"","version":"v1","kind":"ConfigMap"},"resource":{"group":"","version":"v1","resource":"configmaps"},"namespace":"default","name":"was-denied","operation":"CREATE","userInfo":{},"object":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"was-denied","namespace":"default","labels":{"team":"a"}}}},"response":{"uid":"3","allowed":false,"status":{"message":"ValidatingAdmissionPolicy 'old-policy' with binding 'old-binding' denied request: nope","code":403}}}
+{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"RequestResponse","auditID":"4","stage":"ResponseComplete","verb":"create","user":{"username":"admin"},"objectRef":{"resource":"configmaps","namespace":"default","name":"audited","apiVersion":"v1"},"responseStatus":{"code":201},"requestObject":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"audited"}},"responseObject":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"audited","namespace":"default"}}}
+{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"RequestResponse","auditID":"5","stage":"ResponseComplete","verb":"get","objectRef":{"resource":"configmaps","namespace":"default","name":"audited","apiVersion":"v1"},"responseStatus":{"code":200}}
+`
+
+func TestReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	reviews, err := Read(strings.NewReader(traffic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 4 {
+		t.Fatalf("expected 4 reviews, got %d", len(reviews))
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "policies.yaml"), []byte(candidatePolicies), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := policysource.NewFileSource(dir, nil)
+	if err := source.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Replay(ctx, webhook.NewReviewer(clientsetscheme.Scheme, source), reviews)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requests != 4 || report.Errors != 0 {
+		t.Fatalf("expected 4 requests without errors, got %d and %d", report.Requests, report.Errors)
+	}
+
+	names := func(changes []Change) string {
+		var result []string
+		for _, c := range changes {
+			result = append(result, c.Name)
+		}
+		return strings.Join(result, ",")
+	}
+
+	var actual []string
+	for _, g := range report.Groups {
+		actual = append(actual, g.Policy+"/"+g.Binding+": denied="+names(g.NewlyDenied)+" allowed="+names(g.NewlyAllowed)+" warnings="+names(g.NewWarnings))
+	}
+	expected := []string{
+		"old-policy/old-binding: denied= allowed=was-denied warnings=",
+		"require-team/require-team-deny: denied=unlabelled,audited allowed= warnings=",
+		"require-team/require-team-warn: denied= allowed= warnings=unlabelled,audited",
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestReadAuditEventStatus(t *testing.T) {
+	event := func(status string) string {
+		return `{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"RequestResponse","auditID":"1","stage":"ResponseComplete","verb":"create","user":{"username":"admin"},` +
+			`"objectRef":{"resource":"configmaps","namespace":"default","name":"a","apiVersion":"v1"},"responseStatus":` + status + `,` +
+			`"requestObject":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}}`
+	}
+
+	for _, testCase := range []struct {
+		name     string
+		status   string
+		expected []bool
+	}{
+		{
+			name:     "created",
+			status:   `{"code":201}`,
+			expected: []bool{true},
+		},
+		{
+			name:     "denied by webhook",
+			status:   `{"code":403,"message":"admission webhook \"policy.example.com\" denied the request: nope"}`,
+			expected: []bool{false},
+		},
+		{
+			name:     "denied by policy",
+			status:   `{"code":422,"message":"configmaps \"a\" is invalid: ValidatingAdmissionPolicy 'p' with binding 'b' denied request: nope"}`,
+			expected: []bool{false},
+		},
+		{
+			name:   "forbidden by RBAC",
+			status: `{"code":403,"reason":"Forbidden","message":"configmaps is forbidden: User \"admin\" cannot create resource \"configmaps\" in API group \"\" in the namespace \"default\""}`,
+		},
+		{
+			name:   "conflict",
+			status: `{"code":409,"reason":"AlreadyExists","message":"configmaps \"a\" already exists"}`,
+		},
+		{
+			name:   "invalid",
+			status: `{"code":422,"reason":"Invalid","message":"ConfigMap \"a\" is invalid: data: Invalid value"}`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			reviews, err := Read(strings.NewReader(event(testCase.status)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var allowed []bool
+			for _, review := range reviews {
+				allowed = append(allowed, review.Response.Allowed)
+			}
+			if !reflect.DeepEqual(allowed, testCase.expected) {
+				t.Errorf("expected reviews allowed %v, got %v", testCase.expected, allowed)
+			}
+		})
+	}
+}
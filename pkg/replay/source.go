@@ -0,0 +1,169 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+
+	"k8s.io/cel-admission-webhook/pkg/webhook"
+)
+
+// Largest single line accepted from a recording or audit log
+const maxLineSize = 16 * 1024 * 1024
+
+// Matches the messages of requests denied by admission webhooks or
+// ValidatingAdmissionPolicies
+var admissionDeniedPattern = regexp.MustCompile(`admission webhook "[^"]*" denied the request|ValidatingAdmissionPolicy '[^']*'(?: with binding '[^']*')? denied request`)
+
+// Read decodes the admission requests and their recorded responses from
+// either a recording written by webhook.Recorder, or a kube-apiserver audit
+// log written at the RequestResponse level. The format is detected for each
+// line.
+//
+// Audit events which did not reach admission, such as reads, are skipped, as
+// are writes which failed for reasons other than admission denying them, such
+// as conflicts, invalid objects or missing RBAC permissions.
+// Audit logs do not contain the old object of updates or deletes, so policies
+// which refer to oldObject can not be replayed accurately from them.
+func Read(in io.Reader) ([]webhook.RecordedReview, error) {
+	var reviews []webhook.RecordedReview
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+
+		var probe struct {
+			Kind    string          `json:"kind"`
+			Request json.RawMessage `json:"request"`
+		}
+		if err := json.Unmarshal(data, &probe); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		switch {
+		case len(probe.Request) > 0:
+			var review webhook.RecordedReview
+			if err := json.Unmarshal(data, &review); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			reviews = append(reviews, review)
+		case probe.Kind == "Event":
+			var event auditv1.Event
+			if err := json.Unmarshal(data, &event); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			review, ok, err := fromAuditEvent(&event)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			} else if ok {
+				reviews = append(reviews, *review)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: neither a recorded review nor an audit event", line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// fromAuditEvent reconstructs the admission request of a write from its audit
+// event. Returns false if the event is not for a write which reached
+// admission.
+func fromAuditEvent(event *auditv1.Event) (*webhook.RecordedReview, bool, error) {
+	if event.Stage != auditv1.StageResponseComplete || event.ObjectRef == nil {
+		return nil, false, nil
+	}
+
+	var operation admissionv1.Operation
+	switch event.Verb {
+	case "create":
+		operation = admissionv1.Create
+	case "update", "patch":
+		operation = admissionv1.Update
+	case "delete", "deletecollection":
+		operation = admissionv1.Delete
+	default:
+		return nil, false, nil
+	}
+
+	// The response object is what was persisted, which is closer than the
+	// request object to what admission saw. Patches in particular are only
+	// usable from the response
+	var object runtime.RawExtension
+	switch {
+	case operation == admissionv1.Delete:
+	case event.ResponseObject != nil && isObject(event.ResponseObject.Raw):
+		object = runtime.RawExtension{Raw: event.ResponseObject.Raw}
+	case event.RequestObject != nil && event.Verb != "patch" && isObject(event.RequestObject.Raw):
+		object = runtime.RawExtension{Raw: event.RequestObject.Raw}
+	default:
+		// Not logged at RequestResponse level
+		return nil, false, nil
+	}
+
+	ref := event.ObjectRef
+	kind := metav1.GroupVersionKind{Group: ref.APIGroup, Version: ref.APIVersion}
+	if len(object.Raw) > 0 {
+		var typeMeta metav1.TypeMeta
+		if err := json.Unmarshal(object.Raw, &typeMeta); err != nil {
+			return nil, false, err
+		}
+		gvk := typeMeta.GroupVersionKind()
+		kind = metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}
+	}
+
+	allowed := event.ResponseStatus == nil || event.ResponseStatus.Code < 400
+	if !allowed && !admissionDeniedPattern.MatchString(event.ResponseStatus.Message) {
+		// Failed for another reason, which says nothing about whether
+		// admission would have allowed it
+		return nil, false, nil
+	}
+	response := &admissionv1.AdmissionResponse{
+		UID:     event.AuditID,
+		Allowed: allowed,
+	}
+	if !allowed {
+		response.Result = event.ResponseStatus
+	}
+
+	return &webhook.RecordedReview{
+		Time: event.StageTimestamp.Time,
+		Request: &admissionv1.AdmissionRequest{
+			UID:         event.AuditID,
+			Kind:        kind,
+			Resource:    metav1.GroupVersionResource{Group: ref.APIGroup, Version: ref.APIVersion, Resource: ref.Resource},
+			SubResource: ref.Subresource,
+			Name:        ref.Name,
+			Namespace:   ref.Namespace,
+			Operation:   operation,
+			UserInfo:    event.User,
+			Object:      object,
+		},
+		Response: response,
+	}, true, nil
+}
+
+// isObject returns whether raw is a Kubernetes object, rather than a Status
+// or patch
+func isObject(raw []byte) bool {
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(raw, &typeMeta); err != nil {
+		return false
+	}
+	return len(typeMeta.Kind) > 0 && typeMeta.Kind != "Status"
+}
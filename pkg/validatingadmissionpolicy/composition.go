@@ -0,0 +1,642 @@
+package validatingadmissionpolicy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+
+	celgo "github.com/google/cel-go/cel"
+	celtypes "github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/interpreter"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/api/admissionregistration/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	apiservercel "k8s.io/apiserver/pkg/cel"
+	"k8s.io/apiserver/pkg/cel/library"
+
+	"k8s.io/cel-admission-webhook/pkg/conversion"
+)
+
+// VariablesVarName is the CEL variable a policy's variables are available
+// under, as variables.<name>
+const VariablesVarName = "variables"
+
+const variablesTypeName = "kubernetes.variables"
+
+var variableNamePattern = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+
+// Variable is a named expression of a policy's spec.variables
+type Variable struct {
+	Name       string
+	Expression string
+}
+
+func (v *Variable) GetExpression() string {
+	return v.Expression
+}
+
+func (v *Variable) ReturnTypes() []*celgo.Type {
+	return []*celgo.Type{celgo.AnyType}
+}
+
+// CompositionCompiler compiles expressions which may refer to a policy's
+// variables. Each variable may only refer to the variables declared before
+// it, which is checked when it is compiled.
+//
+// Variables are evaluated lazily, the first time an expression refers to
+// them, and their result and cost are shared by every filter the compiler
+// compiles for the rest of the evaluation. See withCompositionScope.
+type CompositionCompiler struct {
+	hasParams bool
+	variables []compiledVariable
+	index     map[string]int
+
+	// Type of the variables variable, with a field for each variable
+	variablesType *apiservercel.DeclType
+
+	lock sync.Mutex
+	envs map[cel.OptionalVariableDeclarations]*celgo.Env
+}
+
+type compiledVariable struct {
+	name   string
+	result cel.CompilationResult
+}
+
+var _ cel.FilterCompiler = &CompositionCompiler{}
+
+// NewCompositionCompiler compiles variables in order. Variables are compiled
+// without the authorizer, as they are shared by validations and
+// messageExpressions.
+func NewCompositionCompiler(variables []Variable, hasParams bool, perCallLimit uint64) *CompositionCompiler {
+	c := &CompositionCompiler{
+		hasParams: hasParams,
+		index:     make(map[string]int, len(variables)),
+		envs:      map[cel.OptionalVariableDeclarations]*celgo.Env{},
+	}
+
+	fields := make(map[string]*apiservercel.DeclField, len(variables))
+	for i := range variables {
+		variable := &variables[i]
+		compiled := compiledVariable{name: variable.Name}
+
+		if !variableNamePattern.MatchString(variable.Name) {
+			compiled.result = compilationError(variable, apiservercel.ErrorTypeInvalid, fmt.Sprintf("variable name %q is not a valid CEL identifier", variable.Name))
+		} else if _, ok := c.index[variable.Name]; ok {
+			compiled.result = compilationError(variable, apiservercel.ErrorTypeInvalid, fmt.Sprintf("duplicate variable name %q", variable.Name))
+		} else {
+			declType := apiservercel.DynType
+			env, err := buildCompositionEnv(cel.OptionalVariableDeclarations{HasParams: hasParams}, newVariablesType(fields))
+			if err != nil {
+				compiled.result = compilationError(variable, apiservercel.ErrorTypeInternal, "compiler initialization failed: "+err.Error())
+			} else {
+				var outputType *celgo.Type
+				compiled.result, outputType = compile(env, variable, perCallLimit)
+				declType = outputDeclType(outputType)
+			}
+
+			// Variables which fail to compile are still declared, so that
+			// referring to them is an evaluation error rather than also
+			// failing to compile
+			fields[variable.Name] = apiservercel.NewDeclField(variable.Name, declType, true, nil, nil)
+			c.index[variable.Name] = len(c.variables)
+		}
+
+		c.variables = append(c.variables, compiled)
+	}
+	c.variablesType = newVariablesType(fields)
+
+	return c
+}
+
+// VariableErrors returns the compilation error of each variable, in the
+// order they were declared. Variables which compiled have a nil error.
+func (c *CompositionCompiler) VariableErrors() []error {
+	errs := make([]error, len(c.variables))
+	for i, variable := range c.variables {
+		if variable.result.Error != nil {
+			errs[i] = variable.result.Error
+		}
+	}
+	return errs
+}
+
+// CompileExpression compiles a single expression with every variable
+// declared
+func (c *CompositionCompiler) CompileExpression(expression cel.ExpressionAccessor, options cel.OptionalVariableDeclarations, perCallLimit uint64) cel.CompilationResult {
+	env, err := c.env(options)
+	if err != nil {
+		return compilationError(expression, apiservercel.ErrorTypeInternal, "compiler initialization failed: "+err.Error())
+	}
+	return compileExpression(env, expression, perCallLimit)
+}
+
+// Compile implements cel.FilterCompiler
+func (c *CompositionCompiler) Compile(expressions []cel.ExpressionAccessor, options cel.OptionalVariableDeclarations, perCallLimit uint64) cel.Filter {
+	results := make([]cel.CompilationResult, len(expressions))
+	for i, expression := range expressions {
+		if expression == nil {
+			continue
+		}
+		results[i] = c.CompileExpression(expression, options, perCallLimit)
+	}
+	return &compositionFilter{compiler: c, compilationResults: results}
+}
+
+func (c *CompositionCompiler) env(options cel.OptionalVariableDeclarations) (*celgo.Env, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if env, ok := c.envs[options]; ok {
+		return env, nil
+	}
+	env, err := buildCompositionEnv(options, c.variablesType)
+	if err != nil {
+		return nil, err
+	}
+	c.envs[options] = env
+	return env, nil
+}
+
+// PolicyVariables returns the variables of a policy, which the native
+// v1alpha1 type keeps in the annotation its x-k8s conversion leaves
+func PolicyVariables(policy *v1alpha1.ValidatingAdmissionPolicy) ([]Variable, error) {
+	variables, err := conversion.Variables(policy)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Variable, len(variables))
+	for i, variable := range variables {
+		result[i] = Variable{Name: variable.Name, Expression: variable.Expression}
+	}
+	return result, nil
+}
+
+// dynVariablesType declares each of variables as dyn
+func dynVariablesType(variables []Variable) *apiservercel.DeclType {
+	fields := make(map[string]*apiservercel.DeclField, len(variables))
+	for _, variable := range variables {
+		fields[variable.Name] = apiservercel.NewDeclField(variable.Name, apiservercel.DynType, true, nil, nil)
+	}
+	return apiservercel.NewObjectType(variablesTypeName, fields)
+}
+
+func newVariablesType(fields map[string]*apiservercel.DeclField) *apiservercel.DeclType {
+	copied := make(map[string]*apiservercel.DeclField, len(fields))
+	for name, field := range fields {
+		copied[name] = field
+	}
+	return apiservercel.NewObjectType(variablesTypeName, copied)
+}
+
+// outputDeclType returns the type variables.<name> is declared with. Only
+// scalar types are kept, everything else is declared dyn.
+func outputDeclType(outputType *celgo.Type) *apiservercel.DeclType {
+	switch outputType {
+	case celgo.BoolType:
+		return apiservercel.BoolType
+	case celgo.IntType:
+		return apiservercel.IntType
+	case celgo.UintType:
+		return apiservercel.UintType
+	case celgo.DoubleType:
+		return apiservercel.DoubleType
+	case celgo.StringType:
+		return apiservercel.StringType
+	case celgo.BytesType:
+		return apiservercel.BytesType
+	case celgo.DurationType:
+		return apiservercel.DurationType
+	case celgo.TimestampType:
+		return apiservercel.TimestampType
+	default:
+		return apiservercel.DynType
+	}
+}
+
+// buildCompositionEnv builds the same environment as the upstream filter
+// compiler, with variables declared as variablesType
+func buildCompositionEnv(options cel.OptionalVariableDeclarations, variablesType *apiservercel.DeclType) (*celgo.Env, error) {
+	baseEnv, err := getBaseEnv()
+	if err != nil {
+		return nil, err
+	}
+	reg := apiservercel.NewRegistry(baseEnv)
+
+	var rts []*apiservercel.RuleTypes
+	var varOpts []celgo.EnvOption
+
+	rt, opts, err := createRuleTypesAndOptions(reg, cel.BuildRequestType(), cel.RequestVarName)
+	if err != nil {
+		return nil, err
+	}
+	rts = append(rts, rt)
+	varOpts = append(varOpts, opts...)
+
+	rt, opts, err = createRuleTypesAndOptions(reg, variablesType, VariablesVarName)
+	if err != nil {
+		return nil, err
+	}
+	rts = append(rts, rt)
+	varOpts = append(varOpts, opts...)
+
+	varOpts = append(varOpts,
+		celgo.Variable(cel.ObjectVarName, celgo.DynType),
+		celgo.Variable(cel.OldObjectVarName, celgo.DynType),
+	)
+	if options.HasParams {
+		varOpts = append(varOpts, celgo.Variable(cel.ParamsVarName, celgo.DynType))
+	}
+	if options.HasAuthorizer {
+		varOpts = append(varOpts,
+			celgo.Variable(cel.AuthorizerVarName, library.AuthorizerType),
+			celgo.Variable(cel.RequestResourceAuthorizerVarName, library.ResourceCheckType),
+		)
+	}
+
+	typeOpts, err := ruleTypesOpts(rts, baseEnv.TypeProvider())
+	if err != nil {
+		return nil, err
+	}
+	return baseEnv.Extend(append(typeOpts, varOpts...)...)
+}
+
+// compileExpression compiles an expression the same way as
+// cel.CompileCELExpression. Expressions which evaluate to dyn, such as those
+// which return a variable of a non-scalar type, are accepted for any return
+// type and checked when they are evaluated.
+func compileExpression(env *celgo.Env, expression cel.ExpressionAccessor, perCallLimit uint64) cel.CompilationResult {
+	result, _ := compile(env, expression, perCallLimit)
+	return result
+}
+
+// compile compiles an expression, also returning its output type if it
+// compiled
+func compile(env *celgo.Env, expression cel.ExpressionAccessor, perCallLimit uint64) (cel.CompilationResult, *celgo.Type) {
+	ast, issues := env.Compile(expression.GetExpression())
+	if issues != nil {
+		return compilationError(expression, apiservercel.ErrorTypeInvalid, "compilation failed: "+issues.String()), nil
+	}
+
+	returnTypes := expression.ReturnTypes()
+	found := false
+	for _, returnType := range returnTypes {
+		if returnType == celgo.AnyType || ast.OutputType() == returnType || ast.OutputType() == celgo.DynType {
+			found = true
+			break
+		}
+	}
+	if !found {
+		reason := fmt.Sprintf("must evaluate to one of %v", returnTypes)
+		if len(returnTypes) == 1 {
+			reason = fmt.Sprintf("must evaluate to %v", returnTypes[0].String())
+		}
+		return compilationError(expression, apiservercel.ErrorTypeInvalid, reason), nil
+	}
+
+	prog, err := env.Program(ast,
+		celgo.EvalOptions(celgo.OptOptimize, celgo.OptTrackCost),
+		celgo.OptimizeRegex(library.ExtensionLibRegexOptimizations...),
+		celgo.InterruptCheckFrequency(celconfig.CheckFrequency),
+		celgo.CostLimit(perCallLimit),
+	)
+	if err != nil {
+		return compilationError(expression, apiservercel.ErrorTypeInvalid, "program instantiation failed: "+err.Error()), nil
+	}
+	return cel.CompilationResult{
+		Program:            prog,
+		ExpressionAccessor: expression,
+	}, ast.OutputType()
+}
+
+func compilationError(expression cel.ExpressionAccessor, errorType apiservercel.ErrorType, detail string) cel.CompilationResult {
+	return cel.CompilationResult{
+		Error:              &apiservercel.Error{Type: errorType, Detail: detail},
+		ExpressionAccessor: expression,
+	}
+}
+
+type compositionScopeKey struct{}
+
+// compositionScope holds the variables evaluated so far for each compiler
+type compositionScope struct {
+	lock      sync.Mutex
+	variables map[*CompositionCompiler]*variablesValue
+}
+
+// withCompositionScope returns a context in which the variables of each
+// policy are evaluated at most once. Validators start a new scope for each
+// binding and param they evaluate.
+func withCompositionScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, compositionScopeKey{}, &compositionScope{})
+}
+
+// variablesFor returns the variables of compiler in the scope of ctx. If ctx
+// has no scope, the variables are only shared by the caller.
+func variablesFor(ctx context.Context, compiler *CompositionCompiler, activation *compositionActivation) *variablesValue {
+	scope, ok := ctx.Value(compositionScopeKey{}).(*compositionScope)
+	if !ok {
+		return newVariablesValue(ctx, compiler, activation)
+	}
+
+	scope.lock.Lock()
+	defer scope.lock.Unlock()
+	if scope.variables == nil {
+		scope.variables = map[*CompositionCompiler]*variablesValue{}
+	}
+	if v, ok := scope.variables[compiler]; ok {
+		return v
+	}
+	v := newVariablesValue(ctx, compiler, activation)
+	scope.variables[compiler] = v
+	return v
+}
+
+type compositionActivation struct {
+	object, oldObject, params, request, authorizer, requestResourceAuthorizer interface{}
+	variables                                                                 *variablesValue
+}
+
+func (a *compositionActivation) ResolveName(name string) (interface{}, bool) {
+	switch name {
+	case cel.ObjectVarName:
+		return a.object, true
+	case cel.OldObjectVarName:
+		return a.oldObject, true
+	case cel.ParamsVarName:
+		return a.params, true // params may be null
+	case cel.RequestVarName:
+		return a.request, true
+	case cel.AuthorizerVarName:
+		return a.authorizer, a.authorizer != nil
+	case cel.RequestResourceAuthorizerVarName:
+		return a.requestResourceAuthorizer, a.requestResourceAuthorizer != nil
+	case VariablesVarName:
+		return a.variables, a.variables != nil
+	default:
+		return nil, false
+	}
+}
+
+func (a *compositionActivation) Parent() interpreter.Activation {
+	return nil
+}
+
+// variablesValue is the value of the variables variable. Each variable is
+// evaluated the first time it is looked up, and its result kept.
+type variablesValue struct {
+	ctx        context.Context
+	compiler   *CompositionCompiler
+	activation *compositionActivation
+
+	lock    sync.Mutex
+	results map[string]ref.Val
+
+	// Runtime cost of every variable evaluated so far
+	cost int64
+}
+
+var _ traits.Mapper = &variablesValue{}
+
+func newVariablesValue(ctx context.Context, compiler *CompositionCompiler, activation *compositionActivation) *variablesValue {
+	v := &variablesValue{
+		ctx:      ctx,
+		compiler: compiler,
+		results:  map[string]ref.Val{},
+	}
+
+	// Variables are evaluated without the authorizer
+	v.activation = &compositionActivation{
+		object:    activation.object,
+		oldObject: activation.oldObject,
+		params:    activation.params,
+		request:   activation.request,
+		variables: v,
+	}
+	return v
+}
+
+func (v *variablesValue) totalCost() int64 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.cost
+}
+
+func (v *variablesValue) Find(key ref.Val) (ref.Val, bool) {
+	name, ok := key.(celtypes.String)
+	if !ok {
+		return nil, false
+	}
+	i, ok := v.compiler.index[string(name)]
+	if !ok {
+		return nil, false
+	}
+
+	v.lock.Lock()
+	result, ok := v.results[string(name)]
+	v.lock.Unlock()
+	if ok {
+		return result, true
+	}
+
+	// Variables are only evaluated by expressions declared after them, so
+	// evaluating one never needs the lock held
+	result, cost := v.evaluate(v.compiler.variables[i])
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if existing, ok := v.results[string(name)]; ok {
+		return existing, true
+	}
+	v.results[string(name)] = result
+	v.cost += cost
+	return result, true
+}
+
+func (v *variablesValue) evaluate(variable compiledVariable) (ref.Val, int64) {
+	if variable.result.Error != nil {
+		return celtypes.NewErr("variable %q failed to compile: %v", variable.name, variable.result.Error), 0
+	}
+
+	val, details, err := variable.result.Program.ContextEval(v.ctx, v.activation)
+	var cost int64
+	if details != nil && details.ActualCost() != nil {
+		cost = int64(math.Min(float64(*details.ActualCost()), math.MaxInt64))
+	}
+	if err != nil {
+		return celtypes.NewErr("variable %q failed to evaluate: %v", variable.name, err), cost
+	}
+	return val, cost
+}
+
+func (v *variablesValue) Contains(key ref.Val) ref.Val {
+	_, found := v.Find(key)
+	return celtypes.Bool(found)
+}
+
+func (v *variablesValue) Get(key ref.Val) ref.Val {
+	val, found := v.Find(key)
+	if !found {
+		return celtypes.NewErr("no such key: %v", key)
+	}
+	return val
+}
+
+func (v *variablesValue) Iterator() traits.Iterator {
+	names := make([]string, 0, len(v.compiler.index))
+	for i, variable := range v.compiler.variables {
+		if j, ok := v.compiler.index[variable.name]; ok && i == j {
+			names = append(names, variable.name)
+		}
+	}
+	return celtypes.NewStringList(celtypes.DefaultTypeAdapter, names).Iterator()
+}
+
+func (v *variablesValue) Size() ref.Val {
+	return celtypes.Int(len(v.compiler.index))
+}
+
+func (v *variablesValue) ConvertToNative(typeDesc reflect.Type) (interface{}, error) {
+	return nil, fmt.Errorf("variables can not be converted to %v", typeDesc)
+}
+
+func (v *variablesValue) ConvertToType(typeValue ref.Type) ref.Val {
+	if typeValue == celtypes.TypeType {
+		return v.Type().(ref.Val)
+	}
+	return celtypes.NewErr("variables can not be converted to %v", typeValue)
+}
+
+func (v *variablesValue) Equal(other ref.Val) ref.Val {
+	return celtypes.MaybeNoSuchOverloadErr(other)
+}
+
+func (v *variablesValue) Type() ref.Type {
+	return celtypes.NewObjectTypeValue(variablesTypeName)
+}
+
+func (v *variablesValue) Value() interface{} {
+	return v
+}
+
+// compositionFilter evaluates expressions compiled by a CompositionCompiler.
+// It behaves as the upstream filter, and also charges the cost of every
+// variable evaluated to the budget, once.
+type compositionFilter struct {
+	compiler           *CompositionCompiler
+	compilationResults []cel.CompilationResult
+}
+
+func (f *compositionFilter) ForInput(ctx context.Context, versionedAttr *admission.VersionedAttributes, request *admissionv1.AdmissionRequest, inputs cel.OptionalVariableBindings, runtimeCELCostBudget int64) ([]cel.EvaluationResult, int64, error) {
+	evaluations := make([]cel.EvaluationResult, len(f.compilationResults))
+
+	oldObjectVal, err := objectToResolveVal(versionedAttr.VersionedOldObject)
+	if err != nil {
+		return nil, -1, err
+	}
+	objectVal, err := objectToResolveVal(versionedAttr.VersionedObject)
+	if err != nil {
+		return nil, -1, err
+	}
+	var paramsVal, authorizerVal, requestResourceAuthorizerVal any
+	if inputs.VersionedParams != nil {
+		paramsVal, err = objectToResolveVal(inputs.VersionedParams)
+		if err != nil {
+			return nil, -1, err
+		}
+	}
+	if inputs.Authorizer != nil {
+		authorizerVal = library.NewAuthorizerVal(versionedAttr.GetUserInfo(), inputs.Authorizer)
+		requestResourceAuthorizerVal = library.NewResourceAuthorizerVal(versionedAttr.GetUserInfo(), inputs.Authorizer, versionedAttr)
+	}
+	requestVal, err := runtime.DefaultUnstructuredConverter.ToUnstructured(request)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	va := &compositionActivation{
+		object:                    objectVal,
+		oldObject:                 oldObjectVal,
+		params:                    paramsVal,
+		request:                   requestVal,
+		authorizer:                authorizerVal,
+		requestResourceAuthorizer: requestResourceAuthorizerVal,
+	}
+	va.variables = variablesFor(ctx, f.compiler, va)
+
+	remainingBudget := runtimeCELCostBudget
+	for i, compilationResult := range f.compilationResults {
+		evaluation := &evaluations[i]
+		if compilationResult.ExpressionAccessor == nil { // in case of placeholder
+			continue
+		}
+		evaluation.ExpressionAccessor = compilationResult.ExpressionAccessor
+		if compilationResult.Error != nil {
+			evaluation.Error = &apiservercel.Error{
+				Type:   apiservercel.ErrorTypeInvalid,
+				Detail: fmt.Sprintf("compilation error: %v", compilationResult.Error),
+			}
+			continue
+		}
+
+		variablesCost := va.variables.totalCost()
+		t1 := time.Now()
+		evalResult, evalDetails, err := compilationResult.Program.ContextEval(ctx, va)
+		evaluation.Elapsed = time.Since(t1)
+		if evalDetails == nil || evalDetails.ActualCost() == nil {
+			return nil, -1, &apiservercel.Error{
+				Type:   apiservercel.ErrorTypeInternal,
+				Detail: fmt.Sprintf("runtime cost could not be calculated for expression: %v, no further expression will be run", compilationResult.ExpressionAccessor.GetExpression()),
+			}
+		}
+
+		// Variables first evaluated by this expression are charged to it
+		rtCost := *evalDetails.ActualCost()
+		variablesCost = va.variables.totalCost() - variablesCost
+		if rtCost > math.MaxInt64 || int64(rtCost) > remainingBudget-variablesCost {
+			return nil, -1, &apiservercel.Error{
+				Type:   apiservercel.ErrorTypeInvalid,
+				Detail: "validation failed due to running out of cost budget, no further validation rules will be run",
+			}
+		}
+		remainingBudget -= int64(rtCost) + variablesCost
+
+		if err != nil {
+			evaluation.Error = &apiservercel.Error{
+				Type:   apiservercel.ErrorTypeInvalid,
+				Detail: fmt.Sprintf("expression '%v' resulted in error: %v", compilationResult.ExpressionAccessor.GetExpression(), err),
+			}
+		} else {
+			evaluation.EvalResult = evalResult
+		}
+	}
+
+	return evaluations, remainingBudget, nil
+}
+
+func (f *compositionFilter) CompilationErrors() []error {
+	var errs []error
+	for _, result := range f.compilationResults {
+		if result.Error != nil {
+			errs = append(errs, result.Error)
+		}
+	}
+	return errs
+}
+
+func objectToResolveVal(r runtime.Object) (interface{}, error) {
+	if r == nil || reflect.ValueOf(r).IsNil() {
+		return nil, nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(r)
+}
@@ -0,0 +1,147 @@
+package validatingadmissionpolicy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func compositionAttributes() *admission.VersionedAttributes {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"},
+		Data:       map[string]string{"a": "1", "b": "2", "c": "3"},
+	}
+	attributes := admission.NewAttributesRecord(
+		cm, nil,
+		corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		"default", "cm",
+		corev1.SchemeGroupVersion.WithResource("configmaps"),
+		"",
+		admission.Create,
+		&metav1.CreateOptions{},
+		false,
+		&user.DefaultInfo{Name: "test"},
+	)
+	return &admission.VersionedAttributes{
+		Attributes:      attributes,
+		VersionedKind:   corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		VersionedObject: cm,
+	}
+}
+
+func TestCompositionCompiler(t *testing.T) {
+	variables := []Variable{
+		{Name: "keys", Expression: "object.data.map(k, k + k)"},
+		{Name: "size", Expression: "size(variables.keys)"},
+		{Name: "later", Expression: "variables.missing"},
+		{Name: "keys", Expression: "1"},
+		{Name: "not-a-name", Expression: "1"},
+	}
+	compiler := NewCompositionCompiler(variables, false, celconfig.PerCallLimit)
+
+	for i, expected := range []string{"", "", "undefined field 'missing'", "duplicate variable name", "not a valid CEL identifier"} {
+		err := compiler.VariableErrors()[i]
+		if len(expected) == 0 && err != nil {
+			t.Errorf("variable %d: unexpected error: %v", i, err)
+		} else if len(expected) > 0 && (err == nil || !strings.Contains(err.Error(), expected)) {
+			t.Errorf("variable %d: expected error containing %q, got %v", i, expected, err)
+		}
+	}
+
+	options := cel.OptionalVariableDeclarations{}
+	single := compiler.Compile([]cel.ExpressionAccessor{
+		&ValidationCondition{Expression: "variables.size == 3"},
+	}, options, celconfig.PerCallLimit)
+	double := compiler.Compile([]cel.ExpressionAccessor{
+		&ValidationCondition{Expression: "variables.size == 3"},
+		&ValidationCondition{Expression: "variables.keys.all(k, k.size() == 2)"},
+	}, options, celconfig.PerCallLimit)
+	unused := compiler.Compile([]cel.ExpressionAccessor{
+		&ValidationCondition{Expression: "true"},
+	}, options, celconfig.PerCallLimit)
+
+	cost := func(ctx context.Context, filter cel.Filter) int64 {
+		t.Helper()
+		var budget int64 = celconfig.RuntimeCELCostBudget
+		attributes := compositionAttributes()
+		results, remaining, err := filter.ForInput(ctx, attributes, cel.CreateAdmissionRequest(attributes.Attributes), cel.OptionalVariableBindings{}, budget)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			if result.Error != nil {
+				t.Fatalf("%s: %v", result.ExpressionAccessor.GetExpression(), result.Error)
+			} else if result.EvalResult.Value() != true {
+				t.Fatalf("%s: expected true, got %v", result.ExpressionAccessor.GetExpression(), result.EvalResult)
+			}
+		}
+		return budget - remaining
+	}
+
+	// Variables are charged to the first expression which uses them
+	ctx := withCompositionScope(context.Background())
+	singleCost := cost(ctx, single)
+	if unusedCost := cost(context.Background(), unused); singleCost <= unusedCost {
+		t.Errorf("expected variables to be charged, got %d for variables and %d without", singleCost, unusedCost)
+	}
+	if again := cost(ctx, single); again >= singleCost {
+		t.Errorf("expected variables to be charged once per scope, got %d then %d", singleCost, again)
+	}
+	if fresh := cost(withCompositionScope(context.Background()), single); fresh != singleCost {
+		t.Errorf("expected a new scope to evaluate variables again, got %d and %d", singleCost, fresh)
+	}
+
+	// keys is only evaluated once for both expressions
+	keysCost := cost(withCompositionScope(context.Background()), compiler.Compile([]cel.ExpressionAccessor{
+		&ValidationCondition{Expression: "variables.keys.all(k, k.size() == 2)"},
+	}, options, celconfig.PerCallLimit))
+	if doubleCost := cost(withCompositionScope(context.Background()), double); doubleCost >= singleCost+keysCost {
+		t.Errorf("expected keys to be charged once, got %d for both expressions and %d + %d apart", doubleCost, singleCost, keysCost)
+	}
+}
+
+func TestCompositionCompilerErrors(t *testing.T) {
+	compiler := NewCompositionCompiler([]Variable{
+		{Name: "broken", Expression: "object.data.missing.size()"},
+		{Name: "invalid", Expression: "1 +"},
+	}, false, celconfig.PerCallLimit)
+
+	for _, testCase := range []struct {
+		name       string
+		expression string
+		err        string
+	}{
+		{
+			name:       "evaluation error",
+			expression: "variables.broken == 1",
+			err:        `variable "broken" failed to evaluate`,
+		},
+		{
+			name:       "compilation error",
+			expression: "variables.invalid == 1",
+			err:        `variable "invalid" failed to compile`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filter := compiler.Compile([]cel.ExpressionAccessor{&ValidationCondition{Expression: testCase.expression}}, cel.OptionalVariableDeclarations{}, celconfig.PerCallLimit)
+			if errs := filter.CompilationErrors(); len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			attributes := compositionAttributes()
+			results, _, err := filter.ForInput(context.Background(), attributes, cel.CreateAdmissionRequest(attributes.Attributes), cel.OptionalVariableBindings{}, celconfig.RuntimeCELCostBudget)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[0].Error == nil || !strings.Contains(results[0].Error.Error(), testCase.err) {
+				t.Errorf("expected error containing %q, got %v", testCase.err, results[0].Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+// Package validatingadmissionpolicy is a fork of the ValidatingAdmissionPolicy
+// evaluator from k8s.io/apiserver/pkg/admission/plugin/validatingadmissionpolicy
+// at v0.27.0, including its internal/generic and matching packages.
+//
+// It is forked so that the polyfill can inspect the evaluator's state, such as
+// to explain its decisions. Changes from upstream are kept in separate files
+// where possible to ease rebasing.
+package validatingadmissionpolicy
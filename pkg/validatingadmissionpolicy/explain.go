@@ -0,0 +1,377 @@
+package validatingadmissionpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	celtypes "github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/api/admissionregistration/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/matchconditions"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// Explainer is implemented by validators which can describe how they reached
+// their decision for a request
+type Explainer interface {
+	// Explain validates the request exactly as Validate does, but without
+	// observing metrics or adding warnings and audit annotations to the
+	// request, and returns a description of every policy and binding which
+	// took part in the decision along with the decision itself.
+	Explain(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) (*Explanation, error)
+}
+
+type Explanation struct {
+	Allowed  bool                 `json:"allowed"`
+	Message  string               `json:"message,omitempty"`
+	Policies []*PolicyExplanation `json:"policies"`
+
+	// Validators which can not explain their decisions, such as external
+	// webhooks. They are not run when explaining a request, so that
+	// explaining it has no side effects, and their decisions are not part of
+	// the explanation.
+	Unexplained []string `json:"unexplained,omitempty"`
+}
+
+type PolicyExplanation struct {
+	Name       string `json:"name"`
+	Generation int64  `json:"generation"`
+
+	// Whether the request matched the policy's matchConstraints
+	MatchConstraints MatchExplanation `json:"matchConstraints"`
+
+	// Set if the policy could not be enforced due to its configuration
+	ConfigurationError string `json:"configurationError,omitempty"`
+
+	Bindings []*BindingExplanation `json:"bindings,omitempty"`
+}
+
+type MatchExplanation struct {
+	Matched bool   `json:"matched"`
+	Error   string `json:"error,omitempty"`
+}
+
+type BindingExplanation struct {
+	Name              string                      `json:"name"`
+	ValidationActions []v1alpha1.ValidationAction `json:"validationActions"`
+
+	// Whether the request matched the binding's matchResources
+	MatchResources MatchExplanation `json:"matchResources"`
+
+	// Set if the binding could not be enforced due to its configuration, or
+	// its param could not be found
+	ConfigurationError string `json:"configurationError,omitempty"`
+
+	Param *ParamExplanation `json:"param,omitempty"`
+
+	// Unset if the policy has no matchConditions
+	MatchConditions *MatchConditionsExplanation `json:"matchConditions,omitempty"`
+
+	Validations        []ExpressionExplanation `json:"validations,omitempty"`
+	MessageExpressions []ExpressionExplanation `json:"messageExpressions,omitempty"`
+	AuditAnnotations   []ExpressionExplanation `json:"auditAnnotations,omitempty"`
+
+	Decisions []DecisionExplanation `json:"decisions,omitempty"`
+}
+
+type ParamExplanation struct {
+	Name      string         `json:"name"`
+	Namespace string         `json:"namespace,omitempty"`
+	Object    runtime.Object `json:"object,omitempty"`
+}
+
+type MatchConditionsExplanation struct {
+	Matched         bool                    `json:"matched"`
+	FailedCondition string                  `json:"failedCondition,omitempty"`
+	Error           string                  `json:"error,omitempty"`
+	Expressions     []ExpressionExplanation `json:"expressions"`
+}
+
+type ExpressionExplanation struct {
+	// Index of the expression in the policy
+	Index      int         `json:"index"`
+	Expression string      `json:"expression"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+
+	// Runtime CEL cost of evaluating the expression
+	Cost    int64  `json:"cost"`
+	Elapsed string `json:"elapsed"`
+}
+
+type DecisionExplanation struct {
+	Action     PolicyDecisionAction     `json:"action"`
+	Evaluation PolicyDecisionEvaluation `json:"evaluation,omitempty"`
+	Message    string                   `json:"message,omitempty"`
+}
+
+func (c *celAdmissionController) Explain(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) (*Explanation, error) {
+	explanation := &Explanation{}
+	err := c.validate(ctx, a, o, explanation, true)
+	explanation.Allowed = err == nil
+	if err != nil {
+		explanation.Message = err.Error()
+	}
+	return explanation, nil
+}
+
+type explainRecorderKey struct{}
+
+// explainRecorder collects how the expressions of a binding are evaluated
+// while it is validated, so that they can be explained without evaluating
+// them again
+type explainRecorder struct {
+	expressions map[cel.Filter][]ExpressionExplanation
+	match       *matchconditions.MatchResult
+}
+
+// withExplainRecorder records the evaluations of filters compiled by
+// explainFilterCompiler, and of match conditions, made with the returned
+// context
+func withExplainRecorder(ctx context.Context) (context.Context, *explainRecorder) {
+	recorder := &explainRecorder{expressions: map[cel.Filter][]ExpressionExplanation{}}
+	return context.WithValue(ctx, explainRecorderKey{}, recorder), recorder
+}
+
+func explainRecorderFrom(ctx context.Context) *explainRecorder {
+	recorder, _ := ctx.Value(explainRecorderKey{}).(*explainRecorder)
+	return recorder
+}
+
+// explainFilterCompiler compiles filters which can also evaluate each of their
+// expressions individually, so that the cost and result of each expression
+// can be explained
+type explainFilterCompiler struct {
+	cel.FilterCompiler
+}
+
+func (c explainFilterCompiler) Compile(expressions []cel.ExpressionAccessor, options cel.OptionalVariableDeclarations, perCallLimit uint64) cel.Filter {
+	return &explainFilter{
+		Filter:       c.FilterCompiler.Compile(expressions, options, perCallLimit),
+		compiler:     c.FilterCompiler,
+		expressions:  expressions,
+		options:      options,
+		perCallLimit: perCallLimit,
+	}
+}
+
+type explainFilter struct {
+	cel.Filter
+
+	compiler     cel.FilterCompiler
+	expressions  []cel.ExpressionAccessor
+	options      cel.OptionalVariableDeclarations
+	perCallLimit uint64
+
+	// Single expression filters for each of expressions. Only compiled once
+	// the filter is first explained
+	once    sync.Once
+	singles []cel.Filter
+}
+
+// ForInput evaluates the filter. When the evaluation is being explained,
+// each expression is evaluated on its own, sharing the budget as they would
+// in the filter, and its result and cost are recorded. Expressions which
+// are nil, such as absent messageExpressions, are skipped.
+func (f *explainFilter) ForInput(ctx context.Context, versionedAttr *admission.VersionedAttributes, request *admissionv1.AdmissionRequest, inputs cel.OptionalVariableBindings, runtimeCELCostBudget int64) ([]cel.EvaluationResult, int64, error) {
+	recorder := explainRecorderFrom(ctx)
+	if recorder == nil {
+		return f.Filter.ForInput(ctx, versionedAttr, request, inputs, runtimeCELCostBudget)
+	}
+
+	f.once.Do(func() {
+		f.singles = make([]cel.Filter, len(f.expressions))
+		for i, expression := range f.expressions {
+			if expression != nil {
+				f.singles[i] = f.compiler.Compile([]cel.ExpressionAccessor{expression}, f.options, f.perCallLimit)
+			}
+		}
+	})
+
+	evaluations := make([]cel.EvaluationResult, len(f.expressions))
+	var explanations []ExpressionExplanation
+	remaining := runtimeCELCostBudget
+	for i, expression := range f.expressions {
+		if expression == nil {
+			continue
+		}
+
+		explanation := ExpressionExplanation{
+			Index:      i,
+			Expression: expression.GetExpression(),
+		}
+
+		singleEvaluations, singleRemaining, err := f.singles[i].ForInput(ctx, versionedAttr, request, inputs, remaining)
+		if err != nil {
+			// Like the filter, stop at the first expression which can't be
+			// evaluated
+			explanation.Error = err.Error()
+			recorder.expressions[f] = append(explanations, explanation)
+			return nil, -1, err
+		}
+		explanation.Cost = remaining - singleRemaining
+		remaining = singleRemaining
+
+		if len(singleEvaluations) == 1 {
+			evaluation := singleEvaluations[0]
+			evaluations[i] = evaluation
+			explanation.Elapsed = evaluation.Elapsed.String()
+			if evaluation.Error != nil {
+				explanation.Error = evaluation.Error.Error()
+			} else if evaluation.EvalResult != nil {
+				explanation.Result = explainValue(evaluation.EvalResult)
+			}
+		}
+		explanations = append(explanations, explanation)
+	}
+	recorder.expressions[f] = explanations
+	return evaluations, remaining, nil
+}
+
+// explainMatcher records the result of a validator's match conditions when
+// they are explained
+type explainMatcher struct {
+	matchconditions.Matcher
+
+	filter     cel.Filter
+	authorizer authorizer.Authorizer
+	failPolicy v1.FailurePolicyType
+}
+
+func (m *explainMatcher) Match(ctx context.Context, versionedAttr *admission.VersionedAttributes, versionedParams runtime.Object) matchconditions.MatchResult {
+	recorder := explainRecorderFrom(ctx)
+	if recorder == nil {
+		return m.Matcher.Match(ctx, versionedAttr, versionedParams)
+	}
+	result := m.match(ctx, versionedAttr, versionedParams)
+	recorder.match = &result
+	return result
+}
+
+// match matches the request as matchconditions.Matcher does, but without
+// observing metrics, since explaining a request must not affect them
+func (m *explainMatcher) match(ctx context.Context, versionedAttr *admission.VersionedAttributes, versionedParams runtime.Object) matchconditions.MatchResult {
+	evalResults, _, err := m.filter.ForInput(ctx, versionedAttr, cel.CreateAdmissionRequest(versionedAttr.Attributes), cel.OptionalVariableBindings{
+		VersionedParams: versionedParams,
+		Authorizer:      m.authorizer,
+	}, celconfig.RuntimeCELCostBudgetMatchConditions)
+	if err != nil {
+		if m.failPolicy == v1.Ignore {
+			return matchconditions.MatchResult{}
+		}
+		return matchconditions.MatchResult{Error: err}
+	}
+
+	var errs []error
+	for _, evalResult := range evalResults {
+		matchCondition, ok := evalResult.ExpressionAccessor.(*matchconditions.MatchCondition)
+		if !ok {
+			errs = append(errs, errors.New("internal error converting ExpressionAccessor to MatchCondition"))
+			continue
+		}
+		if evalResult.Error != nil {
+			errs = append(errs, evalResult.Error)
+		}
+		if evalResult.EvalResult == celtypes.False {
+			return matchconditions.MatchResult{FailedConditionName: matchCondition.Name}
+		}
+	}
+	if len(errs) > 0 {
+		if m.failPolicy == v1.Ignore {
+			return matchconditions.MatchResult{}
+		}
+		return matchconditions.MatchResult{Error: utilerrors.NewAggregate(errs)}
+	}
+	return matchconditions.MatchResult{Matches: true}
+}
+
+// explainValue converts a CEL value to one which can be serialized to JSON
+func explainValue(val ref.Val) interface{} {
+	switch val.Type() {
+	case celtypes.BoolType, celtypes.StringType, celtypes.IntType, celtypes.UintType, celtypes.DoubleType:
+		return val.Value()
+	case celtypes.NullType:
+		return nil
+	default:
+		return fmt.Sprintf("%v", val.Value())
+	}
+}
+
+// explain describes the binding's match conditions and expressions from how
+// they were evaluated while validating the request with recorder
+func (v *validator) explain(explanation *BindingExplanation, recorder *explainRecorder) {
+	if v.celMatcher != nil && recorder.match != nil {
+		explanation.MatchConditions = &MatchConditionsExplanation{
+			Matched:         recorder.match.Matches,
+			FailedCondition: recorder.match.FailedConditionName,
+			Expressions:     recorder.expressions[v.matchConditionsFilter],
+		}
+		if recorder.match.Error != nil {
+			explanation.MatchConditions.Error = recorder.match.Error.Error()
+		}
+	}
+
+	// Validations are not evaluated if the match conditions are not met, and
+	// so are not explained either
+	explanation.Validations = recorder.expressions[v.validationFilter]
+	explanation.MessageExpressions = recorder.expressions[v.messageFilter]
+	explanation.AuditAnnotations = recorder.expressions[v.auditAnnotationFilter]
+}
+
+// explainMatchConditions is used to record the filter a validator's
+// matchconditions.Matcher was built from, so that its expressions can be
+// explained
+func explainMatchConditions(v Validator, filter cel.Filter, authorizer authorizer.Authorizer, failPolicy *v1.FailurePolicyType) {
+	if v, ok := v.(*validator); ok && v.celMatcher != nil {
+		v.matchConditionsFilter = filter
+		policy := v1.Fail
+		if failPolicy != nil {
+			policy = *failPolicy
+		}
+		v.celMatcher = &explainMatcher{
+			Matcher:    v.celMatcher,
+			filter:     filter,
+			authorizer: authorizer,
+			failPolicy: policy,
+		}
+	}
+}
+
+func explainParam(param runtime.Object) *ParamExplanation {
+	explanation := &ParamExplanation{Object: param}
+	if accessor, err := meta.Accessor(param); err == nil {
+		explanation.Name = accessor.GetName()
+		explanation.Namespace = accessor.GetNamespace()
+	}
+	return explanation
+}
+
+func explainMatch(matches bool, err error) MatchExplanation {
+	if err != nil {
+		return MatchExplanation{Error: err.Error()}
+	}
+	return MatchExplanation{Matched: matches}
+}
+
+func explainDecisions(decisions []PolicyDecision) []DecisionExplanation {
+	var result []DecisionExplanation
+	for _, d := range decisions {
+		result = append(result, DecisionExplanation{
+			Action:     d.Action,
+			Evaluation: d.Evaluation,
+			Message:    d.Message,
+		})
+	}
+	return result
+}
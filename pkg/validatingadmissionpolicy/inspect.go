@@ -0,0 +1,200 @@
+package validatingadmissionpolicy
+
+import (
+	"errors"
+	"sort"
+
+	"k8s.io/api/admissionregistration/v1alpha1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	"k8s.io/apiserver/pkg/cel/openapi/resolver"
+)
+
+// Inspector is implemented by validators which can report the policies they
+// are currently enforcing
+type Inspector interface {
+	Inspect() *Snapshot
+}
+
+// Snapshot describes the policies, bindings and params an evaluator is
+// currently enforcing. Every list is sorted so that snapshots taken from
+// different replicas can be compared directly.
+type Snapshot struct {
+	// Whether the policies and bindings have been listed and reconciled
+	Synced bool `json:"synced"`
+
+	Policies   []PolicySnapshot    `json:"policies"`
+	ParamKinds []ParamKindSnapshot `json:"paramKinds"`
+
+	// Bindings which refer to a policy that does not exist
+	UnboundBindings []string `json:"unboundBindings,omitempty"`
+}
+
+type PolicySnapshot struct {
+	Name            string              `json:"name"`
+	Generation      int64               `json:"generation"`
+	ResourceVersion string              `json:"resourceVersion"`
+	ParamKind       *v1alpha1.ParamKind `json:"paramKind,omitempty"`
+
+	// Set if the policy can not be enforced due to its configuration
+	ConfigurationError string `json:"configurationError,omitempty"`
+
+	// Errors compiling the policy's expressions. Expressions are compiled
+	// when the policy is first used with a binding, so a policy without
+	// bindings reports no errors
+	CompileErrors []string `json:"compileErrors,omitempty"`
+
+	Bindings []BindingSnapshot `json:"bindings"`
+
+	// The kinds the policy's matchConstraints resolve to, whose schemas are
+	// used to type check its expressions
+	Schemas []SchemaSnapshot `json:"schemas,omitempty"`
+}
+
+type BindingSnapshot struct {
+	Name              string                      `json:"name"`
+	Generation        int64                       `json:"generation"`
+	ResourceVersion   string                      `json:"resourceVersion"`
+	ParamRef          *v1alpha1.ParamRef          `json:"paramRef,omitempty"`
+	ValidationActions []v1alpha1.ValidationAction `json:"validationActions"`
+}
+
+type SchemaSnapshot struct {
+	GroupVersionKind string `json:"groupVersionKind"`
+	Resolved         bool   `json:"resolved"`
+	Error            string `json:"error,omitempty"`
+}
+
+type ParamKindSnapshot struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// Whether the informer for the kind has synced
+	Synced bool `json:"synced"`
+
+	// Number of objects of the kind in the informer's cache
+	Objects int `json:"objects"`
+
+	// Policies using the kind as their paramKind
+	Policies []string `json:"policies"`
+}
+
+// Inspect reports the policies the controller is currently enforcing. Policies
+// are taken from the same snapshot Validate uses.
+func (c *celAdmissionController) Inspect() *Snapshot {
+	result := &Snapshot{
+		Synced:     c.HasSynced(),
+		Policies:   []PolicySnapshot{},
+		ParamKinds: []ParamKindSnapshot{},
+	}
+
+	policyDatas, _ := c.definitions.Load().([]policyData)
+	for _, definitionInfo := range policyDatas {
+		definition := definitionInfo.lastReconciledValue
+		policy := PolicySnapshot{
+			Name:            definition.Name,
+			Generation:      definition.Generation,
+			ResourceVersion: definition.ResourceVersion,
+			ParamKind:       definition.Spec.ParamKind,
+			Bindings:        []BindingSnapshot{},
+		}
+		if definitionInfo.configurationError != nil {
+			policy.ConfigurationError = definitionInfo.configurationError.Error()
+		}
+
+		compileErrors := map[string]bool{}
+		for _, bindingInfo := range definitionInfo.bindings {
+			binding := bindingInfo.lastReconciledValue
+			policy.Bindings = append(policy.Bindings, BindingSnapshot{
+				Name:              binding.Name,
+				Generation:        binding.Generation,
+				ResourceVersion:   binding.ResourceVersion,
+				ParamRef:          binding.Spec.ParamRef,
+				ValidationActions: binding.Spec.ValidationActions,
+			})
+
+			// Every binding compiles the same expressions of the policy
+			for _, err := range validatorCompilationErrors(bindingInfo.validator) {
+				compileErrors[err.Error()] = true
+			}
+		}
+		for err := range compileErrors {
+			policy.CompileErrors = append(policy.CompileErrors, err)
+		}
+		sort.Strings(policy.CompileErrors)
+		sort.Slice(policy.Bindings, func(i, j int) bool {
+			return policy.Bindings[i].Name < policy.Bindings[j].Name
+		})
+
+		if typeChecker := c.policyController.typeChecker; typeChecker != nil {
+			for _, gvk := range typeChecker.typesToCheck(definition) {
+				schema := SchemaSnapshot{GroupVersionKind: gvk.String(), Resolved: true}
+				if _, err := typeChecker.schemaResolver.ResolveSchema(gvk); err != nil {
+					schema.Resolved = false
+					if !errors.Is(err, resolver.ErrSchemaNotFound) {
+						schema.Error = err.Error()
+					}
+				}
+				policy.Schemas = append(policy.Schemas, schema)
+			}
+		}
+
+		result.Policies = append(result.Policies, policy)
+	}
+	sort.Slice(result.Policies, func(i, j int) bool {
+		return result.Policies[i].Name < result.Policies[j].Name
+	})
+
+	c.policyController.mutex.RLock()
+	defer c.policyController.mutex.RUnlock()
+
+	for paramKind, info := range c.policyController.paramsCRDControllers {
+		paramKindSnapshot := ParamKindSnapshot{
+			APIVersion: paramKind.APIVersion,
+			Kind:       paramKind.Kind,
+			Synced:     info.controller.HasSynced(),
+		}
+		if objects, err := info.controller.Informer().List(labels.Everything()); err == nil {
+			paramKindSnapshot.Objects = len(objects)
+		}
+		for nn := range info.dependentDefinitions {
+			paramKindSnapshot.Policies = append(paramKindSnapshot.Policies, nn.name)
+		}
+		sort.Strings(paramKindSnapshot.Policies)
+		result.ParamKinds = append(result.ParamKinds, paramKindSnapshot)
+	}
+	sort.Slice(result.ParamKinds, func(i, j int) bool {
+		a, b := result.ParamKinds[i], result.ParamKinds[j]
+		if a.APIVersion != b.APIVersion {
+			return a.APIVersion < b.APIVersion
+		}
+		return a.Kind < b.Kind
+	})
+
+	for definitionNN, bindings := range c.policyController.definitionsToBindings {
+		if _, ok := c.policyController.definitionInfo[definitionNN]; ok {
+			continue
+		}
+		for bindingNN := range bindings {
+			result.UnboundBindings = append(result.UnboundBindings, bindingNN.name)
+		}
+	}
+	sort.Strings(result.UnboundBindings)
+
+	return result
+}
+
+func validatorCompilationErrors(v Validator) []error {
+	typed, ok := v.(*validator)
+	if !ok {
+		return nil
+	}
+
+	var result []error
+	for _, filter := range []cel.Filter{typed.validationFilter, typed.messageFilter, typed.auditAnnotationFilter, typed.matchConditionsFilter} {
+		if filter != nil {
+			result = append(result, filter.CompilationErrors()...)
+		}
+	}
+	return result
+}
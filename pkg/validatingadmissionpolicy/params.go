@@ -0,0 +1,117 @@
+package validatingadmissionpolicy
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/api/admissionregistration/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	crdv1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1"
+	"k8s.io/cel-admission-webhook/pkg/conversion"
+	"k8s.io/cel-admission-webhook/pkg/validatingadmissionpolicy/internal/generic"
+)
+
+// paramRef is a binding's spec.paramRef, along with the fields the native
+// v1alpha1 type keeps in an annotation
+type paramRef struct {
+	name      string
+	namespace string
+
+	// Selects every matching param when set, instead of the one named
+	selector labels.Selector
+
+	// What to do when no param is found. Unset behaves as Deny, reporting
+	// a missing named param as not found.
+	parameterNotFoundAction *crdv1.ParameterNotFoundActionType
+}
+
+func bindingParamRef(binding *v1alpha1.ValidatingAdmissionPolicyBinding) (*paramRef, error) {
+	if binding.Spec.ParamRef == nil {
+		return nil, nil
+	}
+	ref := &paramRef{
+		name:      binding.Spec.ParamRef.Name,
+		namespace: binding.Spec.ParamRef.Namespace,
+	}
+
+	dropped, err := conversion.ParamRef(binding)
+	if err != nil {
+		return nil, err
+	} else if dropped == nil {
+		return ref, nil
+	}
+
+	if dropped.Selector != nil {
+		ref.selector, err = metav1.LabelSelectorAsSelector(dropped.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid paramRef.selector: %w", err)
+		}
+	}
+	ref.parameterNotFoundAction = dropped.ParameterNotFoundAction
+	return ref, nil
+}
+
+// collectParams returns the params a binding is evaluated against for a
+// request in namespace. A namespaced paramRef without a namespace refers to
+// params in the request's namespace.
+func collectParams(paramController generic.Controller[runtime.Object], paramScope meta.RESTScope, ref *paramRef, namespace string) ([]runtime.Object, error) {
+	var lister generic.NamespacedLister[runtime.Object] = paramController.Informer()
+	if paramScope != nil && paramScope.Name() == meta.RESTScopeNameNamespace {
+		paramNamespace := ref.namespace
+		if len(paramNamespace) == 0 {
+			paramNamespace = namespace
+		}
+		if len(paramNamespace) == 0 {
+			return nil, fmt.Errorf("cannot use namespaced paramRef in policy binding that matches cluster-scoped resources")
+		}
+		lister = paramController.Informer().Namespaced(paramNamespace)
+	} else if paramScope == nil && len(ref.namespace) > 0 {
+		// Scope is unknown, use the namespace as given
+		lister = paramController.Informer().Namespaced(ref.namespace)
+	}
+
+	var params []runtime.Object
+	if ref.selector != nil {
+		list, err := lister.List(ref.selector)
+		if err != nil {
+			return nil, err
+		}
+		params = sortParams(list)
+	} else {
+		param, err := lister.Get(ref.name)
+		switch {
+		case err == nil:
+			params = append(params, param)
+		case !k8serrors.IsNotFound(err) || ref.parameterNotFoundAction == nil:
+			// Bindings without parameterNotFoundAction report the
+			// missing param itself
+			return nil, err
+		}
+	}
+
+	if len(params) == 0 && (ref.parameterNotFoundAction == nil || *ref.parameterNotFoundAction == crdv1.DenyAction) {
+		return nil, fmt.Errorf("no params found for policy binding with `Deny` parameterNotFoundAction")
+	}
+	return params, nil
+}
+
+// sortParams orders params by namespace and name, so that selected params
+// are always evaluated in the same order
+func sortParams(params []runtime.Object) []runtime.Object {
+	key := func(obj runtime.Object) string {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return ""
+		}
+		return accessor.GetNamespace() + "/" + accessor.GetName()
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		return key(params[i]) < key(params[j])
+	})
+	return params
+}
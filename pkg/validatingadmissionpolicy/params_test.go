@@ -0,0 +1,176 @@
+package validatingadmissionpolicy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	crdv1 "k8s.io/cel-admission-webhook/pkg/apis/admissionregistration.x-k8s.io/v1"
+	"k8s.io/cel-admission-webhook/pkg/validatingadmissionpolicy/internal/generic"
+)
+
+// paramController returns a controller whose informer holds params, without
+// running it
+func paramController(t *testing.T, params ...runtime.Object) generic.Controller[runtime.Object] {
+	t.Helper()
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.ConfigMap{}, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, param := range params {
+		if err := informer.GetIndexer().Add(param); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return generic.NewController(generic.NewInformer[runtime.Object](informer), nil, generic.ControllerOptions{})
+}
+
+func param(namespace, name string, labels map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels}}
+}
+
+func TestCollectParams(t *testing.T) {
+	allow := crdv1.AllowAction
+	deny := crdv1.DenyAction
+	app := labels.SelectorFromSet(labels.Set{"app": "a"})
+
+	namespaced := paramController(t,
+		param("a", "params", map[string]string{"app": "a"}),
+		param("b", "params", map[string]string{"app": "a"}),
+		param("b", "other", map[string]string{"app": "a"}),
+		param("b", "unlabelled", nil),
+	)
+	clusterScoped := paramController(t,
+		param("", "params", map[string]string{"app": "a"}),
+	)
+
+	for _, testCase := range []struct {
+		name       string
+		controller generic.Controller[runtime.Object]
+		scope      meta.RESTScope
+		ref        *paramRef
+		namespace  string
+		expected   []string
+		err        string
+	}{
+		{
+			name:       "name in given namespace",
+			controller: namespaced,
+			scope:      meta.RESTScopeNamespace,
+			ref:        &paramRef{name: "params", namespace: "a"},
+			namespace:  "b",
+			expected:   []string{"a/params"},
+		},
+		{
+			name:       "name relative to request namespace",
+			controller: namespaced,
+			scope:      meta.RESTScopeNamespace,
+			ref:        &paramRef{name: "params"},
+			namespace:  "b",
+			expected:   []string{"b/params"},
+		},
+		{
+			name:       "namespaced paramRef for cluster-scoped request",
+			controller: namespaced,
+			scope:      meta.RESTScopeNamespace,
+			ref:        &paramRef{name: "params"},
+			err:        "cannot use namespaced paramRef",
+		},
+		{
+			name:       "cluster-scoped param",
+			controller: clusterScoped,
+			scope:      meta.RESTScopeRoot,
+			ref:        &paramRef{name: "params"},
+			namespace:  "b",
+			expected:   []string{"/params"},
+		},
+		{
+			name:       "unknown scope uses given namespace",
+			controller: namespaced,
+			ref:        &paramRef{name: "params", namespace: "a"},
+			expected:   []string{"a/params"},
+		},
+		{
+			name:       "selector matches multiple params",
+			controller: namespaced,
+			scope:      meta.RESTScopeNamespace,
+			ref:        &paramRef{selector: app},
+			namespace:  "b",
+			expected:   []string{"b/other", "b/params"},
+		},
+		{
+			name:       "selector in given namespace",
+			controller: namespaced,
+			scope:      meta.RESTScopeNamespace,
+			ref:        &paramRef{selector: app, namespace: "a"},
+			namespace:  "b",
+			expected:   []string{"a/params"},
+		},
+		{
+			name:       "selector matches nothing with Allow",
+			controller: namespaced,
+			scope:      meta.RESTScopeNamespace,
+			ref:        &paramRef{selector: labels.SelectorFromSet(labels.Set{"app": "b"}), parameterNotFoundAction: &allow},
+			namespace:  "b",
+		},
+		{
+			name:       "selector matches nothing with Deny",
+			controller: namespaced,
+			scope:      meta.RESTScopeNamespace,
+			ref:        &paramRef{selector: labels.SelectorFromSet(labels.Set{"app": "b"}), parameterNotFoundAction: &deny},
+			namespace:  "b",
+			err:        "no params found",
+		},
+		{
+			name:       "missing name without parameterNotFoundAction",
+			controller: namespaced,
+			scope:      meta.RESTScopeNamespace,
+			ref:        &paramRef{name: "missing"},
+			namespace:  "b",
+			err:        "missing not found",
+		},
+		{
+			name:       "missing name with Allow",
+			controller: namespaced,
+			scope:      meta.RESTScopeNamespace,
+			ref:        &paramRef{name: "missing", parameterNotFoundAction: &allow},
+			namespace:  "b",
+		},
+		{
+			name:       "missing name with Deny",
+			controller: namespaced,
+			scope:      meta.RESTScopeNamespace,
+			ref:        &paramRef{name: "missing", parameterNotFoundAction: &deny},
+			namespace:  "b",
+			err:        "no params found",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			params, err := collectParams(testCase.controller, testCase.scope, testCase.ref, testCase.namespace)
+			if len(testCase.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), testCase.err) {
+					t.Fatalf("expected error containing %q, got %v", testCase.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, param := range params {
+				accessor, err := meta.Accessor(param)
+				if err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, accessor.GetNamespace()+"/"+accessor.GetName())
+			}
+			if !reflect.DeepEqual(names, testCase.expected) {
+				t.Errorf("expected params %v, got %v", testCase.expected, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/warning"
+	"k8s.io/klog/v2"
+
+	"k8s.io/cel-admission-webhook/pkg/validatingadmissionpolicy"
+)
+
+// Enforcement decides what happens to requests the validators deny,
+// regardless of the validationActions of the bindings denying them
+type Enforcement string
+
+const (
+	// Deny the request
+	EnforcementDeny Enforcement = "deny"
+
+	// Allow the request, returning the denial as a warning and audit
+	// annotation
+	EnforcementWarn Enforcement = "warn"
+
+	// Allow the request, only recording the denial in an audit annotation
+	EnforcementAudit Enforcement = "audit"
+)
+
+func ParseEnforcement(enforcement string) (Enforcement, error) {
+	switch Enforcement(enforcement) {
+	case EnforcementDeny, EnforcementWarn, EnforcementAudit:
+		return Enforcement(enforcement), nil
+	default:
+		return "", fmt.Errorf("unknown enforcement %q, must be one of %s, %s or %s", enforcement, EnforcementDeny, EnforcementWarn, EnforcementAudit)
+	}
+}
+
+// Prefix of the audit annotations added to requests whose denial was
+// downgraded, one per denial with its index appended, each holding the
+// enforcement and the message the request would have been denied with. The
+// keys have no prefix of their own, since the apiserver prefixes them with
+// the name of the webhook.
+const DowngradedAnnotation = "enforcement-downgraded"
+
+// How long to wait for the enforcement file to stop changing before
+// reloading it
+const enforcementDebounceInterval = 500 * time.Millisecond
+
+// Override downgrades the denials of a validator according to a cluster
+// wide enforcement, so that the polyfill can be introduced to a cluster
+// without blocking any writes.
+//
+// The enforcement may be changed at runtime with Set, or by writing it to
+// the enforcement file, which is watched while Override is running.
+type Override struct {
+	validator   admission.ValidationInterface
+	path        string
+	enforcement atomic.Value
+	logger      klog.Logger
+}
+
+// NewOverride wraps validator with the given enforcement. If path is not
+// empty, the enforcement is read from the file at path whenever it changes.
+func NewOverride(validator admission.ValidationInterface, enforcement Enforcement, path string) *Override {
+	o := &Override{
+		validator: validator,
+		path:      path,
+		logger:    klog.LoggerWithName(klog.Background(), "enforcement"),
+	}
+	o.enforcement.Store(enforcement)
+	return o
+}
+
+func (o *Override) Enforcement() Enforcement {
+	return o.enforcement.Load().(Enforcement)
+}
+
+func (o *Override) Set(enforcement Enforcement) {
+	if old := o.enforcement.Swap(enforcement); old != enforcement {
+		o.logger.Info("enforcement changed", "from", old, "to", enforcement)
+	}
+}
+
+// Reload reads the enforcement file. If it is invalid an error is returned
+// and the current enforcement is left in use.
+func (o *Override) Reload() error {
+	data, err := os.ReadFile(o.path)
+	if err != nil {
+		return err
+	}
+	enforcement, err := ParseEnforcement(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("%s: %w", o.path, err)
+	}
+	o.Set(enforcement)
+	return nil
+}
+
+// Run watches the enforcement file, if any, until ctx is cancelled
+func (o *Override) Run(ctx context.Context) error {
+	if len(o.path) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Watch the directory rather than the file, which is replaced rather
+	// than written to by editors and ConfigMap volume updates
+	if err := watcher.Add(filepath.Dir(o.path)); err != nil {
+		return err
+	}
+
+	reload := func() {
+		if err := o.Reload(); err != nil {
+			o.logger.Error(err, "rejected enforcement file, keeping current enforcement", "enforcement", o.Enforcement())
+		}
+	}
+	reload()
+
+	debounce := time.NewTimer(enforcementDebounceInterval)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("enforcement file watcher closed")
+			}
+			debounce.Reset(enforcementDebounceInterval)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("enforcement file watcher closed")
+			}
+			o.logger.Error(err, "enforcement file watch error", "path", o.path)
+		case <-debounce.C:
+			reload()
+		}
+	}
+}
+
+func (o *Override) Handles(operation admission.Operation) bool {
+	return o.validator.Handles(operation)
+}
+
+func (o *Override) Validate(ctx context.Context, a admission.Attributes, objects admission.ObjectInterfaces) error {
+	enforcement := o.Enforcement()
+	if enforcement == EnforcementDeny {
+		return o.validator.Validate(ctx, a, objects)
+	}
+
+	// Run every validator, so that none of the denials being downgraded
+	// go unrecorded
+	err := o.validator.Validate(withAggregation(ctx, AggregationCollectAll), a, objects)
+	if err == nil {
+		return nil
+	}
+
+	o.logger.Info("denial downgraded",
+		"enforcement", enforcement,
+		"operation", a.GetOperation(),
+		"resource", a.GetResource(),
+		"subresource", a.GetSubresource(),
+		"namespace", a.GetNamespace(),
+		"name", a.GetName(),
+		"denial", err.Error(),
+	)
+	for i, denial := range denials(err) {
+		message := downgraded(enforcement, denial)
+		if enforcement == EnforcementWarn {
+			warning.AddWarning(ctx, "", message)
+		}
+		if err := a.AddAnnotation(fmt.Sprintf("%s-%d", DowngradedAnnotation, i), message); err != nil {
+			o.logger.Error(err, "failed to add audit annotation")
+		}
+	}
+	return nil
+}
+
+// denials returns the message of each denial making up err, which lists
+// them as its causes when several validators, policies or bindings denied
+// the request
+func denials(err error) []string {
+	var statusErr *k8serrors.StatusError
+	if !errors.As(err, &statusErr) || statusErr.ErrStatus.Details == nil {
+		return []string{err.Error()}
+	}
+
+	var messages []string
+	for _, cause := range statusErr.ErrStatus.Details.Causes {
+		if len(cause.Message) > 0 {
+			messages = append(messages, cause.Message)
+		}
+	}
+	if len(messages) == 0 {
+		return []string{err.Error()}
+	}
+	return messages
+}
+
+func downgraded(enforcement Enforcement, message string) string {
+	return fmt.Sprintf("denial downgraded by enforcement=%s: %s", enforcement, message)
+}
+
+// Explain explains the wrapped validator's decision, reporting denials the
+// enforcement downgrades as allowed
+func (o *Override) Explain(ctx context.Context, a admission.Attributes, objects admission.ObjectInterfaces) (*validatingadmissionpolicy.Explanation, error) {
+	explainer, ok := o.validator.(validatingadmissionpolicy.Explainer)
+	if !ok {
+		return nil, fmt.Errorf("validator can not explain its decisions")
+	}
+
+	enforcement := o.Enforcement()
+	if enforcement != EnforcementDeny {
+		ctx = withAggregation(ctx, AggregationCollectAll)
+	}
+	explanation, err := explainer.Explain(ctx, a, objects)
+	if err != nil || explanation.Allowed {
+		return explanation, err
+	}
+	if enforcement != EnforcementDeny {
+		explanation.Allowed = true
+		explanation.Message = downgraded(enforcement, explanation.Message)
+	}
+	return explanation, nil
+}
+
+func (o *Override) Inspect() *validatingadmissionpolicy.Snapshot {
+	if inspector, ok := o.validator.(validatingadmissionpolicy.Inspector); ok {
+		return inspector.Inspect()
+	}
+	return &validatingadmissionpolicy.Snapshot{}
+}
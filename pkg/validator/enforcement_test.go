@@ -0,0 +1,193 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/warning"
+)
+
+func TestOverride(t *testing.T) {
+	for _, testCase := range []struct {
+		enforcement Enforcement
+		err         error
+		expectErr   bool
+		warnings    warnings
+		annotations map[string]string
+	}{
+		{
+			enforcement: EnforcementDeny,
+			err:         errors.New("denied"),
+			expectErr:   true,
+			warnings:    warnings{"deny"},
+			annotations: map[string]string{},
+		},
+		{
+			enforcement: EnforcementWarn,
+			err:         errors.New("denied"),
+			warnings:    warnings{"warn", "denial downgraded by enforcement=warn: denied"},
+			annotations: map[string]string{DowngradedAnnotation + "-0": "denial downgraded by enforcement=warn: denied"},
+		},
+		{
+			enforcement: EnforcementAudit,
+			err:         errors.New("denied"),
+			warnings:    warnings{"audit"},
+			annotations: map[string]string{DowngradedAnnotation + "-0": "denial downgraded by enforcement=audit: denied"},
+		},
+		{
+			enforcement: EnforcementAudit,
+			warnings:    warnings{"audit"},
+			annotations: map[string]string{},
+		},
+	} {
+		t.Run(string(testCase.enforcement), func(t *testing.T) {
+			recorded := warnings{}
+			ctx := warning.WithWarningRecorder(context.Background(), &recorded)
+			attributes := &annotatedAttributes{
+				Attributes:  admission.NewAttributesRecord(nil, nil, schema.GroupVersionKind{}, "", "a", schema.GroupVersionResource{}, "", admission.Create, nil, false, nil),
+				annotations: map[string]string{},
+			}
+
+			override := NewOverride(fakeValidator{name: string(testCase.enforcement), err: testCase.err}, testCase.enforcement, "")
+			err := override.Validate(ctx, attributes, nil)
+			if (err != nil) != testCase.expectErr {
+				t.Errorf("expected error %v, got %v", testCase.expectErr, err)
+			}
+			if !reflect.DeepEqual(recorded, testCase.warnings) {
+				t.Errorf("expected warnings %v, got %v", testCase.warnings, recorded)
+			}
+			if !reflect.DeepEqual(attributes.annotations, testCase.annotations) {
+				t.Errorf("expected audit annotations %v, got %v", testCase.annotations, attributes.annotations)
+			}
+		})
+	}
+}
+
+func TestOverrideEveryDenial(t *testing.T) {
+	// Two bindings denying the request, as reported by the policy controller
+	policies := k8serrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "a", errors.New("ValidatingAdmissionPolicy 'a' with binding 'a1' denied request: a1"))
+	policies.ErrStatus.Details.Causes = []metav1.StatusCause{
+		{Message: "ValidatingAdmissionPolicy 'a' with binding 'a1' denied request: a1"},
+		{Message: "ValidatingAdmissionPolicy 'a' with binding 'a2' denied request: a2"},
+	}
+	validator := NewMulti(AggregationFirstError,
+		fakeValidator{name: "policies", err: policies},
+		fakeValidator{name: "webhook", err: errors.New("webhook denied")},
+	)
+
+	newAttributes := func() *annotatedAttributes {
+		return &annotatedAttributes{
+			Attributes:  admission.NewAttributesRecord(nil, nil, schema.GroupVersionKind{}, "", "a", schema.GroupVersionResource{}, "", admission.Create, nil, false, nil),
+			annotations: map[string]string{},
+		}
+	}
+
+	// Every validator is run while denials are downgraded, and each denial
+	// is reported separately
+	recorded := warnings{}
+	ctx := warning.WithWarningRecorder(context.Background(), &recorded)
+	attributes := newAttributes()
+	if err := NewOverride(validator, EnforcementWarn, "").Validate(ctx, attributes, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectedWarnings := warnings{
+		"policies",
+		"webhook",
+		"denial downgraded by enforcement=warn: ValidatingAdmissionPolicy 'a' with binding 'a1' denied request: a1",
+		"denial downgraded by enforcement=warn: ValidatingAdmissionPolicy 'a' with binding 'a2' denied request: a2",
+		"denial downgraded by enforcement=warn: webhook denied",
+	}
+	if !reflect.DeepEqual(recorded, expectedWarnings) {
+		t.Errorf("expected warnings %v, got %v", expectedWarnings, recorded)
+	}
+	expectedAnnotations := map[string]string{
+		DowngradedAnnotation + "-0": "denial downgraded by enforcement=warn: ValidatingAdmissionPolicy 'a' with binding 'a1' denied request: a1",
+		DowngradedAnnotation + "-1": "denial downgraded by enforcement=warn: ValidatingAdmissionPolicy 'a' with binding 'a2' denied request: a2",
+		DowngradedAnnotation + "-2": "denial downgraded by enforcement=warn: webhook denied",
+	}
+	if !reflect.DeepEqual(attributes.annotations, expectedAnnotations) {
+		t.Errorf("expected audit annotations %v, got %v", expectedAnnotations, attributes.annotations)
+	}
+
+	// The keys are accepted by the apiserver once it prefixes them with the
+	// name of the webhook
+	record := admission.NewAttributesRecord(nil, nil, schema.GroupVersionKind{}, "", "a", schema.GroupVersionResource{}, "", admission.Create, nil, false, nil)
+	for key, value := range expectedAnnotations {
+		if err := record.AddAnnotation("cel-admission-polyfill.example.com/"+key, value); err != nil {
+			t.Errorf("apiserver would drop audit annotation %q: %v", key, err)
+		}
+	}
+
+	// The configured aggregation applies again once denials are enforced
+	recorded = warnings{}
+	ctx = warning.WithWarningRecorder(context.Background(), &recorded)
+	if err := NewOverride(validator, EnforcementDeny, "").Validate(ctx, newAttributes(), nil); err != policies {
+		t.Errorf("expected the first denial, got %v", err)
+	}
+	if !reflect.DeepEqual(recorded, warnings{"policies"}) {
+		t.Errorf("expected only the first validator to run, got %v", recorded)
+	}
+}
+
+func TestOverrideReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "enforcement")
+	write := func(content string) {
+		if err := os.WriteFile(path+".tmp", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("warn\n")
+
+	override := NewOverride(fakeValidator{}, EnforcementDeny, path)
+	if err := override.Reload(); err != nil {
+		t.Fatal(err)
+	} else if enforcement := override.Enforcement(); enforcement != EnforcementWarn {
+		t.Fatalf("expected enforcement warn, got %s", enforcement)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- override.Run(ctx)
+	}()
+
+	expect := func(expected Enforcement) {
+		t.Helper()
+		err := wait.PollUntilContextTimeout(ctx, 50*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+			return override.Enforcement() == expected, nil
+		})
+		if err != nil {
+			t.Fatalf("expected enforcement %s, got %s", expected, override.Enforcement())
+		}
+	}
+
+	write("audit")
+	expect(EnforcementAudit)
+
+	// Invalid enforcements are ignored
+	write("off")
+	time.Sleep(2 * enforcementDebounceInterval)
+	expect(EnforcementAudit)
+
+	write("deny")
+	expect(EnforcementDeny)
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Run to stop with the context, got %v", err)
+	}
+}
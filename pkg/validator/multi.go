@@ -2,16 +2,49 @@ package validator
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apiserver/pkg/admission"
+
+	"k8s.io/cel-admission-webhook/pkg/validatingadmissionpolicy"
+)
+
+// Aggregation decides how the errors of several validators are combined
+type Aggregation string
+
+const (
+	// Stop at the first validator which denies the request
+	AggregationFirstError Aggregation = "first-error"
+
+	// Run every validator, and deny the request with all of their errors
+	AggregationCollectAll Aggregation = "collect-all"
+
+	// Run every validator, so that all of their warnings and audit
+	// annotations are recorded, and deny the request with the first error
+	AggregationRunAllThenDeny Aggregation = "run-all-then-deny"
 )
 
-func NewMulti(validators ...admission.ValidationInterface) admission.ValidationInterface {
-	return multi{validators: validators}
+func ParseAggregation(aggregation string) (Aggregation, error) {
+	switch Aggregation(aggregation) {
+	case AggregationFirstError, AggregationCollectAll, AggregationRunAllThenDeny:
+		return Aggregation(aggregation), nil
+	default:
+		return "", fmt.Errorf("unknown aggregation %q, must be one of %s, %s or %s", aggregation, AggregationFirstError, AggregationCollectAll, AggregationRunAllThenDeny)
+	}
+}
+
+func NewMulti(aggregation Aggregation, validators ...admission.ValidationInterface) admission.ValidationInterface {
+	return multi{aggregation: aggregation, validators: validators}
 }
 
 type multi struct {
-	validators []admission.ValidationInterface
+	aggregation Aggregation
+	validators  []admission.ValidationInterface
 }
 
 func (m multi) Handles(operation admission.Operation) bool {
@@ -23,18 +56,166 @@ func (m multi) Handles(operation admission.Operation) bool {
 	return false
 }
 
+type aggregationKey struct{}
+
+// withAggregation overrides the aggregation of the validators run with ctx
+func withAggregation(ctx context.Context, aggregation Aggregation) context.Context {
+	return context.WithValue(ctx, aggregationKey{}, aggregation)
+}
+
+func (m multi) aggregationFor(ctx context.Context) Aggregation {
+	if aggregation, ok := ctx.Value(aggregationKey{}).(Aggregation); ok {
+		return aggregation
+	}
+	return m.aggregation
+}
+
 func (m multi) Validate(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	aggregation := m.aggregationFor(ctx)
+	var errs []error
 	for _, v := range m.validators {
 		if !v.Handles(a.GetOperation()) {
 			continue
 		}
 
 		err := v.Validate(ctx, a, o)
+		if err == nil {
+			continue
+		}
 
-		if err != nil {
+		switch aggregation {
+		case AggregationCollectAll:
+			errs = append(errs, err)
+		case AggregationRunAllThenDeny:
+			if len(errs) == 0 {
+				errs = append(errs, err)
+			}
+		default:
 			return err
 		}
 	}
 
-	return nil
+	return mergeErrors(errs)
+}
+
+// mergeErrors combines the errors of several validators into a single
+// StatusError listing each of them as a cause. The status code and reason
+// are those of the first error.
+func mergeErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+
+	merged := metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusForbidden,
+		Reason:  metav1.StatusReasonForbidden,
+		Details: &metav1.StatusDetails{},
+	}
+	messages := make([]string, 0, len(errs))
+	for i, err := range errs {
+		message := err.Error()
+		var causes []metav1.StatusCause
+		var statusErr *k8serrors.StatusError
+		if errors.As(err, &statusErr) {
+			status := statusErr.ErrStatus
+			message = status.Message
+			if i == 0 {
+				merged.Code = status.Code
+				merged.Reason = status.Reason
+				if status.Details != nil {
+					merged.Details.Group = status.Details.Group
+					merged.Details.Kind = status.Details.Kind
+					merged.Details.Name = status.Details.Name
+				}
+			}
+			if status.Details != nil {
+				causes = status.Details.Causes
+			}
+		}
+
+		messages = append(messages, message)
+		if len(causes) == 0 {
+			causes = []metav1.StatusCause{{Message: message}}
+		}
+		merged.Details.Causes = append(merged.Details.Causes, causes...)
+	}
+	merged.Message = fmt.Sprintf("%d validators denied the request: [%s]", len(errs), strings.Join(messages, ", "))
+
+	return &k8serrors.StatusError{ErrStatus: merged}
+}
+
+// Explain combines the explanations of every validator which can explain its
+// decisions. Validators which can't are listed as unexplained rather than
+// run, since they may call out to external webhooks. The decision itself is
+// the one Validate would make if they allowed the request.
+func (m multi) Explain(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) (*validatingadmissionpolicy.Explanation, error) {
+	result := &validatingadmissionpolicy.Explanation{Allowed: true}
+	var errs []error
+	for _, v := range m.validators {
+		if !v.Handles(a.GetOperation()) {
+			continue
+		}
+
+		explainer, ok := v.(validatingadmissionpolicy.Explainer)
+		if !ok {
+			result.Unexplained = append(result.Unexplained, describe(v))
+			continue
+		}
+
+		explanation, err := explainer.Explain(ctx, a, o)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Policies = append(result.Policies, explanation.Policies...)
+		if !explanation.Allowed {
+			errs = append(errs, errors.New(explanation.Message))
+		}
+	}
+
+	if len(errs) > 0 {
+		if m.aggregationFor(ctx) != AggregationCollectAll {
+			errs = errs[:1]
+		}
+		result.Allowed = false
+		result.Message = mergeErrors(errs).Error()
+	}
+
+	return result, nil
+}
+
+// describe names a validator in explanations
+func describe(v admission.ValidationInterface) string {
+	if stringer, ok := v.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Inspect combines the snapshots of every validator which can report the
+// policies it enforces
+func (m multi) Inspect() *validatingadmissionpolicy.Snapshot {
+	result := &validatingadmissionpolicy.Snapshot{
+		Synced:     true,
+		Policies:   []validatingadmissionpolicy.PolicySnapshot{},
+		ParamKinds: []validatingadmissionpolicy.ParamKindSnapshot{},
+	}
+	for _, v := range m.validators {
+		inspector, ok := v.(validatingadmissionpolicy.Inspector)
+		if !ok {
+			continue
+		}
+
+		snapshot := inspector.Inspect()
+		result.Synced = result.Synced && snapshot.Synced
+		result.Policies = append(result.Policies, snapshot.Policies...)
+		result.ParamKinds = append(result.ParamKinds, snapshot.ParamKinds...)
+		result.UnboundBindings = append(result.UnboundBindings, snapshot.UnboundBindings...)
+	}
+
+	return result
 }
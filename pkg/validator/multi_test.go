@@ -0,0 +1,144 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/warning"
+
+	"k8s.io/cel-admission-webhook/pkg/validatingadmissionpolicy"
+)
+
+type fakeValidator struct {
+	name string
+	err  error
+}
+
+func (v fakeValidator) Handles(operation admission.Operation) bool {
+	return true
+}
+
+func (v fakeValidator) Validate(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	warning.AddWarning(ctx, "", v.name)
+	return v.err
+}
+
+type warnings []string
+
+func (w *warnings) AddWarning(agent, text string) {
+	*w = append(*w, text)
+}
+
+func TestMultiValidate(t *testing.T) {
+	invalid := k8serrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "a", nil)
+	invalid.ErrStatus.Details.Causes = []metav1.StatusCause{{Type: metav1.CauseTypeFieldValueInvalid, Message: "bad", Field: "data"}}
+	validators := []admission.ValidationInterface{
+		fakeValidator{name: "allow"},
+		fakeValidator{name: "forbidden", err: k8serrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "a", errors.New("denied"))},
+		fakeValidator{name: "plain", err: errors.New("failed")},
+		fakeValidator{name: "invalid", err: invalid},
+	}
+
+	for _, testCase := range []struct {
+		aggregation Aggregation
+		warnings    warnings
+		message     string
+		causes      []metav1.StatusCause
+	}{
+		{
+			aggregation: AggregationFirstError,
+			warnings:    warnings{"allow", "forbidden"},
+			message:     `configmaps "a" is forbidden: denied`,
+		},
+		{
+			aggregation: AggregationRunAllThenDeny,
+			warnings:    warnings{"allow", "forbidden", "plain", "invalid"},
+			message:     `configmaps "a" is forbidden: denied`,
+		},
+		{
+			aggregation: AggregationCollectAll,
+			warnings:    warnings{"allow", "forbidden", "plain", "invalid"},
+			message:     `3 validators denied the request: [configmaps "a" is forbidden: denied, failed, ConfigMap "a" is invalid]`,
+			causes: []metav1.StatusCause{
+				{Message: `configmaps "a" is forbidden: denied`},
+				{Message: "failed"},
+				{Type: metav1.CauseTypeFieldValueInvalid, Message: "bad", Field: "data"},
+			},
+		},
+	} {
+		t.Run(string(testCase.aggregation), func(t *testing.T) {
+			recorded := warnings{}
+			ctx := warning.WithWarningRecorder(context.Background(), &recorded)
+			attributes := admission.NewAttributesRecord(nil, nil, schema.GroupVersionKind{}, "", "a", schema.GroupVersionResource{}, "", admission.Create, nil, false, nil)
+
+			err := NewMulti(testCase.aggregation, validators...).Validate(ctx, attributes, nil)
+			if !reflect.DeepEqual(recorded, testCase.warnings) {
+				t.Errorf("expected warnings %v, got %v", testCase.warnings, recorded)
+			}
+			if err == nil || err.Error() != testCase.message {
+				t.Fatalf("expected error %q, got %v", testCase.message, err)
+			}
+
+			var statusErr *k8serrors.StatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("expected a StatusError, got %T", err)
+			}
+			if statusErr.ErrStatus.Code != 403 {
+				t.Errorf("expected code 403, got %d", statusErr.ErrStatus.Code)
+			}
+			if testCase.causes != nil && !reflect.DeepEqual(statusErr.ErrStatus.Details.Causes, testCase.causes) {
+				t.Errorf("expected causes %v, got %v", testCase.causes, statusErr.ErrStatus.Details.Causes)
+			}
+		})
+	}
+}
+
+type fakeExplainer struct {
+	fakeValidator
+}
+
+func (v fakeExplainer) Explain(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) (*validatingadmissionpolicy.Explanation, error) {
+	explanation := &validatingadmissionpolicy.Explanation{
+		Allowed:  v.err == nil,
+		Policies: []*validatingadmissionpolicy.PolicyExplanation{{Name: v.name}},
+	}
+	if v.err != nil {
+		explanation.Message = v.err.Error()
+	}
+	return explanation, nil
+}
+
+func TestMultiExplain(t *testing.T) {
+	validator := NewMulti(AggregationCollectAll,
+		fakeExplainer{fakeValidator{name: "a", err: errors.New("denied")}},
+		fakeValidator{name: "webhook", err: errors.New("webhook denied")},
+	)
+
+	recorded := warnings{}
+	ctx := warning.WithWarningRecorder(context.Background(), &recorded)
+	attributes := admission.NewAttributesRecord(nil, nil, schema.GroupVersionKind{}, "", "a", schema.GroupVersionResource{}, "", admission.Create, nil, false, nil)
+	explanation, err := validator.(validatingadmissionpolicy.Explainer).Explain(ctx, attributes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Validators which can't explain their decisions are not run
+	if len(recorded) > 0 {
+		t.Errorf("expected no validator to be run, got warnings %v", recorded)
+	}
+	if explanation.Allowed || explanation.Message != "denied" {
+		t.Errorf("expected only the explained denial, got %+v", explanation)
+	}
+	if len(explanation.Policies) != 1 || explanation.Policies[0].Name != "a" {
+		t.Errorf("expected the explained policies, got %v", explanation.Policies)
+	}
+	if expected := []string{"validator.fakeValidator"}; !reflect.DeepEqual(explanation.Unexplained, expected) {
+		t.Errorf("expected unexplained validators %v, got %v", expected, explanation.Unexplained)
+	}
+}
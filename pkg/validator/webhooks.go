@@ -0,0 +1,261 @@
+package validator
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apiserver/pkg/admission"
+	webhookerrors "k8s.io/apiserver/pkg/admission/plugin/webhook/errors"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/generic"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/request"
+	"k8s.io/apiserver/pkg/warning"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// WebhookConfig describes a validating webhook requests are forwarded to
+type WebhookConfig struct {
+	// Name of the webhook, used in denial messages and to prefix the audit
+	// annotations it returns
+	Name string `json:"name"`
+
+	// HTTPS URL AdmissionReviews are posted to
+	URL string `json:"url"`
+
+	// PEM encoded CA bundle used to verify the webhook's serving
+	// certificate. The system roots are used if empty.
+	CABundle string `json:"caBundle,omitempty"`
+
+	// How long to wait for the webhook to respond. Defaults to 10s.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+
+	// What to do when the webhook cannot be called or returns an invalid
+	// response, Fail or Ignore. Defaults to Fail.
+	FailurePolicy admissionregistrationv1.FailurePolicyType `json:"failurePolicy,omitempty"`
+}
+
+type webhooksFile struct {
+	Webhooks []WebhookConfig `json:"webhooks"`
+}
+
+// LoadWebhooks reads the list of webhooks in the YAML or JSON file at path
+func LoadWebhooks(path string) ([]WebhookConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := webhooksFile{}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return file.Webhooks, nil
+}
+
+type webhook struct {
+	WebhookConfig
+	client *http.Client
+}
+
+// webhooks forwards requests to validating webhooks outside the cluster's
+// own admission chain, so that the polyfill can front them. Every webhook
+// is called for every request, in parallel, and their denials are merged.
+type webhooks struct {
+	webhooks []webhook
+	logger   klog.Logger
+}
+
+// NewWebhooks returns a validator calling the configured webhooks
+func NewWebhooks(configs []WebhookConfig) (admission.ValidationInterface, error) {
+	result := &webhooks{logger: klog.LoggerWithName(klog.Background(), "webhooks")}
+	names := map[string]bool{}
+	for _, config := range configs {
+		if len(config.Name) == 0 {
+			return nil, fmt.Errorf("webhook %s has no name", config.URL)
+		} else if names[config.Name] {
+			return nil, fmt.Errorf("duplicate webhook %q", config.Name)
+		}
+		names[config.Name] = true
+
+		if u, err := url.Parse(config.URL); err != nil {
+			return nil, fmt.Errorf("webhook %q has an invalid url: %w", config.Name, err)
+		} else if u.Scheme != "https" {
+			return nil, fmt.Errorf("webhook %q url must use https", config.Name)
+		}
+
+		switch config.FailurePolicy {
+		case "":
+			config.FailurePolicy = admissionregistrationv1.Fail
+		case admissionregistrationv1.Fail, admissionregistrationv1.Ignore:
+		default:
+			return nil, fmt.Errorf("webhook %q has unknown failurePolicy %q, must be %s or %s", config.Name, config.FailurePolicy, admissionregistrationv1.Fail, admissionregistrationv1.Ignore)
+		}
+		if config.Timeout.Duration <= 0 {
+			config.Timeout.Duration = 10 * time.Second
+		}
+
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if len(config.CABundle) > 0 {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM([]byte(config.CABundle)) {
+				return nil, fmt.Errorf("webhook %q has no certificates in its caBundle", config.Name)
+			}
+		}
+
+		result.webhooks = append(result.webhooks, webhook{
+			WebhookConfig: config,
+			client: &http.Client{
+				Timeout:   config.Timeout.Duration,
+				Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			},
+		})
+	}
+	return result, nil
+}
+
+func (w *webhooks) Handles(operation admission.Operation) bool {
+	return len(w.webhooks) > 0
+}
+
+func (w *webhooks) String() string {
+	names := make([]string, len(w.webhooks))
+	for i, hook := range w.webhooks {
+		names[i] = hook.Name
+	}
+	return fmt.Sprintf("webhooks %s", strings.Join(names, ", "))
+}
+
+func (w *webhooks) Validate(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	errs := make([]error, len(w.webhooks))
+	var wg sync.WaitGroup
+	for i := range w.webhooks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = w.call(ctx, &w.webhooks[i], a)
+		}(i)
+	}
+	wg.Wait()
+
+	var denials []error
+	for _, err := range errs {
+		if err != nil {
+			denials = append(denials, err)
+		}
+	}
+	return mergeErrors(denials)
+}
+
+// call sends the request to a webhook, returning its denial
+func (w *webhooks) call(ctx context.Context, hook *webhook, a admission.Attributes) error {
+	response, err := hook.review(ctx, a)
+	if err != nil {
+		if hook.FailurePolicy == admissionregistrationv1.Ignore {
+			w.logger.Error(err, "failed calling webhook, ignoring", "webhook", hook.Name)
+			return nil
+		}
+		return k8serrors.NewInternalError(fmt.Errorf("failed calling webhook %q: %w", hook.Name, err))
+	}
+
+	for _, text := range response.Warnings {
+		warning.AddWarning(ctx, "", text)
+	}
+	for key, value := range response.AuditAnnotations {
+		if err := a.AddAnnotation(hook.annotationKey(key), value); err != nil {
+			w.logger.Error(err, "failed to add audit annotation", "webhook", hook.Name, "key", key)
+		}
+	}
+
+	if !response.Allowed {
+		return webhookerrors.ToStatusErr(hook.Name, response.Result)
+	}
+	return nil
+}
+
+// annotationKey returns the key an audit annotation returned by the webhook
+// is recorded with. It is prefixed with the name of the webhook, like the
+// apiserver does, but with '-' rather than '/', since the apiserver prefixes
+// the key again with the name of the polyfill's own webhook, and rejects keys
+// with more than one '/'.
+func (hook *webhook) annotationKey(key string) string {
+	return hook.Name + "-" + strings.ReplaceAll(key, "/", "_")
+}
+
+// review posts an AdmissionReview of the request to the webhook, and
+// returns its verified response
+func (hook *webhook) review(ctx context.Context, a admission.Attributes) (*request.AdmissionResponse, error) {
+	uid := uuid.NewUUID()
+	review := request.CreateV1AdmissionReview(uid, &admission.VersionedAttributes{
+		Attributes:         a,
+		VersionedKind:      a.GetKind(),
+		VersionedObject:    withKind(a.GetObject(), a),
+		VersionedOldObject: withKind(a.GetOldObject(), a),
+	}, &generic.WebhookInvocation{
+		Resource:    a.GetResource(),
+		Subresource: a.GetSubresource(),
+		Kind:        a.GetKind(),
+	})
+	review.APIVersion = admissionv1.SchemeGroupVersion.String()
+	review.Kind = "AdmissionReview"
+
+	body, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Accept", "application/json")
+
+	httpResponse, err := hook.client.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+	data, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return nil, err
+	}
+	if httpResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d: %s", httpResponse.StatusCode, data)
+	}
+
+	result := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("invalid AdmissionReview: %w", err)
+	}
+	return request.VerifyAdmissionResponse(uid, false, result)
+}
+
+// withKind returns obj with the kind of the request set, so that webhooks
+// receive the same objects the apiserver would send them
+func withKind(obj runtime.Object, a admission.Attributes) runtime.Object {
+	if obj == nil {
+		return nil
+	}
+	if !obj.GetObjectKind().GroupVersionKind().Empty() {
+		return obj
+	}
+	obj = obj.DeepCopyObject()
+	obj.GetObjectKind().SetGroupVersionKind(a.GetKind())
+	return obj
+}
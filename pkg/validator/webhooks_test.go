@@ -0,0 +1,266 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/warning"
+)
+
+// newFakeWebhook serves AdmissionReviews, answering with respond
+func newFakeWebhook(t *testing.T, respond func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) WebhookConfig {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		review := &admissionv1.AdmissionReview{}
+		if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response := respond(review.Request)
+		response.UID = review.Request.UID
+		review.Request = nil
+		review.Response = response
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+	}))
+	t.Cleanup(server.Close)
+
+	return WebhookConfig{
+		Name:     server.Listener.Addr().String(),
+		URL:      server.URL + "/validate",
+		CABundle: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+	}
+}
+
+// annotatedAttributes records the audit annotations added to a request
+type annotatedAttributes struct {
+	admission.Attributes
+
+	lock        sync.Mutex
+	annotations map[string]string
+}
+
+func (a *annotatedAttributes) AddAnnotation(key, value string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.annotations[key] = value
+	return nil
+}
+
+func TestWebhooks(t *testing.T) {
+	allow := func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		return &admissionv1.AdmissionResponse{
+			Allowed:          true,
+			Warnings:         []string{"allowed " + request.Name},
+			AuditAnnotations: map[string]string{"seen": string(request.Operation)},
+		}
+	}
+	deny := func(message string) func(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		return func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+			return &admissionv1.AdmissionResponse{Result: &metav1.Status{Code: http.StatusForbidden, Message: message}}
+		}
+	}
+	hang := func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		time.Sleep(500 * time.Millisecond)
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	withPolicy := func(config WebhookConfig, policy admissionregistrationv1.FailurePolicyType) WebhookConfig {
+		config.FailurePolicy = policy
+		config.Timeout = metav1.Duration{Duration: 50 * time.Millisecond}
+		return config
+	}
+
+	for _, testCase := range []struct {
+		name        string
+		webhooks    func(t *testing.T) []WebhookConfig
+		err         string
+		warnings    []string
+		annotations int
+	}{
+		{
+			name: "allowed",
+			webhooks: func(t *testing.T) []WebhookConfig {
+				return []WebhookConfig{newFakeWebhook(t, allow), newFakeWebhook(t, allow)}
+			},
+			warnings:    []string{"allowed a", "allowed a"},
+			annotations: 2,
+		},
+		{
+			name: "denied",
+			webhooks: func(t *testing.T) []WebhookConfig {
+				return []WebhookConfig{newFakeWebhook(t, allow), {Name: "deny"}}
+			},
+			err:         `admission webhook "deny" denied the request: no`,
+			warnings:    []string{"allowed a"},
+			annotations: 1,
+		},
+		{
+			name: "all denials",
+			webhooks: func(t *testing.T) []WebhookConfig {
+				return []WebhookConfig{{Name: "deny"}, {Name: "deny again"}}
+			},
+			err: `2 validators denied the request: [admission webhook "deny" denied the request: no, admission webhook "deny again" denied the request: no]`,
+		},
+		{
+			name: "timeout failing closed",
+			webhooks: func(t *testing.T) []WebhookConfig {
+				return []WebhookConfig{withPolicy(newFakeWebhook(t, hang), admissionregistrationv1.Fail)}
+			},
+			err: "Internal error occurred: failed calling webhook",
+		},
+		{
+			name: "timeout ignored",
+			webhooks: func(t *testing.T) []WebhookConfig {
+				return []WebhookConfig{withPolicy(newFakeWebhook(t, hang), admissionregistrationv1.Ignore), newFakeWebhook(t, allow)}
+			},
+			warnings:    []string{"allowed a"},
+			annotations: 1,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			configs := testCase.webhooks(t)
+			for i, config := range configs {
+				if len(config.URL) == 0 {
+					// Placeholder for a webhook denying the request
+					name := config.Name
+					configs[i] = newFakeWebhook(t, deny("no"))
+					configs[i].Name = name
+				}
+			}
+			validator, err := NewWebhooks(configs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorded := warnings{}
+			ctx := warning.WithWarningRecorder(context.Background(), &recorded)
+			attributes := &annotatedAttributes{
+				Attributes: admission.NewAttributesRecord(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a"}}, nil,
+					corev1.SchemeGroupVersion.WithKind("ConfigMap"), "default", "a",
+					corev1.SchemeGroupVersion.WithResource("configmaps"), "",
+					admission.Create, nil, false, &user.DefaultInfo{Name: "user"},
+				),
+				annotations: map[string]string{},
+			}
+
+			err = validator.Validate(ctx, attributes, nil)
+			switch {
+			case len(testCase.err) == 0 && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case len(testCase.err) > 0 && (err == nil || !strings.HasPrefix(err.Error(), testCase.err)):
+				t.Errorf("expected error %q, got %v", testCase.err, err)
+			}
+
+			sort.Strings(recorded)
+			if len(recorded) == 0 {
+				recorded = nil
+			}
+			if !reflect.DeepEqual([]string(recorded), testCase.warnings) {
+				t.Errorf("expected warnings %v, got %v", testCase.warnings, recorded)
+			}
+			if len(attributes.annotations) != testCase.annotations {
+				t.Errorf("expected %d audit annotations, got %v", testCase.annotations, attributes.annotations)
+			}
+			for key, value := range attributes.annotations {
+				if value != "CREATE" {
+					t.Errorf("unexpected audit annotation %s=%s", key, value)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookAuditAnnotationKeys(t *testing.T) {
+	config := newFakeWebhook(t, func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+			AuditAnnotations: map[string]string{
+				"seen":             "yes",
+				"example.com/seen": "yes",
+			},
+		}
+	})
+	config.Name = "policy.example.com"
+	validator, err := NewWebhooks([]WebhookConfig{config})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newAttributes := func() admission.Attributes {
+		return admission.NewAttributesRecord(
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a"}}, nil,
+			corev1.SchemeGroupVersion.WithKind("ConfigMap"), "default", "a",
+			corev1.SchemeGroupVersion.WithResource("configmaps"), "",
+			admission.Create, nil, false, &user.DefaultInfo{Name: "user"},
+		)
+	}
+	attributes := &annotatedAttributes{Attributes: newAttributes(), annotations: map[string]string{}}
+	if err := validator.Validate(context.Background(), attributes, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"policy.example.com-seen":             "yes",
+		"policy.example.com-example.com_seen": "yes",
+	}
+	if !reflect.DeepEqual(attributes.annotations, expected) {
+		t.Errorf("expected audit annotations %v, got %v", expected, attributes.annotations)
+	}
+
+	// The apiserver prefixes the keys with the name of the polyfill's own
+	// webhook
+	record := newAttributes()
+	for key, value := range attributes.annotations {
+		if err := record.AddAnnotation("cel-admission-polyfill.example.com/"+key, value); err != nil {
+			t.Errorf("apiserver would drop audit annotation %q: %v", key, err)
+		}
+	}
+}
+
+func TestWebhookRequest(t *testing.T) {
+	var received *admissionv1.AdmissionRequest
+	config := newFakeWebhook(t, func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		received = request
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	})
+	validator, err := NewWebhooks([]WebhookConfig{config})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributes := admission.NewAttributesRecord(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Data: map[string]string{"k": "v"}}, nil,
+		corev1.SchemeGroupVersion.WithKind("ConfigMap"), "default", "a",
+		corev1.SchemeGroupVersion.WithResource("configmaps"), "",
+		admission.Create, nil, false, &user.DefaultInfo{Name: "user", Groups: []string{"group"}},
+	)
+	if err := validator.Validate(context.Background(), attributes, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Kind.Kind != "ConfigMap" || received.Resource.Resource != "configmaps" || received.Namespace != "default" || received.Name != "a" {
+		t.Errorf("unexpected request %+v", received)
+	}
+	if received.UserInfo.Username != "user" || !reflect.DeepEqual(received.UserInfo.Groups, []string{"group"}) {
+		t.Errorf("unexpected user %+v", received.UserInfo)
+	}
+	expected := `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"a","creationTimestamp":null},"data":{"k":"v"}}`
+	if string(received.Object.Raw) != expected {
+		t.Errorf("expected object %s, got %s", expected, received.Object.Raw)
+	}
+}
@@ -0,0 +1,139 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apiserver/pkg/admission"
+
+	"k8s.io/cel-admission-webhook/pkg/validatingadmissionpolicy"
+)
+
+// NewAdmin creates a server for the debugging endpoints. It is served over
+// plain HTTP and its endpoints are unauthenticated, so addr should only be
+// reachable by administrators.
+func NewAdmin(addr string, reviewer *Reviewer) Interface {
+	return &admin{
+		addr:     addr,
+		reviewer: reviewer,
+	}
+}
+
+type admin struct {
+	addr     string
+	reviewer *Reviewer
+}
+
+func (a *admin) Run(ctx context.Context) error {
+	fork, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/explain", a.handleExplain)
+	mux.HandleFunc("/debug/policies", a.handlePolicies)
+
+	srv := http.Server{
+		Addr:    a.addr,
+		Handler: mux,
+	}
+
+	var serverError error
+	go func() {
+		serverError = srv.ListenAndServe()
+		cancel()
+	}()
+
+	logger.Info("started admin HTTP server", "addr", a.addr)
+	defer logger.Info("admin server has stopped")
+	<-fork.Done()
+
+	if err := srv.Close(); err != nil {
+		logger.Error(err, "shutting down admin server")
+	}
+
+	err := ctx.Err()
+	if err == nil {
+		err = serverError
+	}
+	return err
+}
+
+// handleExplain evaluates the AdmissionReview in the request body and responds
+// with how each policy and binding took part in the decision
+func (a *admin) handleExplain(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parsed, err := parseRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	explanation, err := a.reviewer.Explain(req.Context(), parsed)
+	if err != nil {
+		http.Error(w, err.Error(), statusForError(err))
+		return
+	}
+
+	out, err := json.Marshal(explanation)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// handlePolicies responds with the policies, bindings and params currently
+// being enforced
+func (a *admin) handlePolicies(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	inspector, ok := a.reviewer.validator.(validatingadmissionpolicy.Inspector)
+	if !ok {
+		http.Error(w, "validator does not support listing policies", http.StatusNotImplemented)
+		return
+	}
+
+	out, err := json.MarshalIndent(inspector.Inspect(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// Explain evaluates the request in an AdmissionReview as Review does, and
+// describes how each policy and binding took part in the decision.
+func (r *Reviewer) Explain(ctx context.Context, review *admissionv1.AdmissionReview) (*validatingadmissionpolicy.Explanation, error) {
+	if review.Request == nil {
+		return nil, reviewError{errors.New("admission review can't be used: Request field is nil"), http.StatusBadRequest}
+	}
+
+	explainer, ok := r.validator.(validatingadmissionpolicy.Explainer)
+	if !ok {
+		return nil, reviewError{errors.New("validator does not support explaining decisions"), http.StatusNotImplemented}
+	}
+
+	if !r.validator.Handles(admission.Operation(review.Request.Operation)) {
+		return &validatingadmissionpolicy.Explanation{Allowed: true}, nil
+	}
+
+	attrs, err := r.attributes(review.Request)
+	if err != nil {
+		return nil, err
+	}
+	return explainer.Explain(ctx, attrs, r.objectInferfaces)
+}
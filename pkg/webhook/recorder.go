@@ -0,0 +1,401 @@
+package webhook
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Value written in place of redacted fields
+const redactedValue = "REDACTED"
+
+// Annotation kubectl apply stores the applied object in
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Matches the part of a denial or warning which names the policy responsible,
+// kept when the rest of the message is redacted so that replays can still
+// attribute changes to policies
+var policyMessagePattern = regexp.MustCompile(`^(?:Validation failed for )?ValidatingAdmissionPolicy '[^']*'(?: with binding '[^']*')?(?: denied request)?`)
+
+// RecordedReview is a single line of a recording
+type RecordedReview struct {
+	Time     time.Time                      `json:"time"`
+	Request  *admissionv1.AdmissionRequest  `json:"request"`
+	Response *admissionv1.AdmissionResponse `json:"response"`
+}
+
+type RecorderOptions struct {
+	// Path of the file recordings are appended to. Rotated files are kept
+	// alongside it as Path.1, Path.2, ...
+	Path string
+
+	// Size in bytes the file may grow to before it is rotated. Zero disables
+	// rotation
+	MaxSize int64
+
+	// Number of rotated files kept in addition to Path
+	MaxBackups int
+
+	// Fraction of requests to record, between 0 and 1
+	SampleRate float64
+
+	// Resources to record. If empty, requests for every resource are
+	// recorded
+	Resources []schema.GroupResource
+
+	// Additional fields to redact from the object and old object of every
+	// request, in addition to the data and stringData of Secrets. See
+	// ParseRedactPath for the syntax
+	RedactPaths []string
+}
+
+// Recorder appends AdmissionReview requests and their responses to a size
+// capped, rotating JSON lines file, so that traffic can later be replayed
+// against new policies.
+type Recorder struct {
+	options     RecorderOptions
+	redactPaths [][]string
+
+	// Returns a number in [0, 1) to decide whether a request is sampled
+	sample func() float64
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewRecorder(options RecorderOptions) (*Recorder, error) {
+	if options.SampleRate < 0 || options.SampleRate > 1 {
+		return nil, fmt.Errorf("sample rate must be between 0 and 1, got %v", options.SampleRate)
+	}
+
+	var redactPaths [][]string
+	for _, p := range options.RedactPaths {
+		parsed, err := ParseRedactPath(p)
+		if err != nil {
+			return nil, err
+		}
+		redactPaths = append(redactPaths, parsed)
+	}
+
+	recorder := &Recorder{
+		options:     options,
+		redactPaths: redactPaths,
+		sample:      rand.Float64,
+	}
+
+	if err := recorder.open(); err != nil {
+		return nil, err
+	}
+	return recorder, nil
+}
+
+func (r *Recorder) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.options.Path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(r.options.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// rotate closes the current file, shifts the backups along by one, dropping
+// the oldest, and opens a new empty file. If it fails part way through, the
+// file is left closed for Record to reopen
+func (r *Recorder) rotate() error {
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return err
+	}
+
+	backup := func(i int) string {
+		return fmt.Sprintf("%s.%d", r.options.Path, i)
+	}
+
+	if r.options.MaxBackups <= 0 {
+		if err := os.Remove(r.options.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		for i := r.options.MaxBackups - 1; i >= 1; i-- {
+			if err := os.Rename(backup(i), backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(r.options.Path, backup(1)); err != nil {
+			return err
+		}
+	}
+
+	return r.open()
+}
+
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// Record appends the request and its response to the recording if the
+// request passes the resource filter and is sampled. Responses to requests
+// with redacted fields are redacted too, since policies may echo those fields
+// back in messages, warnings and audit annotations.
+func (r *Recorder) Record(request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionResponse) error {
+	if !r.matches(request) || r.sample() >= r.options.SampleRate {
+		return nil
+	}
+
+	redacted := request.DeepCopy()
+	var err error
+	if redacted.Object.Raw, err = r.redact(request, request.Object.Raw); err != nil {
+		return fmt.Errorf("failed to redact object: %w", err)
+	}
+	if redacted.OldObject.Raw, err = r.redact(request, request.OldObject.Raw); err != nil {
+		return fmt.Errorf("failed to redact old object: %w", err)
+	}
+
+	if isSecret(request) || len(r.redactPaths) > 0 {
+		response = redactResponse(response)
+	}
+
+	line, err := json.Marshal(RecordedReview{
+		Time:     time.Now().UTC(),
+		Request:  redacted,
+		Response: response,
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var rotateErr error
+	if r.options.MaxSize > 0 && r.size > 0 && r.size+int64(len(line)) > r.options.MaxSize {
+		if err := r.rotate(); err != nil {
+			rotateErr = fmt.Errorf("failed to rotate recording: %w", err)
+		}
+	}
+
+	// Reopen the file if a previous rotation failed to, appending to
+	// whatever is left at Path rather than losing every later review
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return fmt.Errorf("failed to reopen recording: %w", err)
+		}
+	}
+
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+func (r *Recorder) matches(request *admissionv1.AdmissionRequest) bool {
+	if len(r.options.Resources) == 0 {
+		return true
+	}
+
+	for _, gr := range r.options.Resources {
+		if gr.Group == request.Resource.Group && gr.Resource == request.Resource.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Recorder) redact(request *admissionv1.AdmissionRequest, raw []byte) ([]byte, error) {
+	if len(raw) == 0 {
+		return raw, nil
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+
+	if isSecret(request) {
+		// Keep the keys, since policies may check for them, but not the
+		// values. data must stay valid base64 for the Secret to decode
+		if data, ok := object["data"].(map[string]interface{}); ok {
+			for k := range data {
+				data[k] = base64.StdEncoding.EncodeToString([]byte(redactedValue))
+			}
+		}
+		if stringData, ok := object["stringData"].(map[string]interface{}); ok {
+			for k := range stringData {
+				stringData[k] = redactedValue
+			}
+		}
+		// kubectl apply keeps the whole Secret, values included, in an
+		// annotation
+		if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+			if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+				if _, ok := annotations[lastAppliedAnnotation]; ok {
+					annotations[lastAppliedAnnotation] = redactedValue
+				}
+			}
+		}
+	}
+
+	for _, path := range r.redactPaths {
+		redactPath(object, path)
+	}
+
+	return json.Marshal(object)
+}
+
+func isSecret(request *admissionv1.AdmissionRequest) bool {
+	return request.Kind.Group == "" && request.Kind.Kind == "Secret"
+}
+
+// redactResponse returns a copy of response with every message, warning and
+// audit annotation value replaced with redactedValue, keeping only the policy
+// and binding responsible for them
+func redactResponse(response *admissionv1.AdmissionResponse) *admissionv1.AdmissionResponse {
+	if response == nil {
+		return nil
+	}
+
+	redacted := response.DeepCopy()
+	if result := redacted.Result; result != nil {
+		result.Message = redactMessage(result.Message)
+		if result.Details != nil {
+			for i := range result.Details.Causes {
+				result.Details.Causes[i].Message = redactMessage(result.Details.Causes[i].Message)
+			}
+		}
+	}
+	for i := range redacted.Warnings {
+		redacted.Warnings[i] = redactMessage(redacted.Warnings[i])
+	}
+	for key := range redacted.AuditAnnotations {
+		redacted.AuditAnnotations[key] = redactedValue
+	}
+	return redacted
+}
+
+func redactMessage(message string) string {
+	if message == "" {
+		return message
+	}
+	if prefix := policyMessagePattern.FindString(message); prefix != "" {
+		return prefix + ": " + redactedValue
+	}
+	return redactedValue
+}
+
+// redactPath replaces every value in obj found at path with redactedValue.
+// A "*" segment matches every field of a map or element of a list.
+func redactPath(obj interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+
+	segment, rest := path[0], path[1:]
+	switch typed := obj.(type) {
+	case map[string]interface{}:
+		for k, v := range typed {
+			if segment != "*" && segment != k {
+				continue
+			}
+			if len(rest) == 0 {
+				typed[k] = redactedValue
+			} else {
+				redactPath(v, rest)
+			}
+		}
+	case []interface{}:
+		if segment != "*" {
+			return
+		}
+		for i, v := range typed {
+			if len(rest) == 0 {
+				typed[i] = redactedValue
+			} else {
+				redactPath(v, rest)
+			}
+		}
+	}
+}
+
+// ParseRedactPath parses a path to a field of an object into its segments.
+// Segments are separated by dots, and may be written in brackets when they
+// contain dots themselves:
+//
+//	spec.containers[*].env
+//	metadata.annotations['kubectl.kubernetes.io/last-applied-configuration']
+func ParseRedactPath(path string) ([]string, error) {
+	var segments []string
+	remaining := strings.TrimPrefix(path, ".")
+	for len(remaining) > 0 {
+		switch {
+		case strings.HasPrefix(remaining, "[*]"):
+			segments = append(segments, "*")
+			remaining = remaining[len("[*]"):]
+		case strings.HasPrefix(remaining, "['") || strings.HasPrefix(remaining, `["`):
+			quote := remaining[1:2]
+			end := strings.Index(remaining[2:], quote+"]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid redact path %q: unterminated bracket", path)
+			}
+			segments = append(segments, remaining[2:2+end])
+			remaining = remaining[2+end+2:]
+		case strings.HasPrefix(remaining, "["):
+			return nil, fmt.Errorf("invalid redact path %q: brackets must contain * or a quoted field name", path)
+		default:
+			end := strings.IndexAny(remaining, ".[")
+			if end < 0 {
+				end = len(remaining)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid redact path %q: empty field name", path)
+			}
+			segments = append(segments, remaining[:end])
+			remaining = remaining[end:]
+		}
+
+		if strings.HasPrefix(remaining, ".") {
+			remaining = remaining[1:]
+			if len(remaining) == 0 {
+				return nil, fmt.Errorf("invalid redact path %q: trailing dot", path)
+			}
+		} else if len(remaining) > 0 && !strings.HasPrefix(remaining, "[") {
+			return nil, fmt.Errorf("invalid redact path %q", path)
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid redact path %q: empty path", path)
+	}
+	return segments, nil
+}
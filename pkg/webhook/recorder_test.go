@@ -0,0 +1,284 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func recordedRequest(resource, kind, object string) *admissionv1.AdmissionRequest {
+	return &admissionv1.AdmissionRequest{
+		UID:       "uid",
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: kind},
+		Resource:  metav1.GroupVersionResource{Version: "v1", Resource: resource},
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: []byte(object)},
+	}
+}
+
+func readRecording(t *testing.T, path string) []RecordedReview {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reviews []RecordedReview
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var review RecordedReview
+		if err := json.Unmarshal([]byte(line), &review); err != nil {
+			t.Fatal(err)
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews
+}
+
+func TestRecorderRedaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	recorder, err := NewRecorder(RecorderOptions{
+		Path:        path,
+		SampleRate:  1,
+		RedactPaths: []string{"metadata.annotations['example.com/token']", "spec.containers[*].env"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	const applied = `{"metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"apiVersion\":\"v1\",\"kind\":\"Secret\",\"stringData\":{\"token\":\"hunter2\"}}","keep":"me"}},"data":{"token":"aHVudGVyMg=="}}`
+	appliedSecret := recordedRequest("secrets", "Secret", applied)
+	appliedSecret.Operation = admissionv1.Update
+	appliedSecret.OldObject = runtime.RawExtension{Raw: []byte(applied)}
+
+	response := &admissionv1.AdmissionResponse{UID: "uid", Allowed: true}
+	for _, request := range []*admissionv1.AdmissionRequest{
+		recordedRequest("secrets", "Secret", `{"data":{"password":"aHVudGVyMg=="},"stringData":{"token":"hunter2"}}`),
+		recordedRequest("pods", "Pod", `{"metadata":{"annotations":{"example.com/token":"hunter2","keep":"me"}},"spec":{"containers":[{"name":"a","env":[{"name":"X"}]}]}}`),
+		appliedSecret,
+	} {
+		if err := recorder.Record(request, response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reviews := readRecording(t, path)
+	if len(reviews) != 3 {
+		t.Fatalf("expected 3 recorded reviews, got %d", len(reviews))
+	}
+
+	for i, expected := range []string{
+		`{"data":{"password":"UkVEQUNURUQ="},"stringData":{"token":"REDACTED"}}`,
+		`{"metadata":{"annotations":{"example.com/token":"REDACTED","keep":"me"}},"spec":{"containers":[{"env":"REDACTED","name":"a"}]}}`,
+		`{"data":{"token":"UkVEQUNURUQ="},"metadata":{"annotations":{"keep":"me","kubectl.kubernetes.io/last-applied-configuration":"REDACTED"}}}`,
+	} {
+		if actual := string(reviews[i].Request.Object.Raw); actual != expected {
+			t.Errorf("review %d: expected %s, got %s", i, expected, actual)
+		}
+		if old := string(reviews[i].Request.OldObject.Raw); len(old) > 0 && old != expected {
+			t.Errorf("review %d: expected old object %s, got %s", i, expected, old)
+		}
+		if !reviews[i].Response.Allowed {
+			t.Errorf("review %d: expected response to be recorded", i)
+		}
+	}
+}
+
+func TestRecorderResponseRedaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	recorder, err := NewRecorder(RecorderOptions{Path: path, SampleRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	response := func() *admissionv1.AdmissionResponse {
+		return &admissionv1.AdmissionResponse{
+			UID:     "uid",
+			Allowed: false,
+			Result: &metav1.Status{
+				Message: "ValidatingAdmissionPolicy 'p' with binding 'b' denied request: password hunter2 is too short",
+				Code:    422,
+				Details: &metav1.StatusDetails{Causes: []metav1.StatusCause{{Message: "password hunter2 is too short"}}},
+			},
+			Warnings:         []string{"Validation failed for ValidatingAdmissionPolicy 'p' with binding 'b': password hunter2 is too short"},
+			AuditAnnotations: map[string]string{"p-password": "hunter2"},
+		}
+	}
+	for _, request := range []*admissionv1.AdmissionRequest{
+		recordedRequest("secrets", "Secret", `{"stringData":{"password":"hunter2"}}`),
+		recordedRequest("configmaps", "ConfigMap", `{"data":{"password":"hunter2"}}`),
+	} {
+		if err := recorder.Record(request, response()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reviews := readRecording(t, path)
+	if len(reviews) != 2 {
+		t.Fatalf("expected 2 recorded reviews, got %d", len(reviews))
+	}
+
+	expected := &admissionv1.AdmissionResponse{
+		UID:     "uid",
+		Allowed: false,
+		Result: &metav1.Status{
+			Message: "ValidatingAdmissionPolicy 'p' with binding 'b' denied request: REDACTED",
+			Code:    422,
+			Details: &metav1.StatusDetails{Causes: []metav1.StatusCause{{Message: "REDACTED"}}},
+		},
+		Warnings:         []string{"Validation failed for ValidatingAdmissionPolicy 'p' with binding 'b': REDACTED"},
+		AuditAnnotations: map[string]string{"p-password": "REDACTED"},
+	}
+	if !reflect.DeepEqual(reviews[0].Response, expected) {
+		t.Errorf("expected Secret response %+v, got %+v", expected, reviews[0].Response)
+	}
+	if !reflect.DeepEqual(reviews[1].Response, response()) {
+		t.Errorf("expected ConfigMap response to be recorded verbatim, got %+v", reviews[1].Response)
+	}
+}
+
+func TestRecorderFilterAndRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	recorder, err := NewRecorder(RecorderOptions{
+		Path:       path,
+		MaxSize:    1,
+		MaxBackups: 2,
+		SampleRate: 0.5,
+		Resources:  []schema.GroupResource{{Resource: "configmaps"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	samples := []float64{0.1, 0.9, 0.2, 0.3, 0.4}
+	recorder.sample = func() float64 {
+		sample := samples[0]
+		samples = samples[1:]
+		return sample
+	}
+
+	response := &admissionv1.AdmissionResponse{UID: "uid", Allowed: true}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if err := recorder.Record(recordedRequest("configmaps", "ConfigMap", `{"name":"`+name+`"}`), response); err != nil {
+			t.Fatal(err)
+		}
+		// Filtered out before sampling
+		if err := recorder.Record(recordedRequest("secrets", "Secret", `{}`), response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// b is not sampled, and each file holds a single review since MaxSize is
+	// smaller than any line. Only the newest file and two backups are kept
+	var names []string
+	for _, p := range []string{path + ".2", path + ".1", path} {
+		for _, review := range readRecording(t, p) {
+			names = append(names, string(review.Request.Object.Raw))
+		}
+	}
+	expected := []string{`{"name":"c"}`, `{"name":"d"}`, `{"name":"e"}`}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups to be kept")
+	}
+}
+
+func TestParseRedactPath(t *testing.T) {
+	for _, testCase := range []struct {
+		path     string
+		expected []string
+		err      bool
+	}{
+		{path: "data", expected: []string{"data"}},
+		{path: ".spec.containers[*].env", expected: []string{"spec", "containers", "*", "env"}},
+		{path: `metadata.annotations["a.b/c"]`, expected: []string{"metadata", "annotations", "a.b/c"}},
+		{path: "", err: true},
+		{path: "spec.", err: true},
+		{path: "spec..env", err: true},
+		{path: "spec[0]", err: true},
+		{path: "spec['unterminated", err: true},
+	} {
+		t.Run(testCase.path, func(t *testing.T) {
+			actual, err := ParseRedactPath(testCase.path)
+			if testCase.err {
+				if err == nil {
+					t.Errorf("expected error, got %v", actual)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, testCase.expected) {
+				t.Errorf("expected %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRecorderRotationFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	recorder, err := NewRecorder(RecorderOptions{
+		Path:       path,
+		MaxSize:    1,
+		MaxBackups: 1,
+		SampleRate: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	// A non-empty directory in the way of the backup makes rotation fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	record := func(name string) error {
+		return recorder.Record(recordedRequest("configmaps", "ConfigMap", `{"name":"`+name+`"}`), &admissionv1.AdmissionResponse{UID: "uid", Allowed: true})
+	}
+	names := func(p string) []string {
+		var names []string
+		for _, review := range readRecording(t, p) {
+			names = append(names, string(review.Request.Object.Raw))
+		}
+		return names
+	}
+
+	if err := record("a"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b", "c"} {
+		if err := record(name); err == nil {
+			t.Fatalf("expected recording %s to fail to rotate", name)
+		}
+	}
+	expected := []string{`{"name":"a"}`, `{"name":"b"}`, `{"name":"c"}`}
+	if actual := names(path); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected reviews to still be recorded after failing to rotate, expected %v, got %v", expected, actual)
+	}
+
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := record("d"); err != nil {
+		t.Fatal(err)
+	}
+	if actual := names(path + ".1"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected backup %v, got %v", expected, actual)
+	}
+	if actual, expected := names(path), []string{`{"name":"d"}`}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
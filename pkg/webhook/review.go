@@ -0,0 +1,294 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apiserver/pkg/admission"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/warning"
+)
+
+// Reviewer evaluates AdmissionReview requests against a validator. The HTTPS
+// server and stream mode both use it, so they always reach the same decision
+// for the same request.
+type Reviewer struct {
+	validator        admission.ValidationInterface
+	objectInferfaces admission.ObjectInterfaces
+	decoder          runtime.Decoder
+
+	// Optional. Records every reviewed request and its response
+	recorder *Recorder
+}
+
+func NewReviewer(scheme *runtime.Scheme, validator admission.ValidationInterface) *Reviewer {
+	codecs := serializer.NewCodecFactory(scheme)
+	return &Reviewer{
+		objectInferfaces: admission.NewObjectInterfacesFromScheme(scheme),
+		decoder:          codecs.UniversalDeserializer(),
+		validator:        validator,
+	}
+}
+
+// SetRecorder records every request reviewed from now on, along with its
+// response, to recorder
+func (r *Reviewer) SetRecorder(recorder *Recorder) {
+	r.recorder = recorder
+}
+
+// reviewError is returned by Review when the request itself could not be
+// evaluated. status is the HTTP status code the webhook server responds with.
+type reviewError struct {
+	error
+	status int
+}
+
+func (e reviewError) Unwrap() error {
+	return e.error
+}
+
+func statusForError(err error) int {
+	var reviewErr reviewError
+	if errors.As(err, &reviewErr) {
+		return reviewErr.status
+	}
+	return http.StatusInternalServerError
+}
+
+// Review validates the request in an AdmissionReview and returns the
+// AdmissionReview response. A denied request is not an error; errors are
+// only returned if the request could not be evaluated at all.
+func (r *Reviewer) Review(ctx context.Context, review *admissionv1.AdmissionReview) (*admissionv1.AdmissionReview, error) {
+	if review.Request == nil {
+		return nil, reviewError{errors.New("admission review can't be used: Request field is nil"), http.StatusBadRequest}
+	}
+	request := review.Request
+
+	logger.Info(
+		"review request",
+		"resource",
+		request.Resource.String(),
+		"namespace",
+		request.Namespace,
+		"name",
+		request.Name,
+		"uid",
+		request.UID,
+	)
+
+	var validateErr error
+	var annotations map[string]string
+	warnings := &warningRecorder{}
+
+	if r.validator.Handles(admission.Operation(request.Operation)) {
+		attrs, err := r.attributes(request)
+		if err != nil {
+			logger.Error(err, "review response", "uid", request.UID, "status", statusForError(err))
+			return nil, err
+		}
+
+		validateErr = r.validator.Validate(warning.WithWarningRecorder(ctx, warnings), attrs, r.objectInferfaces)
+		annotations = attrs.annotations
+	}
+
+	response := reviewResponse(
+		request.UID,
+		validateErr,
+	)
+	response.Response.Warnings = warnings.warnings
+	response.Response.AuditAnnotations = annotations
+
+	logger.Info(
+		"review response",
+		"resource",
+		request.Resource.String(),
+		"namespace",
+		request.Namespace,
+		"name",
+		request.Name,
+		"allowed",
+		response.Response.Allowed,
+		"msg",
+		response.Response.Result.Message,
+		"reason",
+		response.Response.Result.Reason,
+		"uid",
+		request.UID,
+	)
+
+	if r.recorder != nil {
+		if err := r.recorder.Record(request, response.Response); err != nil {
+			logger.Error(err, "failed to record review", "uid", request.UID)
+		}
+	}
+	return response, nil
+}
+
+// reviewAttributes collects the audit annotations added by validators so that
+// they can be returned in the AdmissionReview response
+type reviewAttributes struct {
+	admission.Attributes
+
+	lock        sync.Mutex
+	annotations map[string]string
+}
+
+func (a *reviewAttributes) AddAnnotation(key, value string) error {
+	return a.AddAnnotationWithLevel(key, value, auditinternal.LevelMetadata)
+}
+
+// AddAnnotationWithLevel records the annotation under the key it is returned
+// to the apiserver with, which must be valid once the apiserver prefixes it
+// with the name of the webhook
+func (a *reviewAttributes) AddAnnotationWithLevel(key, value string, level auditinternal.Level) error {
+	key = annotationKey(key)
+	if msgs := validation.IsQualifiedName(key); len(msgs) != 0 {
+		return fmt.Errorf("annotation key %q has invalid format: %s", key, strings.Join(msgs, ","))
+	}
+	if level.Less(auditinternal.LevelMetadata) {
+		return fmt.Errorf("admission annotations are not allowed to be set at audit level lower than Metadata, key: %q, level: %s", key, level)
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.annotations == nil {
+		a.annotations = map[string]string{}
+	}
+	if existing, ok := a.annotations[key]; ok && existing != value {
+		return fmt.Errorf("admission annotations are not allowed to be overwritten, key: %q, old value: %q, new value: %q", key, existing, value)
+	}
+	a.annotations[key] = value
+	return nil
+}
+
+// annotationKey returns the key an audit annotation is returned to the
+// apiserver with. The apiserver prefixes the keys returned by webhooks with
+// the webhook's name, and rejects keys with more than one '/', so the
+// prefixes validators use are folded into the name.
+func annotationKey(key string) string {
+	return strings.ReplaceAll(key, "/", "_")
+}
+
+// warningRecorder collects the warnings added by validators so that they can
+// be returned in the AdmissionReview response
+type warningRecorder struct {
+	lock     sync.Mutex
+	warnings []string
+}
+
+func (w *warningRecorder) AddWarning(agent, text string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, existing := range w.warnings {
+		if existing == text {
+			return
+		}
+	}
+	w.warnings = append(w.warnings, text)
+}
+
+// attributes decodes the objects of an admission request into the attributes
+// validators are invoked with
+func (r *Reviewer) attributes(request *admissionv1.AdmissionRequest) (*reviewAttributes, error) {
+	var object runtime.Object
+	var oldObject runtime.Object
+
+	if len(request.OldObject.Raw) > 0 {
+		obj, gvk, err := r.decoder.Decode(request.OldObject.Raw, nil, nil)
+		switch {
+		case gvk == nil || *gvk != schema.GroupVersionKind(request.Kind):
+			// GVK case first. If object type is unknown it is parsed to
+			// unstructured, but
+			return nil, reviewError{fmt.Errorf("unexpected GVK %v. Expected %v", gvk, request.Kind), http.StatusBadRequest}
+		case err != nil && runtime.IsNotRegisteredError(err):
+			var oldUnstructured unstructured.Unstructured
+			err = json.Unmarshal(request.OldObject.Raw, &oldUnstructured)
+			if err != nil {
+				return nil, reviewError{err, http.StatusInternalServerError}
+			}
+
+			oldObject = &oldUnstructured
+		case err != nil:
+			return nil, reviewError{err, http.StatusBadRequest}
+		default:
+			oldObject = obj
+		}
+	}
+
+	if len(request.Object.Raw) > 0 {
+		obj, gvk, err := r.decoder.Decode(request.Object.Raw, nil, nil)
+		switch {
+		case gvk == nil || *gvk != schema.GroupVersionKind(request.Kind):
+			// GVK case first. If object type is unknown it is parsed to
+			// unstructured, but
+			return nil, reviewError{fmt.Errorf("unexpected GVK %v. Expected %v", gvk, request.Kind), http.StatusBadRequest}
+		case err != nil && runtime.IsNotRegisteredError(err):
+			var objUnstructured unstructured.Unstructured
+			err = json.Unmarshal(request.Object.Raw, &objUnstructured)
+			if err != nil {
+				return nil, reviewError{err, http.StatusInternalServerError}
+			}
+
+			object = &objUnstructured
+		case err != nil:
+			return nil, reviewError{err, http.StatusBadRequest}
+		default:
+			object = obj
+		}
+	}
+
+	// Parse into native types if possible
+	convertExtra := func(input map[string]authenticationv1.ExtraValue) map[string][]string {
+		if input == nil {
+			return nil
+		}
+
+		res := map[string][]string{}
+		for k, v := range input {
+			var converted []string
+			for _, s := range v {
+				converted = append(converted, string(s))
+			}
+			res[k] = converted
+		}
+		return res
+	}
+
+	//!TODO: Parse options as v1.CreateOptions, v1.DeleteOptions, or v1.PatchOptions
+
+	attrs := &reviewAttributes{Attributes: admission.NewAttributesRecord(
+		object,
+		oldObject,
+		schema.GroupVersionKind(request.Kind),
+		request.Namespace,
+		request.Name,
+		schema.GroupVersionResource{
+			Group:    request.Resource.Group,
+			Version:  request.Resource.Version,
+			Resource: request.Resource.Resource,
+		},
+		request.SubResource,
+		admission.Operation(request.Operation),
+		nil, // operation options?
+		false,
+		&user.DefaultInfo{
+			Name:   request.UserInfo.Username,
+			UID:    request.UserInfo.UID,
+			Groups: request.UserInfo.Groups,
+			Extra:  convertExtra(request.UserInfo.Extra),
+		})}
+	return attrs, nil
+}
@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+type annotating map[string]string
+
+func (a annotating) Handles(admission.Operation) bool {
+	return true
+}
+
+func (a annotating) Validate(ctx context.Context, attributes admission.Attributes, o admission.ObjectInterfaces) error {
+	for key, value := range a {
+		if err := attributes.AddAnnotation(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestReviewAuditAnnotations(t *testing.T) {
+	reviewer := NewReviewer(clientsetscheme.Scheme, annotating{
+		"validation.policy.admission.k8s.io/validation_failure": "failure",
+		"policy.example.com/key":                                "policy",
+		"enforcement-downgraded-0":                              "downgraded",
+	})
+
+	request := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal([]byte(review("1", "name")), request); err != nil {
+		t.Fatal(err)
+	}
+	response, err := reviewer.Review(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Response.Allowed {
+		t.Fatalf("expected the request to be allowed, got %v", response.Response.Result)
+	}
+
+	expected := map[string]string{
+		"validation.policy.admission.k8s.io_validation_failure": "failure",
+		"policy.example.com_key":                                "policy",
+		"enforcement-downgraded-0":                              "downgraded",
+	}
+	if !reflect.DeepEqual(response.Response.AuditAnnotations, expected) {
+		t.Errorf("expected audit annotations %v, got %v", expected, response.Response.AuditAnnotations)
+	}
+
+	// The apiserver prefixes the keys with the name of the webhook before
+	// adding them to the request's attributes
+	attributes := admission.NewAttributesRecord(nil, nil, schema.GroupVersionKind{}, "default", "name", schema.GroupVersionResource{}, "", admission.Create, nil, false, nil)
+	for key, value := range response.Response.AuditAnnotations {
+		if err := attributes.AddAnnotation("cel-admission-polyfill.example.com/"+key, value); err != nil {
+			t.Errorf("apiserver would drop audit annotation %q: %v", key, err)
+		}
+	}
+}
@@ -10,17 +10,13 @@ import (
 	"sync"
 
 	admissionv1 "k8s.io/api/admission/v1"
-	authenticationv1 "k8s.io/api/authentication/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apiserver/pkg/admission"
-	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/klog/v2"
+
+	"k8s.io/cel-admission-webhook/pkg/conversion"
 )
 
 var logger klog.Logger = klog.LoggerWithName(klog.Background(), "webhook")
@@ -37,24 +33,19 @@ type Interface interface {
 	Run(ctx context.Context) error
 }
 
-func New(addr string, certFile, keyFile string, scheme *runtime.Scheme, validator admission.ValidationInterface) Interface {
-	codecs := serializer.NewCodecFactory(scheme)
+func New(addr string, certFile, keyFile string, reviewer *Reviewer) Interface {
 	return &webhook{
-		objectInferfaces: admission.NewObjectInterfacesFromScheme(scheme),
-		decoder:          codecs.UniversalDeserializer(),
-		validator:        validator,
-		addr:             addr,
-		certFile:         certFile,
-		keyFile:          keyFile,
+		reviewer: reviewer,
+		addr:     addr,
+		certFile: certFile,
+		keyFile:  keyFile,
 	}
 }
 
 type webhook struct {
 	lock              sync.Mutex
 	port              int
-	validator         admission.ValidationInterface
-	objectInferfaces  admission.ObjectInterfaces
-	decoder           runtime.Decoder
+	reviewer          *Reviewer
 	addr              string
 	certFile, keyFile string
 }
@@ -66,6 +57,7 @@ func (wh *webhook) Run(ctx context.Context) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", wh.handleHealth)
 	mux.HandleFunc("/validate", wh.handleWebhookValidate)
+	mux.HandleFunc("/convert", wh.handleConvert)
 
 	srv := http.Server{}
 	srv.Handler = mux
@@ -115,153 +107,49 @@ func (wh *webhook) handleWebhookValidate(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	logger.Info(
-		"review request",
-		"resource",
-		parsed.Request.Resource.String(),
-		"namespace",
-		parsed.Request.Namespace,
-		"name",
-		parsed.Request.Name,
-		"uid",
-		parsed.Request.UID,
-	)
-
-	failure := func(err error, status int) {
-		http.Error(w, err.Error(), status)
-		logger.Error(err, "review response", "uid", parsed.Request.UID, "status", status)
+	response, err := wh.reviewer.Review(req.Context(), parsed)
+	if err != nil {
+		http.Error(w, err.Error(), statusForError(err))
+		return
 	}
 
-	err = nil
-
-	if wh.validator.Handles(admission.Operation(parsed.Request.Operation)) {
-		var object runtime.Object
-		var oldObject runtime.Object
-
-		if len(parsed.Request.OldObject.Raw) > 0 {
-			obj, gvk, err := wh.decoder.Decode(parsed.Request.OldObject.Raw, nil, nil)
-			switch {
-			case gvk == nil || *gvk != schema.GroupVersionKind(parsed.Request.Kind):
-				// GVK case first. If object type is unknown it is parsed to
-				// unstructured, but
-				failure(fmt.Errorf("unexpected GVK %v. Expected %v", gvk, parsed.Request.Kind), http.StatusBadRequest)
-				return
-			case err != nil && runtime.IsNotRegisteredError(err):
-				var oldUnstructured unstructured.Unstructured
-				err = json.Unmarshal(parsed.Request.OldObject.Raw, &oldUnstructured)
-				if err != nil {
-					failure(err, http.StatusInternalServerError)
-					return
-				}
-
-				oldObject = &oldUnstructured
-			case err != nil:
-				failure(err, http.StatusBadRequest)
-				return
-			default:
-				oldObject = obj
-			}
-		}
-
-		if len(parsed.Request.Object.Raw) > 0 {
-			obj, gvk, err := wh.decoder.Decode(parsed.Request.Object.Raw, nil, nil)
-			switch {
-			case gvk == nil || *gvk != schema.GroupVersionKind(parsed.Request.Kind):
-				// GVK case first. If object type is unknown it is parsed to
-				// unstructured, but
-				failure(fmt.Errorf("unexpected GVK %v. Expected %v", gvk, parsed.Request.Kind), http.StatusBadRequest)
-				return
-			case err != nil && runtime.IsNotRegisteredError(err):
-				var objUnstructured unstructured.Unstructured
-				err = json.Unmarshal(parsed.Request.Object.Raw, &objUnstructured)
-				if err != nil {
-					failure(err, http.StatusInternalServerError)
-					return
-				}
-
-				object = &objUnstructured
-			case err != nil:
-				failure(err, http.StatusBadRequest)
-				return
-			default:
-				object = obj
-			}
-		}
-
-		// Parse into native types if possible
-		convertExtra := func(input map[string]authenticationv1.ExtraValue) map[string][]string {
-			if input == nil {
-				return nil
-			}
-
-			res := map[string][]string{}
-			for k, v := range input {
-				var converted []string
-				for _, s := range v {
-					converted = append(converted, string(s))
-				}
-				res[k] = converted
-			}
-			return res
-		}
-
-		//!TODO: Parse options as v1.CreateOptions, v1.DeleteOptions, or v1.PatchOptions
-
-		attrs := admission.NewAttributesRecord(
-			object,
-			oldObject,
-			schema.GroupVersionKind(parsed.Request.Kind),
-			parsed.Request.Namespace,
-			parsed.Request.Name,
-			schema.GroupVersionResource{
-				Group:    parsed.Request.Resource.Group,
-				Version:  parsed.Request.Resource.Version,
-				Resource: parsed.Request.Resource.Resource,
-			},
-			parsed.Request.SubResource,
-			admission.Operation(parsed.Request.Operation),
-			nil, // operation options?
-			false,
-			&user.DefaultInfo{
-				Name:   parsed.Request.UserInfo.Username,
-				UID:    parsed.Request.UserInfo.UID,
-				Groups: parsed.Request.UserInfo.Groups,
-				Extra:  convertExtra(parsed.Request.UserInfo.Extra),
-			})
-
-		err = wh.validator.Validate(context.TODO(), attrs, wh.objectInferfaces)
+	out, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error(err, "review response", "uid", parsed.Request.UID, "status", http.StatusInternalServerError)
+		return
 	}
 
-	response := reviewResponse(
-		parsed.Request.UID,
-		err,
-	)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// handleConvert converts x-k8s policies and bindings between versions for
+// the CRD conversion webhook
+func (wh *webhook) handleConvert(w http.ResponseWriter, req *http.Request) {
+	review, err := parseConversionReview(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := &apiextensionsv1.ConversionReview{
+		TypeMeta: review.TypeMeta,
+		Response: conversion.Review(review.Request),
+	}
+	if response.Response.Result.Status != metav1.StatusSuccess {
+		logger.Error(errors.New(response.Response.Result.Message), "conversion", "uid", review.Request.UID, "desiredAPIVersion", review.Request.DesiredAPIVersion)
+	}
 
 	out, err := json.Marshal(response)
 	if err != nil {
-		failure(err, http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error(err, "conversion response", "uid", review.Request.UID, "status", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(out)
-	logger.Info(
-		"review response",
-		"resource",
-		parsed.Request.Resource.String(),
-		"namespace",
-		parsed.Request.Namespace,
-		"name",
-		parsed.Request.Name,
-		"allowed",
-		response.Response.Allowed,
-		"msg",
-		response.Response.Result.Message,
-		"reason",
-		response.Response.Result.Reason,
-		"uid",
-		parsed.Request.UID,
-	)
 }
 
 func reviewResponse(uid types.UID, err error) *admissionv1.AdmissionReview {
@@ -272,6 +160,7 @@ func reviewResponse(uid types.UID, err error) *admissionv1.AdmissionReview {
 	}
 	reason := metav1.StatusReasonUnknown
 	message := "valid"
+	var details *metav1.StatusDetails
 	if err != nil {
 		message = err.Error()
 	}
@@ -281,6 +170,7 @@ func reviewResponse(uid types.UID, err error) *admissionv1.AdmissionReview {
 		reason = statusErr.ErrStatus.Reason
 		message = statusErr.ErrStatus.Message
 		status = statusErr.ErrStatus.Code
+		details = statusErr.ErrStatus.Details
 	}
 
 	return &admissionv1.AdmissionReview{
@@ -295,6 +185,7 @@ func reviewResponse(uid types.UID, err error) *admissionv1.AdmissionReview {
 				Code:    status,
 				Message: message,
 				Reason:  reason,
+				Details: details,
 			},
 		},
 	}
@@ -327,3 +218,23 @@ func parseRequest(r *http.Request) (*admissionv1.AdmissionReview, error) {
 
 	return &a, nil
 }
+
+// parseConversionReview extracts a ConversionReview from an http.Request if
+// possible
+func parseConversionReview(r *http.Request) (*apiextensionsv1.ConversionReview, error) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		return nil, fmt.Errorf("Content-Type: %q should be %q",
+			r.Header.Get("Content-Type"), "application/json")
+	}
+
+	var review apiextensionsv1.ConversionReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		return nil, fmt.Errorf("could not parse conversion review request: %v", err)
+	}
+
+	if review.Request == nil {
+		return nil, fmt.Errorf("conversion review can't be used: Request field is nil")
+	}
+
+	return &review, nil
+}
@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ReviewStream evaluates every AdmissionReview read from in and writes each
+// response to out as a single line of JSON, in the same order.
+//
+// in may hold a single AdmissionReview, several concatenated ones, or JSON
+// lines. Requests which cannot be evaluated are answered with a disallowed
+// response carrying the status the webhook server would have responded with,
+// rather than aborting the stream. An error is only returned if in is not a
+// stream of JSON AdmissionReviews or out cannot be written to.
+//
+// Returns the number of requests which were not allowed.
+func (r *Reviewer) ReviewStream(ctx context.Context, in io.Reader, out io.Writer) (denied int, err error) {
+	decoder := json.NewDecoder(in)
+	encoder := json.NewEncoder(out)
+
+	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return denied, err
+		}
+
+		var review admissionv1.AdmissionReview
+		if err := decoder.Decode(&review); errors.Is(err, io.EOF) {
+			return denied, nil
+		} else if err != nil {
+			return denied, fmt.Errorf("could not parse admission review %d: %w", i, err)
+		}
+
+		response, err := r.Review(ctx, &review)
+		if err != nil {
+			var uid types.UID
+			if review.Request != nil {
+				uid = review.Request.UID
+			}
+			response = errorResponse(uid, err)
+		}
+
+		if !response.Response.Allowed {
+			denied++
+		}
+
+		if err := encoder.Encode(response); err != nil {
+			return denied, err
+		}
+	}
+}
+
+// errorResponse builds a disallowed AdmissionReview response for a request
+// which could not be evaluated
+func errorResponse(uid types.UID, err error) *admissionv1.AdmissionReview {
+	response := reviewResponse(uid, err)
+	response.Response.Result.Code = int32(statusForError(err))
+	if response.Response.Result.Code == http.StatusBadRequest {
+		response.Response.Result.Reason = metav1.StatusReasonBadRequest
+	} else {
+		response.Response.Result.Reason = metav1.StatusReasonInternalError
+	}
+	return response
+}
@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apiserver/pkg/admission"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+type denyNamed string
+
+func (d denyNamed) Handles(admission.Operation) bool {
+	return true
+}
+
+func (d denyNamed) Validate(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	if a.GetName() == string(d) {
+		return admission.NewForbidden(a, errors.New("denied"))
+	}
+	return nil
+}
+
+func review(uid, name string) string {
+	return `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","request":{` +
+		`"uid":"` + uid + `","kind":{"group":"","version":"v1","kind":"ConfigMap"},` +
+		`"resource":{"group":"","version":"v1","resource":"configmaps"},` +
+		`"namespace":"default","name":"` + name + `","operation":"CREATE",` +
+		`"object":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"` + name + `","namespace":"default"}}}}`
+}
+
+func TestReviewStream(t *testing.T) {
+	input := strings.Join([]string{
+		review("1", "allowed"),
+		review("2", "bad"),
+		`{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview"}`,
+		review("4", "allowed"),
+	}, "\n")
+
+	var out bytes.Buffer
+	reviewer := NewReviewer(clientsetscheme.Scheme, denyNamed("bad"))
+	denied, err := reviewer.ReviewStream(context.Background(), strings.NewReader(input), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if denied != 2 {
+		t.Errorf("expected 2 denied requests, got %d", denied)
+	}
+
+	var allowed []bool
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var response admissionv1.AdmissionReview
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		allowed = append(allowed, response.Response.Allowed)
+	}
+
+	expected := []bool{true, false, false, true}
+	if len(allowed) != len(expected) {
+		t.Fatalf("expected %d responses, got %d", len(expected), len(allowed))
+	}
+	for i := range expected {
+		if allowed[i] != expected[i] {
+			t.Errorf("response %d: expected allowed=%v, got %v", i, expected[i], allowed[i])
+		}
+	}
+
+	if _, err := reviewer.ReviewStream(context.Background(), strings.NewReader("{not json"), &out); err == nil {
+		t.Error("expected malformed input to fail")
+	}
+}
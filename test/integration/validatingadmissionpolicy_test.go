@@ -140,10 +140,10 @@ func serverScope(transformConfig func(*rest.Config)) (testClientInterface, func(
 		panic(err)
 	}
 
+	custom := versioned.NewForConfigOrDie(config)
 	NewTestClient := func(config *rest.Config) testClient {
 		kube := kubernetes.NewForConfigOrDie(config)
 		apiext := apiextensionsclientset.NewForConfigOrDie(config)
-		custom := versioned.NewForConfigOrDie(config)
 		dyn := dynamic.NewForConfigOrDie(config)
 
 		client := testClient{
@@ -158,6 +158,9 @@ func serverScope(transformConfig func(*rest.Config)) (testClientInterface, func(
 	client := NewTestClient(config)
 
 	factory := informers.NewSharedInformerFactory(client, 30*time.Second)
+	if err := crdv1alpha1.InjectInformers(factory, custom); err != nil {
+		panic(err)
+	}
 	apiextensionsFactory := apiextensionsinformers.NewSharedInformerFactory(client, 30*time.Second)
 	restmapper := meta.NewLazyRESTMapperLoader(func() (meta.RESTMapper, error) {
 		groupResources, err := restmapper.GetAPIGroupResources(client.Discovery())